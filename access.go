@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Errors of Access.authorize.
+var (
+	errAddrDenied   = errors.New("address not allowed")
+	errUnauthorized = errors.New("invalid or missing credentials")
+)
+
+// Access restricts a server to clients from allowed networks presenting a
+// bearer token or basic auth credentials. A nil Access allows everyone.
+type Access struct {
+	Tokens []string     // Accepted bearer tokens
+	User   string       // Basic auth user, if set
+	Pass   string       // Basic auth password
+	Allow  []*net.IPNet // Allowed client networks; empty allows all
+}
+
+// accessFlags registers the <prefix>Token, <prefix>User, <prefix>Pass and
+// <prefix>Allow flags of a server, and returns a function creating its
+// Access once the flags are parsed.
+func accessFlags(prefix, server string) func() (*Access, error) {
+	var token, user, pass, allow string
+	flag.StringVar(&token, prefix+"Token", "", "Bearer token required by the "+server)
+	flag.StringVar(&user, prefix+"User", "", "Basic auth user required by the "+server)
+	flag.StringVar(&pass, prefix+"Pass", "", "Basic auth password required by the "+server)
+	flag.StringVar(&allow, prefix+"Allow", "", "Comma-separated IPs and CIDRs allowed to connect to the "+server+" (default: all)")
+	return func() (*Access, error) {
+		access, err := NewAccess(token, user, pass, allow)
+		if err != nil {
+			return nil, fmt.Errorf("%sAllow: %w", prefix, err)
+		}
+		return access, nil
+	}
+}
+
+// NewAccess creates an Access from a token, basic auth credentials and a
+// comma-separated allowlist, or returns nil if all are empty.
+func NewAccess(token, user, pass, allow string) (*Access, error) {
+	if token == "" && user == "" && allow == "" {
+		return nil, nil
+	}
+	a := &Access{User: user, Pass: pass}
+	if token != "" {
+		a.Tokens = []string{token}
+	}
+	for _, entry := range strings.Split(allow, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", entry)
+			}
+			bits := 8 * len(ip)
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			a.Allow = append(a.Allow, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		a.Allow = append(a.Allow, network)
+	}
+	return a, nil
+}
+
+// requiresCredentials reports whether clients must authenticate.
+func (a *Access) requiresCredentials() bool {
+	return a != nil && (len(a.Tokens) > 0 || a.User != "")
+}
+
+// allowed reports whether a client address like 10.0.0.1:1234 is allowed.
+func (a *Access) allowed(remoteAddr string) bool {
+	if a == nil || len(a.Allow) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range a.Allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticated reports whether an Authorization header carries an
+// accepted token or the basic auth credentials.
+func (a *Access) authenticated(authorization string) bool {
+	if !a.requiresCredentials() {
+		return true
+	}
+	if token, ok := strings.CutPrefix(authorization, "Bearer "); ok {
+		for _, t := range a.Tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+				return true
+			}
+		}
+		return false
+	}
+	if encoded, ok := strings.CutPrefix(authorization, "Basic "); ok && a.User != "" {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return false
+		}
+		user, pass, _ := strings.Cut(string(decoded), ":")
+		// Both are compared so neither is leaked by timing
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(a.User)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(a.Pass)) == 1
+		return userOK && passOK
+	}
+	return false
+}
+
+// authorize checks a client's address and, unless ipOnly is set, its
+// Authorization header.
+func (a *Access) authorize(remoteAddr, authorization string, ipOnly bool) error {
+	if !a.allowed(remoteAddr) {
+		return errAddrDenied
+	}
+	if !ipOnly && !a.authenticated(authorization) {
+		return errUnauthorized
+	}
+	return nil
+}
+
+// Handler restricts next to authorized clients.
+func (a *Access) Handler(next http.Handler) http.Handler {
+	return a.handler(next, false)
+}
+
+// IPHandler restricts next to allowed addresses, without credentials, for
+// health checks.
+func (a *Access) IPHandler(next http.Handler) http.Handler {
+	return a.handler(next, true)
+}
+
+func (a *Access) handler(next http.Handler, ipOnly bool) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch a.authorize(r.RemoteAddr, r.Header.Get("Authorization"), ipOnly) {
+		case errAddrDenied:
+			http.Error(w, "forbidden", http.StatusForbidden)
+		case errUnauthorized:
+			if a.User != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="gofaxip-bridge", charset="UTF-8"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="gofaxip-bridge"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// ServerOptions returns the interceptors restricting a gRPC server to
+// authorized clients, which send their credentials as authorization
+// metadata.
+func (a *Access) ServerOptions() []grpc.ServerOption {
+	if a == nil {
+		return nil
+	}
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := a.authorizeGRPC(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := a.authorizeGRPC(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+func (a *Access) authorizeGRPC(ctx context.Context) error {
+	var remoteAddr, authorization string
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+	switch a.authorize(remoteAddr, authorization, false) {
+	case errAddrDenied:
+		return status.Error(codes.PermissionDenied, errAddrDenied.Error())
+	case errUnauthorized:
+		return status.Error(codes.Unauthenticated, errUnauthorized.Error())
+	}
+	return nil
+}
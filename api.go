@@ -0,0 +1,425 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults and limits of the per_page parameter.
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+)
+
+// API serves the bridge's HTTP API under /api/v1/.
+type API struct {
+	Source     string // Name of a postgres sink to query, or "" for the bridge's database
+	AdminToken string // Bearer token of the admin endpoints, which are disabled without it
+	Access     *Access
+	TLS        *tls.Config // Serves the API and gRPC API over TLS if set
+}
+
+// Handler returns the handler of the API.
+func (a *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/faxes", a.serveFaxes)
+	mux.HandleFunc("/api/v1/faxes/", a.serveFax)
+	mux.HandleFunc("/api/v1/relays", a.serveRelays)
+	mux.HandleFunc("/api/v1/send", a.serveSend)
+	mux.HandleFunc("/api/v1/stats", a.serveStats)
+	mux.HandleFunc("/api/v1/events", a.serveEvents)
+	mux.HandleFunc("/dashboard/", serveDashboard)
+	mux.HandleFunc("/", serveRoot)
+	return a.Access.Handler(mux)
+}
+
+// serveAPI serves the API on lis.
+func serveAPI(lis net.Listener, api *API) {
+	log.Infof("Serving the API on %s", lis.Addr())
+	log.Fatal(serve(lis, api.Handler(), api.TLS))
+}
+
+// source returns the store records are queried from.
+func (a *API) source() (recordSource, error) {
+	if a.Source == "" {
+		return store, nil
+	}
+	for _, sink := range *sinks.Load() {
+		if sink.name == a.Source {
+			if source, ok := sink.Sink.(recordSource); ok {
+				return source, nil
+			}
+			return nil, fmt.Errorf("sink %s can't be queried", a.Source)
+		}
+	}
+	return nil, fmt.Errorf("sink %s is not configured", a.Source)
+}
+
+// serveFaxes handles /api/v1/faxes?direction=&number=&since=&until=&page=&per_page=.
+func (a *API) serveFaxes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	q, err := parseRecordQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	source, err := a.source()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	page, err := source.QueryRecords(r.Context(), q)
+	if err != nil {
+		log.Errorf("Error querying records: %s", err)
+		writeError(w, http.StatusInternalServerError, "error querying records")
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// serveStats handles /api/v1/stats?since=&until=&format=, the traffic per
+// DID of a period (default: the last 24 hours) as JSON or CSV.
+func (a *API) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	values := r.URL.Query()
+	until, err := parseQueryTime(values.Get("until"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid until: "+err.Error())
+		return
+	}
+	if until.IsZero() {
+		until = time.Now()
+	}
+	since, err := parseQueryTime(values.Get("since"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid since: "+err.Error())
+		return
+	}
+	if since.IsZero() {
+		since = until.Add(-24 * time.Hour)
+	}
+	format := values.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		writeError(w, http.StatusBadRequest, "invalid format, expected json or csv")
+		return
+	}
+	source, err := a.source()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	stats, err := trafficStats(r.Context(), source, since, until, configuredRating())
+	if err != nil {
+		log.Errorf("Error querying stats: %s", err)
+		writeError(w, http.StatusInternalServerError, "error querying stats")
+		return
+	}
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		stats.WriteCSV(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// authorized checks the admin token of a request, writing an error
+// response if it is missing or wrong.
+func (a *API) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if a.AdminToken == "" {
+		writeError(w, http.StatusForbidden, "admin endpoints are disabled without apiAdminToken")
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.AdminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gofaxip-bridge"`)
+		writeError(w, http.StatusUnauthorized, "invalid or missing token")
+		return false
+	}
+	return true
+}
+
+// serveFax handles /api/v1/faxes/{commid}/{preview.png,fax.pdf,relay}.
+func (a *API) serveFax(w http.ResponseWriter, r *http.Request) {
+	commid, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/faxes/"), "/")
+	method := http.MethodGet
+	var handler func(http.ResponseWriter, *http.Request, string)
+	switch action {
+	case "preview.png":
+		handler = a.servePreview
+	case "fax.pdf":
+		handler = a.servePDF
+	case "relay":
+		method, handler = http.MethodPost, a.serveRelay
+	}
+	if commid == "" || handler == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if relayer == nil {
+		writeError(w, http.StatusServiceUnavailable, "relaying is not running")
+		return
+	}
+	if method == http.MethodPost && !a.authorized(w, r) {
+		return
+	}
+	handler(w, r, commid)
+}
+
+// serveRelay relays a received fax again.
+func (a *API) serveRelay(w http.ResponseWriter, r *http.Request, commid string) {
+	job, err := relayer.Rerelay(r.Context(), commid)
+	switch {
+	case errors.Is(err, errRelayQueued):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, errFaxNotFound), errors.Is(err, errTiffNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		log.Errorf("Error relaying %s again: %s", commid, err)
+		writeError(w, http.StatusInternalServerError, "error relaying fax")
+	default:
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+// servePreview serves the first page of a fax as PNG.
+func (a *API) servePreview(w http.ResponseWriter, r *http.Request, commid string) {
+	path, ok := a.tiffPath(w, r, commid)
+	if !ok {
+		return
+	}
+	png, err := renderPreview(path)
+	if err != nil {
+		log.Errorf("Error rendering preview of %s: %s", commid, err)
+		writeError(w, http.StatusInternalServerError, "error rendering preview")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Write(png)
+}
+
+// servePDF serves all pages of a fax as PDF.
+func (a *API) servePDF(w http.ResponseWriter, r *http.Request, commid string) {
+	path, ok := a.tiffPath(w, r, commid)
+	if !ok {
+		return
+	}
+	pdfPath, err := convertTiffToPdf(r.Context(), path)
+	if err != nil {
+		log.Errorf("Error converting %s to PDF: %s", commid, err)
+		writeError(w, http.StatusInternalServerError, "error converting fax")
+		return
+	}
+	defer os.Remove(pdfPath)
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "fax-"+commid+".pdf"))
+	http.ServeFile(w, r, pdfPath)
+}
+
+// tiffPath finds the TIFF of a commid's record, writing an error response
+// if there is none.
+func (a *API) tiffPath(w http.ResponseWriter, r *http.Request, commid string) (string, bool) {
+	source, err := a.source()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return "", false
+	}
+	page, err := source.QueryRecords(r.Context(), RecordQuery{Commid: commid, Page: 1, PerPage: 1})
+	if err != nil {
+		log.Errorf("Error querying records: %s", err)
+		writeError(w, http.StatusInternalServerError, "error querying records")
+		return "", false
+	}
+	if len(page.Records) == 0 {
+		writeError(w, http.StatusNotFound, "no fax with this commid")
+		return "", false
+	}
+	var entry XFRecord
+	if err := json.Unmarshal(page.Records[0], &entry); err != nil {
+		log.Errorf("Error parsing stored record of %s: %s", commid, err)
+		writeError(w, http.StatusInternalServerError, "error parsing stored record")
+		return "", false
+	}
+	path, err := relayer.tiffPath(entry)
+	if errors.Is(err, errTiffNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return "", false
+	} else if err != nil {
+		log.Errorf("Error finding TIFF of %s: %s", commid, err)
+		writeError(w, http.StatusInternalServerError, "error finding TIFF")
+		return "", false
+	}
+	return path, true
+}
+
+// serveRelays handles /api/v1/relays?commid=, returning the relay status
+// of each commid that has one.
+func (a *API) serveRelays(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if relayer == nil {
+		writeError(w, http.StatusServiceUnavailable, "relaying is not running")
+		return
+	}
+	commids := r.URL.Query()["commid"]
+	if len(commids) > maxPerPage {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("too many commids, expected up to %d", maxPerPage))
+		return
+	}
+	statuses, err := relayer.RelayStatuses(r.Context(), commids)
+	if err != nil {
+		log.Errorf("Error querying relay statuses: %s", err)
+		writeError(w, http.StatusInternalServerError, "error querying relay statuses")
+		return
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// sseHeartbeat is how often an idle event stream gets a comment, so
+// proxies don't close it.
+const sseHeartbeat = 15 * time.Second
+
+// serveEvents handles /api/v1/events?types=, streaming events and records
+// as Server-Sent Events named after the event type, or record.
+func (a *API) serveEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	var types map[string]bool
+	if v := r.URL.Query().Get("types"); v != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(v, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+	wants := func(t string) bool { return types == nil || types[t] }
+
+	events, cancelEvents := eventBus.subscribe()
+	defer cancelEvents()
+	records, cancelRecords := recordBus.subscribe()
+	defer cancelRecords()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var name string
+		var data any
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+			continue
+		case event := <-events:
+			name, data = event.Type, event
+		case record := <-records:
+			name, data = "record", record
+		}
+		if !wants(name) {
+			continue
+		}
+		body, err := json.Marshal(data)
+		if err != nil {
+			log.Errorf("Error encoding %s: %s", name, err)
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, body); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// parseRecordQuery reads a RecordQuery from the query string.
+func parseRecordQuery(r *http.Request) (RecordQuery, error) {
+	values := r.URL.Query()
+	q := RecordQuery{
+		Direction: XFDirection(strings.ToUpper(values.Get("direction"))),
+		Number:    values.Get("number"),
+		Page:      1,
+		PerPage:   defaultPerPage,
+	}
+	switch q.Direction {
+	case "", XflRECV, XflSEND, XflJOB:
+	default:
+		return q, fmt.Errorf("invalid direction %q, expected recv, send or job", values.Get("direction"))
+	}
+
+	var err error
+	if q.Since, err = parseQueryTime(values.Get("since")); err != nil {
+		return q, fmt.Errorf("invalid since: %w", err)
+	}
+	if q.Until, err = parseQueryTime(values.Get("until")); err != nil {
+		return q, fmt.Errorf("invalid until: %w", err)
+	}
+	if v := values.Get("page"); v != "" {
+		if q.Page, err = strconv.Atoi(v); err != nil || q.Page < 1 {
+			return q, fmt.Errorf("invalid page %q", v)
+		}
+	}
+	if v := values.Get("per_page"); v != "" {
+		if q.PerPage, err = strconv.Atoi(v); err != nil || q.PerPage < 1 || q.PerPage > maxPerPage {
+			return q, fmt.Errorf("invalid per_page %q, expected 1 to %d", v, maxPerPage)
+		}
+	}
+	return q, nil
+}
+
+// parseQueryTime parses an RFC 3339 time or a date, which is taken as UTC.
+func parseQueryTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// writeJSON writes v as JSON response.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Archive policies for relayed TIFFs.
+const (
+	ArchivePolicyArchive = "archive" // Move into the archive directory
+	ArchivePolicyDelete  = "delete"  // Remove from the spool
+	ArchivePolicyKeep    = "keep"    // Leave in the spool untouched
+)
+
+// ArchiveMeta is written as a JSON sidecar next to each archived TIFF.
+type ArchiveMeta struct {
+	Record   XFRecord  `json:"record"`
+	Source   string    `json:"source"`
+	Attempts int       `json:"attempts"`
+	Archived time.Time `json:"archived"`
+	Objects  []string  `json:"objects,omitempty"` // Keys of the documents in the S3 archive
+}
+
+// Archiver disposes of relayed TIFFs according to the archive policy.
+type Archiver struct {
+	dir    string
+	policy string
+}
+
+// NewArchiver creates an archiver storing files below dir. Archived files
+// are purged by the Janitor.
+func NewArchiver(dir, policy string) (*Archiver, error) {
+	switch policy {
+	case ArchivePolicyArchive:
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("error creating archive directory: %w", err)
+		}
+	case ArchivePolicyDelete, ArchivePolicyKeep:
+	default:
+		return nil, fmt.Errorf("invalid archive policy: %s", policy)
+	}
+
+	return &Archiver{
+		dir:    dir,
+		policy: policy,
+	}, nil
+}
+
+// Store uploads the relayed TIFF at path to the S3 archive of the config,
+// if any, and then disposes of it. A TIFF that failed to upload is left
+// where it is.
+func (a *Archiver) Store(job *RelayJob, path string, cfg *Config) error {
+	if cfg.S3Archive != nil {
+		if err := cfg.S3Archive.Upload(job, path, cfg.Routes.Match(job.Entry)); err != nil {
+			return err
+		}
+	}
+
+	switch a.policy {
+	case ArchivePolicyKeep:
+		return nil
+	case ArchivePolicyDelete:
+		return os.Remove(path)
+	}
+
+	ts := job.Entry.Ts
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	dir := filepath.Join(a.dir, ts.Format("2006"), ts.Format("01"), ts.Format("02"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	name := job.Entry.Commid + "-" + filepath.Base(path)
+	dest := filepath.Join(dir, name)
+	if err := moveFile(path, dest); err != nil {
+		return err
+	}
+
+	meta, err := json.MarshalIndent(ArchiveMeta{
+		Record:   job.Entry,
+		Source:   path,
+		Attempts: job.Attempts,
+		Archived: time.Now(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(dest+".json", meta, 0644); err != nil {
+		return err
+	}
+
+	log.Infof("Archived %s to %s", path, dest)
+	return nil
+}
+
+// Find returns the archived TIFF of a commid, or "" if it is not archived.
+func (a *Archiver) Find(commid string) (string, error) {
+	if a.policy != ArchivePolicyArchive {
+		return "", nil
+	}
+	matches, err := filepath.Glob(filepath.Join(a.dir, "*", "*", "*", filepath.Base(commid)+"-*"))
+	if err != nil {
+		return "", err
+	}
+	for _, m := range matches {
+		if filepath.Ext(m) != ".json" {
+			return m, nil
+		}
+	}
+	return "", nil
+}
+
+// purge removes archived TIFFs last modified before docs and sidecars last
+// modified before meta, and any partition directories left empty. A zero
+// cutoff keeps the files.
+func (a *Archiver) purge(docs, meta time.Time) (purgedDocs, purgedMeta int) {
+	if a.policy != ArchivePolicyArchive || (docs.IsZero() && meta.IsZero()) {
+		return 0, 0
+	}
+	var dirs []string
+	err := filepath.Walk(a.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != a.dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		cutoff, count := docs, &purgedDocs
+		if filepath.Ext(path) == ".json" {
+			cutoff, count = meta, &purgedMeta
+		}
+		if info.ModTime().Before(cutoff) {
+			if err := os.Remove(path); err != nil {
+				log.Errorf("Error purging archived file: %s", err)
+			} else {
+				*count++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Error walking archive: %s", err)
+	}
+
+	// Deepest directories first, so parents become empty in turn
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i]) // fails for non-empty directories
+	}
+	return purgedDocs, purgedMeta
+}
+
+// moveFile renames src to dst, falling back to copy and remove across filesystems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Names of the relay backends.
+const (
+	BackendSendfax = "sendfax"
+	BackendEmail   = "email"
+	BackendESL     = "esl"
+	BackendHylaFAX = "hylafax"
+)
+
+// A RelayBackend delivers a received fax to its destination. Deliver returns
+// the output of the delivery (e.g. the sendfax output) for diagnostics.
+type RelayBackend interface {
+	Deliver(ctx context.Context, job *RelayJob, path string, route *Route, cfg *Config) (string, error)
+}
+
+// SendfaxBackend relays faxes by submitting them to HylaFAX with sendfax.
+// Jobs submitted to the local HylaFAX are tracked until their SEND record
+// shows up in the xferfaxlog.
+type SendfaxBackend struct {
+	Tag     string // Jobtag prefix marking our own relays
+	Tracker *DeliveryTracker
+}
+
+// Deliver submits the fax with sendfax.
+func (b *SendfaxBackend) Deliver(ctx context.Context, job *RelayJob, path string, route *Route, cfg *Config) (string, error) {
+	output, err := sendFax(ctx, job.Entry, path, b.Tag+":"+job.Entry.Commid, route, cfg.profile(route))
+	if err != nil || b.Tracker == nil || (route != nil && route.Host != "") {
+		return output, err
+	}
+
+	if jobid := parseSendfaxJobID(output); jobid != "" {
+		if err := b.Tracker.Track(jobid, job.Entry); err != nil {
+			log.Errorf("Error tracking delivery of %s: %s", job.Entry.Commid, err)
+		}
+	} else {
+		log.Warnf("No job ID in sendfax output for %s, delivery will be matched by jobtag", job.Entry.Commid)
+		if err := b.Tracker.Track("commid:"+job.Entry.Commid, job.Entry); err != nil {
+			log.Errorf("Error tracking delivery of %s: %s", job.Entry.Commid, err)
+		}
+	}
+	return output, nil
+}
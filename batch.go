@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// batchRetryPolicy is how often sinks retry pushing a failed batch before it is dropped.
+var batchRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   2 * time.Second,
+	MaxDelay:    time.Minute,
+	Jitter:      0.2,
+}
+
+// BatchOptions are the batching options shared by batching sinks.
+type BatchOptions struct {
+	BatchSize int      `json:"batch_size"` // Default: 100
+	BatchWait Duration `json:"batch_wait"` // Default: 5s
+}
+
+// recordBatcher collects records for sinks writing them in batches.
+type recordBatcher struct {
+	name    string
+	records chan XFRecord
+	flush   func(ctx context.Context, records []XFRecord) error
+	done    chan struct{} // Closed once the last batch is flushed after Close
+}
+
+// startBatcher starts collecting records and hands them to flush once
+// BatchSize records are buffered or the oldest has waited for BatchWait.
+// Failed batches are retried with backoff and dropped after the last attempt.
+func startBatcher(name string, opts BatchOptions, flush func(ctx context.Context, records []XFRecord) error) *recordBatcher {
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 100
+	}
+	if opts.BatchWait.Duration <= 0 {
+		opts.BatchWait.Duration = 5 * time.Second
+	}
+
+	b := &recordBatcher{
+		name:    name,
+		records: make(chan XFRecord, 1024),
+		flush:   flush,
+		done:    make(chan struct{}),
+	}
+	go b.run(opts.BatchSize, opts.BatchWait.Duration)
+	return b
+}
+
+// async marks batching sinks, whose Push only queues the record.
+func (b *recordBatcher) async() {}
+
+// Push queues the record for the next batch.
+func (b *recordBatcher) Push(ctx context.Context, record XFRecord) error {
+	select {
+	case b.records <- record:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes the buffered records and stops the batcher. Records must not
+// be pushed after Close.
+func (b *recordBatcher) Close() error {
+	close(b.records)
+	<-b.done
+	return nil
+}
+
+func (b *recordBatcher) run(size int, wait time.Duration) {
+	var batch []XFRecord
+	timer := time.NewTimer(wait)
+	timer.Stop()
+
+	for {
+		select {
+		case record, ok := <-b.records:
+			if !ok {
+				if len(batch) > 0 {
+					b.push(batch)
+				}
+				close(b.done)
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(wait)
+			}
+			batch = append(batch, record)
+			if len(batch) < size {
+				continue
+			}
+			// Drain a tick that fired meanwhile, or it would flush the next
+			// batch early
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-timer.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		b.push(batch)
+		batch = nil
+	}
+}
+
+// push flushes a batch, retrying it with backoff.
+func (b *recordBatcher) push(batch []XFRecord) {
+	for attempt := 1; ; attempt++ {
+		err := b.flush(context.Background(), batch)
+		countPush(b.name, err)
+		if err == nil {
+			sinkLastSuccess.WithLabelValues(b.name).SetToCurrentTime()
+			log.Debugf("Pushed %d records to sink %s", len(batch), b.name)
+			return
+		}
+		if attempt >= batchRetryPolicy.MaxAttempts {
+			sinkDropped.WithLabelValues(b.name).Add(float64(len(batch)))
+			log.Errorf("Dropping %d records after %d failed pushes to sink %s: %s", len(batch), attempt, b.name, err)
+			return
+		}
+		delay := batchRetryPolicy.Delay(attempt)
+		sinkRetries.WithLabelValues(b.name).Inc()
+		log.Warnf("Failed to push %d records to sink %s, retrying in %s: %s", len(batch), b.name, delay, err)
+		time.Sleep(delay)
+	}
+}
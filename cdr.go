@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+func init() {
+	RegisterSink("cdr", newCDRSink)
+}
+
+// CDR formats.
+const (
+	CDRFormatCSV    = "csv"
+	CDRFormatRadius = "radius"
+	CDRFormatJSON   = "json"
+)
+
+// Billing units.
+const (
+	BillingDuration = "duration"
+	BillingPages    = "pages"
+)
+
+// cdrFields are the fields of call detail records, in their default order.
+var cdrFields = []string{
+	"time", "commid", "direction", "modem", "caller", "caller_name", "called", "remote_id",
+	"pages", "duration", "jobtime", "status", "reason", "billable_seconds", "billable_units", "cost", "currency",
+}
+
+// cdrNumeric are the fields not quoted by the radius and json formats.
+var cdrNumeric = map[string]bool{
+	"pages": true, "duration": true, "jobtime": true, "billable_seconds": true, "billable_units": true, "cost": true,
+}
+
+// radiusAttributes names the fields in the radius format, after the
+// accounting attributes of RFC 2866 where one fits.
+var radiusAttributes = map[string]string{
+	"time":             "Event-Timestamp",
+	"commid":           "Acct-Session-Id",
+	"direction":        "Fax-Direction",
+	"modem":            "NAS-Port-Id",
+	"caller":           "Calling-Station-Id",
+	"caller_name":      "Fax-Caller-Name",
+	"called":           "Called-Station-Id",
+	"remote_id":        "Fax-Remote-Id",
+	"pages":            "Fax-Pages",
+	"duration":         "Acct-Session-Time",
+	"jobtime":          "Fax-Job-Time",
+	"status":           "Fax-Status",
+	"reason":           "Fax-Reason",
+	"billable_seconds": "Fax-Billable-Seconds",
+	"billable_units":   "Fax-Billable-Units",
+	"cost":             "Fax-Cost",
+	"currency":         "Fax-Currency",
+}
+
+// CDRSink writes a call detail record per received and sent fax, to a
+// rotating file or an HTTP endpoint, for billing the bridged traffic.
+type CDRSink struct {
+	Format           string   `json:"format"`            // csv, radius or json (default: csv)
+	Fields           []string `json:"fields"`            // Fields in order (default: all)
+	URL              string   `json:"url"`               // Posts each CDR here instead of writing a file
+	BillingIncrement Duration `json:"billing_increment"` // Billed durations are rounded up to this (default: 1m)
+	BillingMinimum   Duration `json:"billing_minimum"`   // Minimum billed duration of connected calls (default: the increment)
+	BillingUnits     string   `json:"billing_units"`     // duration or pages (default: duration)
+
+	file    *FileSink
+	webhook *WebhookSink
+}
+
+func newCDRSink(raw json.RawMessage, env SinkEnv) (Sink, error) {
+	s := &CDRSink{Format: CDRFormatCSV, BillingUnits: BillingDuration}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	ext := map[string]string{CDRFormatCSV: ".csv", CDRFormatRadius: ".detail", CDRFormatJSON: ".ndjson"}[s.Format]
+	if ext == "" {
+		return nil, fmt.Errorf("unknown format: %s", s.Format)
+	}
+	if len(s.Fields) == 0 {
+		s.Fields = cdrFields
+	}
+	for _, f := range s.Fields {
+		if _, ok := radiusAttributes[f]; !ok {
+			return nil, fmt.Errorf("unknown field: %s", f)
+		}
+	}
+	if s.BillingIncrement.Duration <= 0 {
+		s.BillingIncrement.Duration = time.Minute
+	}
+	if s.BillingMinimum.Duration <= 0 {
+		s.BillingMinimum.Duration = s.BillingIncrement.Duration
+	}
+	if s.BillingUnits != BillingDuration && s.BillingUnits != BillingPages {
+		return nil, fmt.Errorf("billing_units must be duration or pages")
+	}
+
+	if s.URL != "" {
+		webhook, err := newWebhookSink(raw, env)
+		if err != nil {
+			return nil, err
+		}
+		s.webhook = webhook.(*WebhookSink)
+		return s, nil
+	}
+	file, err := openFileSink(raw, filepath.Join(env.LogDir, env.Name+ext))
+	if err != nil {
+		return nil, err
+	}
+	s.file = file
+	return s, nil
+}
+
+// billable returns the billed seconds and units of a fax. Calls that never
+// connected are not billed.
+func (s *CDRSink) billable(r XFRecord) (float64, float64) {
+	duration := hmsSeconds(r.Conntime)
+	if duration <= 0 {
+		return 0, 0
+	}
+	increment := s.BillingIncrement.Seconds()
+	seconds := math.Max(math.Ceil(duration/increment)*increment, s.BillingMinimum.Seconds())
+	if s.BillingUnits == BillingPages {
+		return seconds, float64(r.Pages)
+	}
+	return seconds, math.Ceil(seconds / increment)
+}
+
+// values returns the fields of the record's CDR. Without a matching rate,
+// cost and currency are empty.
+func (s *CDRSink) values(r XFRecord) map[string]string {
+	seconds, units := s.billable(r)
+	num := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	values := map[string]string{
+		"time":             r.Ts.Format(time.RFC3339),
+		"commid":           r.Commid,
+		"direction":        string(r.Direction),
+		"modem":            r.Modem,
+		"caller":           r.Cidnum,
+		"caller_name":      r.Cidname,
+		"called":           r.Destnum,
+		"remote_id":        r.RemoteID,
+		"pages":            strconv.FormatUint(uint64(r.Pages), 10),
+		"duration":         num(hmsSeconds(r.Conntime)),
+		"jobtime":          num(hmsSeconds(r.Jobtime)),
+		"status":           r.ReasonCode,
+		"reason":           r.Reason,
+		"billable_seconds": num(seconds),
+		"billable_units":   num(units),
+	}
+	if cost := configuredRating().Cost(r); cost != nil {
+		values["cost"], values["currency"] = num(cost.Amount), cost.Currency
+	}
+	return values
+}
+
+// format renders the record's CDR, and the CSV header.
+func (s *CDRSink) format(r XFRecord) (line, header []byte, err error) {
+	values := s.values(r)
+	var buf bytes.Buffer
+	switch s.Format {
+	case CDRFormatCSV:
+		row := make([]string, len(s.Fields))
+		for i, f := range s.Fields {
+			row[i] = values[f]
+		}
+		cw := csv.NewWriter(&buf)
+		cw.Write(s.Fields)
+		cw.Flush()
+		header = append([]byte{}, buf.Bytes()...)
+		buf.Reset()
+		cw.Write(row)
+		cw.Flush()
+		err = cw.Error()
+	case CDRFormatRadius:
+		// The detail file format of FreeRADIUS
+		fmt.Fprintf(&buf, "%s\n\tAcct-Status-Type = Stop\n", r.Ts.Format(time.ANSIC))
+		for _, f := range s.Fields {
+			v := values[f]
+			if cdrNumeric[f] && v == "" {
+				continue
+			}
+			if f == "time" {
+				v = strconv.FormatInt(r.Ts.Unix(), 10)
+			} else if !cdrNumeric[f] {
+				v = strconv.Quote(v)
+			}
+			fmt.Fprintf(&buf, "\t%s = %s\n", radiusAttributes[f], v)
+		}
+		buf.WriteByte('\n')
+	case CDRFormatJSON:
+		obj := make(map[string]any, len(s.Fields))
+		for _, f := range s.Fields {
+			if cdrNumeric[f] && values[f] == "" {
+				obj[f] = nil
+			} else if cdrNumeric[f] {
+				obj[f] = json.Number(values[f])
+			} else {
+				obj[f] = values[f]
+			}
+		}
+		err = json.NewEncoder(&buf).Encode(obj)
+	}
+	return buf.Bytes(), header, err
+}
+
+// Push writes the CDR of a received or sent fax. Job progress records are
+// skipped.
+func (s *CDRSink) Push(ctx context.Context, record XFRecord) error {
+	if record.Direction != XflRECV && record.Direction != XflSEND {
+		return nil
+	}
+	line, header, err := s.format(record)
+	if err != nil {
+		return fmt.Errorf("error formatting cdr: %w", err)
+	}
+	if s.webhook != nil {
+		contentType := map[string]string{CDRFormatCSV: "text/csv", CDRFormatRadius: "text/plain", CDRFormatJSON: "application/json"}[s.Format]
+		return s.webhook.post(ctx, append(header, line...), contentType)
+	}
+	return s.file.write(line, header)
+}
+
+// Close closes the CDR file.
+func (s *CDRSink) Close() error {
+	if s.file != nil {
+		return s.file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	RegisterSink("clickhouse", newClickHouseSink)
+}
+
+// clickhouseSchema creates the records table; %s is the qualified table name.
+const clickhouseSchema = `CREATE TABLE IF NOT EXISTS %s (
+	commid    String,
+	ts        DateTime64(3, 'UTC'),
+	direction LowCardinality(String),
+	modem     LowCardinality(String),
+	jobid     String,
+	jobtag    String,
+	filename  String,
+	sender    String,
+	destnum   String,
+	remote_id String,
+	params    String,
+	pages     UInt32,
+	jobtime   String,
+	conntime  String,
+	reason    String,
+	cidname   String,
+	cidnum    String,
+	owner     String,
+	dcs       String,
+	record    String
+) ENGINE = MergeTree
+PARTITION BY toYYYYMM(ts)
+ORDER BY (ts, commid)`
+
+// ClickHouseSink inserts records in batches through ClickHouse's HTTP
+// interface, creating the table if needed.
+type ClickHouseSink struct {
+	URL      string     `json:"url"`      // e.g. http://clickhouse:8123
+	Database string     `json:"database"` // Default: default
+	Table    string     `json:"table"`    // Default: fax_records
+	Username string     `json:"username,omitempty"`
+	Password string     `json:"password,omitempty"`
+	TLS      TLSOptions `json:"tls"`
+	BatchOptions
+
+	client *http.Client
+	*recordBatcher
+}
+
+func newClickHouseSink(raw json.RawMessage, env SinkEnv) (Sink, error) {
+	s := &ClickHouseSink{Database: "default", Table: "fax_records"}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	if s.URL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	if !sqlIdentifier.MatchString(s.Database) || !sqlIdentifier.MatchString(s.Table) {
+		return nil, fmt.Errorf("invalid database or table name")
+	}
+
+	client, err := s.TLS.client()
+	if err != nil {
+		return nil, err
+	}
+	s.client = client
+
+	if err := s.query(context.Background(), fmt.Sprintf(clickhouseSchema, s.table()), nil); err != nil {
+		return nil, fmt.Errorf("error creating table %s: %w", s.table(), err)
+	}
+
+	// Large batches suit ClickHouse better than frequent small inserts
+	if s.BatchSize == 0 {
+		s.BatchSize = 1000
+	}
+	s.recordBatcher = startBatcher(env.Name, s.BatchOptions, s.insert)
+	return s, nil
+}
+
+func (s *ClickHouseSink) table() string {
+	return s.Database + "." + s.Table
+}
+
+// insert sends a batch of records as JSONEachRow.
+func (s *ClickHouseSink) insert(ctx context.Context, records []XFRecord) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, r := range records {
+		values := recordValues(r)
+		row := make(map[string]any, len(recordColumns))
+		for i, c := range recordColumns {
+			row[c] = values[i]
+		}
+		row["ts"] = r.Ts.UTC().Format("2006-01-02 15:04:05.000")
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("error marshaling json: %w", err)
+		}
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", s.table())
+	return s.query(ctx, query, &body)
+}
+
+// query runs a statement; the body holds the data of INSERT statements.
+func (s *ClickHouseSink) query(ctx context.Context, query string, body io.Reader) error {
+	u := strings.TrimSuffix(s.URL, "/") + "/?" + url.Values{"query": {query}}.Encode()
+	if body == nil {
+		body = http.NoBody
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", u, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	if s.Username != "" {
+		req.Header.Set("X-ClickHouse-User", s.Username)
+		req.Header.Set("X-ClickHouse-Key", s.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending query to ClickHouse: %w", err)
+	}
+	defer resp.Body.Close()
+	responseBody, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(responseBody))}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterSink("cloudwatch", newCloudWatchSink)
+}
+
+// CloudWatchSink ships records as JSON log events to a CloudWatch Logs
+// stream. Credentials come from the default AWS chain: environment,
+// shared config and credentials files (optionally a named profile), and
+// ECS task or EC2 instance roles.
+type CloudWatchSink struct {
+	Region       string `json:"region,omitempty"`  // Default: from the AWS config
+	Profile      string `json:"profile,omitempty"` // Shared config profile
+	Group        string `json:"group"`
+	Stream       string `json:"stream,omitempty"` // Default: the hostname
+	CreateStream *bool  `json:"create"`           // Create the group and stream if missing (default: true)
+	BatchOptions
+
+	client *cloudwatchlogs.Client
+
+	mu    sync.Mutex // Serializes PutLogEvents and guards token
+	token *string    // Sequence token expected by the stream
+	*recordBatcher
+}
+
+func newCloudWatchSink(raw json.RawMessage, env SinkEnv) (Sink, error) {
+	s := &CloudWatchSink{}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	if s.Group == "" {
+		return nil, fmt.Errorf("group is required")
+	}
+	if s.Stream == "" {
+		if s.Stream, _ = os.Hostname(); s.Stream == "" {
+			s.Stream = "gofaxip-bridge"
+		}
+	}
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if s.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(s.Region))
+	}
+	if s.Profile != "" {
+		opts = append(opts, awsconfig.WithSharedConfigProfile(s.Profile))
+	}
+	opts = append(opts, awsconfig.WithHTTPClient(httpClient))
+
+	ctx := context.Background()
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading AWS config: %w", err)
+	}
+	s.client = cloudwatchlogs.NewFromConfig(cfg)
+
+	if s.CreateStream == nil || *s.CreateStream {
+		if err := s.create(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	s.recordBatcher = startBatcher(env.Name, s.BatchOptions, s.put)
+	return s, nil
+}
+
+// create creates the log group and stream unless they exist.
+func (s *CloudWatchSink) create(ctx context.Context) error {
+	var exists *types.ResourceAlreadyExistsException
+	_, err := s.client.CreateLogGroup(ctx, &cloudwatchlogs.CreateLogGroupInput{LogGroupName: aws.String(s.Group)})
+	if err != nil && !errors.As(err, &exists) {
+		return fmt.Errorf("error creating log group %s: %w", s.Group, err)
+	}
+	_, err = s.client.CreateLogStream(ctx, &cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(s.Group),
+		LogStreamName: aws.String(s.Stream),
+	})
+	if err != nil && !errors.As(err, &exists) {
+		return fmt.Errorf("error creating log stream %s: %w", s.Stream, err)
+	}
+	return nil
+}
+
+// put sends a batch of records as log events.
+func (s *CloudWatchSink) put(ctx context.Context, records []XFRecord) error {
+	// Events must be in chronological order; they are stamped with the
+	// time they are sent, like Loki entries.
+	now := time.Now().UnixMilli()
+	events := make([]types.InputLogEvent, 0, len(records))
+	for _, r := range records {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("error marshaling json: %w", err)
+		}
+		events = append(events, types.InputLogEvent{Message: aws.String(string(data)), Timestamp: aws.Int64(now)})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		out, err := s.client.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String(s.Group),
+			LogStreamName: aws.String(s.Stream),
+			LogEvents:     events,
+			SequenceToken: s.token,
+		})
+
+		var badToken *types.InvalidSequenceTokenException
+		var accepted *types.DataAlreadyAcceptedException
+		switch {
+		case err == nil:
+			s.token = out.NextSequenceToken
+			if info := out.RejectedLogEventsInfo; info != nil {
+				log.Warnf("CloudWatch rejected some log events of %s/%s: %+v", s.Group, s.Stream, *info)
+			}
+			return nil
+		case errors.As(err, &accepted):
+			s.token = accepted.ExpectedSequenceToken
+			return nil
+		case errors.As(err, &badToken) && attempt == 0:
+			s.token = badToken.ExpectedSequenceToken
+		default:
+			return fmt.Errorf("error putting log events: %w", err)
+		}
+	}
+}
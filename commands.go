@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sagostin/gofaxip-bridge/notify"
+)
+
+const usage = `Usage: %[1]s [command] [flags]
+
+Commands:
+  bridge  Relay received faxes and push xferfaxlog records (default)
+  notify  Notify of finished outbound jobs (fax_notify)
+  all     Run bridge and notify in one process
+  qfile   Print or change a HylaFAX queue file under its lock
+  relay   Relay received faxes again through a running bridge
+
+Run %[1]s <command> -h for the flags of a command.
+`
+
+func main() {
+	command := "bridge"
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	switch command {
+	case "bridge":
+		runBridge(false)
+	case "all":
+		runBridge(true)
+	case "notify":
+		runNotify()
+	case "qfile":
+		runQfile(os.Args[1:])
+	case "relay":
+		runRelay()
+	case "help":
+		fmt.Printf(usage, os.Args[0])
+	default:
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		os.Exit(2)
+	}
+}
+
+// runNotify runs fax_notify on its own.
+func runNotify() {
+	var configPath, metricsAddr string
+	flag.StringVar(&configPath, "config", "", "Path to the config file whose fax_notify section is used besides .env")
+	flag.StringVar(&metricsAddr, "metricsAddr", "", "Address to serve Prometheus metrics on, e.g. :9101 (disabled if empty)")
+	flag.DurationVar(&httpClient.Timeout, "httpTimeout", httpClient.Timeout, "Maximum time a webhook may take (WEBHOOK_TIMEOUT overrides it)")
+	metricsAccess := accessFlags("metrics", "metrics endpoint")
+	metricsTLS := serverTLSFlags("metrics", "metrics endpoint")
+	flag.Parse()
+	if err := applyFlagEnv(); err != nil {
+		log.Fatalf("Invalid environment: %s", err)
+	}
+	metricsAuth, err := metricsAccess()
+	if err != nil {
+		log.Fatalf("Invalid metrics access: %s", err)
+	}
+	metricsTLSConfig, err := metricsTLS()
+	if err != nil {
+		log.Fatalf("Invalid metrics TLS: %s", err)
+	}
+
+	opts := notify.Options{HTTPClient: httpClient}
+	if configPath != "" {
+		cfg, err := LoadConfig(configPath)
+		if err != nil {
+			log.Fatalf("Failed to load config: %s", err)
+		}
+		opts.Env = cfg.FaxNotify.env()
+	}
+	if metricsAddr != "" {
+		go serveHTTP(listen("metrics", metricsAddr), nil, metricsAuth, metricsTLSConfig)
+	}
+	log.Fatal(notify.Run(opts))
+}
+
+// runRelay asks a running bridge to relay the received faxes of the
+// commids given as arguments again.
+func runRelay() {
+	var apiURL, token string
+	flag.StringVar(&apiURL, "api", "http://localhost:8080", "URL of the bridge's API (see apiAddr)")
+	flag.StringVar(&token, "apiAdminToken", "", "Admin token of the bridge's API")
+	secretFileFlag("apiAdminToken")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s relay [flags] <commid>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if err := applyFlagEnv(); err != nil {
+		log.Fatalf("Invalid environment: %s", err)
+	}
+	if err := applySecretFiles(); err != nil {
+		log.Fatalf("Failed to read secret: %s", err)
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, commid := range flag.Args() {
+		if err := requestRelay(apiURL, token, commid); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", commid, err)
+			failed = true
+		} else {
+			fmt.Printf("%s: queued\n", commid)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func requestRelay(apiURL, token, commid string) error {
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(apiURL, "/")+"/api/v1/faxes/"+url.PathEscape(commid)+"/relay", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusAccepted {
+		return nil
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return fmt.Errorf("%s: %s", resp.Status, body.Error)
+}
+
+// startNotify runs fax_notify next to the bridge, with the fax_notify
+// section of its config.
+func startNotify(cfg *Config, configured bool) {
+	opts := notify.Options{HTTPClient: httpClient}
+	if configured {
+		opts.Env = cfg.FaxNotify.env()
+	}
+	go func() {
+		log.Fatalf("fax_notify stopped: %s", notify.Run(opts))
+	}()
+}
+
+// serveHTTP serves the metrics, and the health checks if health is set, on
+// addr. It is not the default mux, which net/http/pprof registers its
+// handlers on.
+func serveHTTP(lis net.Listener, health *Health, access *Access, tlsConfig *tls.Config) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", access.Handler(promhttp.Handler()))
+	if health != nil {
+		mux.Handle("/healthz", access.IPHandler(http.HandlerFunc(health.ServeLive)))
+		mux.Handle("/readyz", access.IPHandler(http.HandlerFunc(health.ServeReady)))
+	}
+	log.Fatal(serve(lis, mux, tlsConfig))
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config holds the bridge settings loaded from the -config file, a JSON,
+// YAML or TOML file by its extension.
+type Config struct {
+	Flags     Settings `json:"flags"`      // Values of command-line flags not given on the command line or in the environment
+	FaxNotify Settings `json:"fax_notify"` // Environment of fax_notify (the notify command)
+
+	Routes   RoutingTable              `json:"routes"`
+	Rewrite  NumberRewriter            `json:"rewrite"`
+	Profiles map[string]SendfaxProfile `json:"profiles"`
+	Notify   NotifyConfig              `json:"notify"`
+	Filter   RelayFilter               `json:"filter"`
+	Backends []string                  `json:"backends"` // Default relay backends (default: sendfax)
+	Email    *EmailDelivery            `json:"email"`
+	ESL      *ESLDelivery              `json:"esl"`
+	HylaFAX  *HylaFAXDelivery          `json:"hylafax"`
+
+	Schedules map[string]*Schedule `json:"schedules"`
+	Schedule  string               `json:"schedule"` // Default schedule for all routes
+
+	RateLimit  RateLimits `json:"rate_limit"`
+	Coversheet Coversheet `json:"coversheet"`
+	Hooks      Hooks      `json:"hooks"`
+	Loki       LokiLabels `json:"loki"`
+
+	Sinks []SinkConfig `json:"sinks"` // Additional outputs for every record
+
+	Retention Retention `json:"retention"`
+	Reports   []*Report `json:"reports"`
+
+	MailToFax   *MailToFax   `json:"mail_to_fax"`  // SMTP gateway of smtpAddr
+	WatchFolder *WatchFolder `json:"watch_folder"` // Drop directory faxing its files
+	PrintToFax  *PrintToFax  `json:"print_to_fax"` // IPP printer of ippAddr
+	S3Archive   *S3Archive   `json:"s3_archive"`   // Bucket relayed faxes are uploaded to
+	Rating      *Rating      `json:"rating"`       // Rates of faxes by destination prefix
+}
+
+// Duration is a time.Duration that is read from strings like "30s" in the config.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+// MarshalJSON formats the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// LoadConfig reads and parses a configuration file, expanding ${VAR}
+// references to environment variables.
+func LoadConfig(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+	if data, err = expandSecrets(expandEnv(data)); err != nil {
+		return nil, fmt.Errorf("%s: error reading secret: %w", filename, err)
+	}
+	if data, err = configJSON(filename, data); err != nil {
+		return nil, fmt.Errorf("%s: error parsing config: %w", filename, err)
+	}
+
+	cfg := &Config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: error parsing config: %w", filename, err)
+	}
+	if err := cfg.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return cfg, nil
+}
+
+// compile validates the config and prepares it for use.
+func (c *Config) compile() error {
+	if err := c.Rewrite.compile(); err != nil {
+		return err
+	}
+	if err := c.Filter.compile(); err != nil {
+		return err
+	}
+
+	if err := c.Coversheet.compile(); err != nil {
+		return err
+	}
+	if err := c.Hooks.validate(); err != nil {
+		return err
+	}
+	if err := c.Loki.compile(); err != nil {
+		return err
+	}
+	if err := validateSinks(c.Sinks); err != nil {
+		return err
+	}
+	if err := c.Notify.compile(c.Routes); err != nil {
+		return err
+	}
+	if c.Email != nil {
+		if err := c.Email.compile(); err != nil {
+			return err
+		}
+	}
+	if c.ESL != nil {
+		if err := c.ESL.compile(); err != nil {
+			return err
+		}
+	}
+	if c.HylaFAX != nil {
+		if err := c.HylaFAX.compile(); err != nil {
+			return err
+		}
+	}
+	if c.MailToFax != nil {
+		if err := c.MailToFax.compile(); err != nil {
+			return err
+		}
+		if _, ok := c.Profiles[c.MailToFax.Profile]; c.MailToFax.Profile != "" && !ok {
+			return fmt.Errorf("mail_to_fax: unknown profile: %s", c.MailToFax.Profile)
+		}
+	}
+	if c.WatchFolder != nil {
+		if err := c.WatchFolder.compile(); err != nil {
+			return err
+		}
+		if _, ok := c.Profiles[c.WatchFolder.Profile]; c.WatchFolder.Profile != "" && !ok {
+			return fmt.Errorf("watch_folder: unknown profile: %s", c.WatchFolder.Profile)
+		}
+	}
+	if c.PrintToFax != nil {
+		if err := c.PrintToFax.compile(); err != nil {
+			return err
+		}
+		if _, ok := c.Profiles[c.PrintToFax.Profile]; c.PrintToFax.Profile != "" && !ok {
+			return fmt.Errorf("print_to_fax: unknown profile: %s", c.PrintToFax.Profile)
+		}
+	}
+	if c.S3Archive != nil {
+		if err := c.S3Archive.compile(); err != nil {
+			return err
+		}
+	}
+	if c.Rating != nil {
+		if err := c.Rating.compile(); err != nil {
+			return err
+		}
+	}
+	names := make(map[string]bool)
+	for _, r := range c.Reports {
+		if r == nil {
+			return fmt.Errorf("reports: empty report")
+		}
+		if err := r.compile(); err != nil {
+			return err
+		}
+		if names[r.Name] {
+			return fmt.Errorf("reports: duplicate name: %s", r.Name)
+		}
+		names[r.Name] = true
+	}
+	if len(c.Backends) == 0 {
+		c.Backends = []string{BackendSendfax}
+	}
+	if err := c.validateBackends(c.Backends); err != nil {
+		return err
+	}
+
+	for name, schedule := range c.Schedules {
+		if schedule == nil {
+			return fmt.Errorf("schedule %s: empty schedule", name)
+		}
+		if err := schedule.compile(); err != nil {
+			return fmt.Errorf("schedule %s: %w", name, err)
+		}
+	}
+	if _, ok := c.Schedules[c.Schedule]; c.Schedule != "" && !ok {
+		return fmt.Errorf("unknown schedule: %s", c.Schedule)
+	}
+
+	for name, profile := range c.Profiles {
+		if err := profile.validate(); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	for _, route := range c.Routes {
+		if _, ok := c.Profiles[route.Profile]; route.Profile != "" && !ok {
+			return fmt.Errorf("route %s: unknown profile: %s", route.Name, route.Profile)
+		}
+		if err := c.validateBackends(route.Backends); err != nil {
+			return fmt.Errorf("route %s: %w", route.Name, err)
+		}
+		if _, ok := c.Schedules[route.Schedule]; route.Schedule != "" && !ok {
+			return fmt.Errorf("route %s: unknown schedule: %s", route.Name, route.Schedule)
+		}
+	}
+	return nil
+}
+
+// profile returns the sendfax profile for the route, or an empty profile
+// holding the defaults.
+func (c *Config) profile(route *Route) SendfaxProfile {
+	if route == nil {
+		return SendfaxProfile{}
+	}
+	return c.Profiles[route.Profile]
+}
+
+// validateBackends checks that all named relay backends exist and are configured.
+func (c *Config) validateBackends(backends []string) error {
+	for _, name := range backends {
+		switch name {
+		case BackendSendfax:
+		case BackendEmail:
+			if c.Email == nil {
+				return fmt.Errorf("backend %s requires an email section", name)
+			}
+		case BackendESL:
+			if c.ESL == nil {
+				return fmt.Errorf("backend %s requires an esl section", name)
+			}
+		case BackendHylaFAX:
+			if c.HylaFAX == nil {
+				return fmt.Errorf("backend %s requires a hylafax section", name)
+			}
+		default:
+			return fmt.Errorf("unknown backend: %s", name)
+		}
+	}
+	return nil
+}
+
+// backends returns the names of the relay backends used for the route.
+func (c *Config) backends(route *Route) []string {
+	if route != nil && len(route.Backends) > 0 {
+		return route.Backends
+	}
+	return c.Backends
+}
+
+// usesBackend reports whether any route, or the default, relays through the backend.
+func (c *Config) usesBackend(name string) bool {
+	for _, b := range c.Backends {
+		if b == name {
+			return true
+		}
+	}
+	for _, route := range c.Routes {
+		for _, b := range route.Backends {
+			if b == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// schedule returns the schedule restricting relays on the route, or nil if
+// relays may be dispatched at any time.
+func (c *Config) schedule(route *Route) *Schedule {
+	name := c.Schedule
+	if route != nil {
+		if route.Urgent {
+			return nil
+		}
+		if route.Schedule != "" {
+			name = route.Schedule
+		}
+	}
+	return c.Schedules[name]
+}
+
+// coversheet reports whether relays on the route get a coversheet.
+func (c *Config) coversheet(route *Route) bool {
+	if route != nil && route.Coversheet != nil {
+		return *route.Coversheet
+	}
+	return c.Coversheet.Enabled
+}
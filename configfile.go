@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"sigs.k8s.io/yaml"
+)
+
+// envReference matches ${VAR} references in config files.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${VAR} references with the value of the environment
+// variable. Other uses of $, like $1 in rewrite rules, are left alone.
+func expandEnv(data []byte) []byte {
+	return envReference.ReplaceAllFunc(data, func(ref []byte) []byte {
+		return []byte(os.Getenv(string(ref[2 : len(ref)-1])))
+	})
+}
+
+// configJSON converts a YAML (.yaml, .yml) or TOML (.toml) config to JSON,
+// so every format is read through the json tags of Config. Other files are
+// returned unchanged.
+func configJSON(filename string, data []byte) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return yaml.YAMLToJSON(data)
+	case ".toml":
+		var v map[string]any
+		if err := toml.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		return json.Marshal(v)
+	}
+	return data, nil
+}
+
+// Settings are option values by name, given as strings, numbers or booleans.
+type Settings map[string]settingValue
+
+type settingValue string
+
+// env returns the settings as environment variables.
+func (s Settings) env() map[string]string {
+	env := make(map[string]string, len(s))
+	for name, value := range s {
+		env[name] = string(value)
+	}
+	return env
+}
+
+// UnmarshalJSON accepts strings and number or boolean literals.
+func (v *settingValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = settingValue(s)
+		return nil
+	}
+	var literal any
+	if err := json.Unmarshal(data, &literal); err != nil {
+		return err
+	}
+	switch literal.(type) {
+	case float64, bool:
+		*v = settingValue(data)
+		return nil
+	}
+	return fmt.Errorf("expected a string, number or boolean, got %s", data)
+}
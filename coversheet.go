@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultCoversheet = `Relayed fax
+
+From:      {{.Cidnum}}{{if .Cidname}} ({{.Cidname}}){{end}}
+To:        {{.Destnum}}
+Received:  {{.Ts.Format "2006-01-02 15:04 MST"}}
+CommID:    {{.Commid}}
+Pages:     {{.Pages}} (not including this page)
+`
+
+// Coversheet configures the page prepended to relayed faxes.
+type Coversheet struct {
+	Enabled   bool   `json:"enabled"`
+	Template  string `json:"template,omitempty"`  // Go template over the XFRecord
+	Font      string `json:"font,omitempty"`      // ImageMagick font name (default: Courier)
+	PointSize int    `json:"pointsize,omitempty"` // Font size (default: 36)
+
+	tmpl *template.Template
+}
+
+// compile parses the coversheet template.
+func (c *Coversheet) compile() error {
+	text := c.Template
+	if text == "" {
+		text = defaultCoversheet
+	}
+	tmpl, err := template.New("coversheet").Parse(text)
+	if err != nil {
+		return fmt.Errorf("coversheet: %w", err)
+	}
+	c.tmpl = tmpl
+	if c.Font == "" {
+		c.Font = "Courier"
+	}
+	if c.PointSize == 0 {
+		c.PointSize = 36
+	}
+	return nil
+}
+
+// Prepend renders the coversheet for the record and writes it, followed by
+// all pages of the TIFF at path, into a temporary TIFF whose path is returned.
+func (c *Coversheet) Prepend(ctx context.Context, entry XFRecord, path string) (string, error) {
+	var text bytes.Buffer
+	if err := c.tmpl.Execute(&text, entry); err != nil {
+		return "", fmt.Errorf("error rendering coversheet: %w", err)
+	}
+	// ImageMagick expands escapes in annotation text
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `%%`).Replace(text.String())
+
+	base := filepath.Join(os.TempDir(), fmt.Sprintf("cover_%s_%d", entry.Commid, time.Now().UnixNano()))
+	coverPath, outPath := base+"_cover.tif", base+".tif"
+	defer os.Remove(coverPath)
+
+	// A fine resolution letter-sized fax page
+	cmd := exec.CommandContext(ctx, "convert",
+		"-size", "1728x2156",
+		"xc:white",
+		"-font", c.Font,
+		"-pointsize", strconv.Itoa(c.PointSize),
+		"-fill", "black",
+		"-annotate", "+120+200", escaped,
+		"-monochrome",
+		"-units", "PixelsPerInch",
+		"-density", "204x196",
+		"-compress", "Group4",
+		coverPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to render coversheet: %v, output: %s", err, string(output))
+	}
+
+	cmd = exec.CommandContext(ctx, "tiffcp", coverPath, path, outPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(outPath)
+		return "", fmt.Errorf("failed to prepend coversheet: %v, output: %s", err, string(output))
+	}
+	return outPath, nil
+}
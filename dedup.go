@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// seenFax is a fax remembered by the duplicate filter.
+type seenFax struct {
+	Commid string    `json:"commid"`
+	Seen   time.Time `json:"seen"`
+}
+
+// DuplicateFilter recognizes the same fax being received more than once
+// within a time window, by the hash of the image data of its pages together
+// with the sender and page count. Only faxes whose pages were received bit
+// for bit identical match, like the same document resent by a fax server
+// over a clean line; a rescanned paper original never does. The remembered
+// faxes are persisted to a file so duplicates are also caught across
+// restarts.
+type DuplicateFilter struct {
+	window time.Duration
+	file   string
+
+	mu   sync.Mutex
+	seen map[string]seenFax
+}
+
+// NewDuplicateFilter creates a duplicate filter persisting its state to file.
+// A window of zero disables the filter.
+func NewDuplicateFilter(window time.Duration, file string) (*DuplicateFilter, error) {
+	d := &DuplicateFilter{
+		window: window,
+		file:   file,
+		seen:   make(map[string]seenFax),
+	}
+	if window <= 0 {
+		return d, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &d.seen); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return d, nil
+}
+
+// Check hashes the pages of the TIFF at path and reports whether the fax duplicates one
+// received within the window, returning the commid of the original. Faxes
+// that are not duplicates are remembered.
+func (d *DuplicateFilter) Check(entry XFRecord, path string) (string, bool, error) {
+	if d.window <= 0 {
+		return "", false, nil
+	}
+
+	hash, err := hashTiffImages(path)
+	if err != nil {
+		return "", false, err
+	}
+	key := hash + "|" + entry.Cidnum + "|" + strconv.Itoa(int(entry.Pages))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for k, s := range d.seen {
+		if now.Sub(s.Seen) > d.window {
+			delete(d.seen, k)
+		}
+	}
+	if s, ok := d.seen[key]; ok && s.Commid != entry.Commid {
+		return s.Commid, true, nil
+	}
+
+	d.seen[key] = seenFax{Commid: entry.Commid, Seen: now}
+	data, err := json.Marshal(d.seen)
+	if err != nil {
+		return "", false, err
+	}
+	return "", false, writeFileAtomic(d.file, data, 0644)
+}
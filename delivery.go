@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deliveryExpiry is how long a submitted relay is tracked without a SEND record.
+const deliveryExpiry = 7 * 24 * time.Hour
+
+var sendfaxJobID = regexp.MustCompile(`request id is (\d+)`)
+
+// parseSendfaxJobID extracts the job ID from sendfax output.
+func parseSendfaxJobID(output string) string {
+	if m := sendfaxJobID.FindStringSubmatch(output); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// TrackedDelivery is a relay submitted to the local HylaFAX awaiting its SEND record.
+type TrackedDelivery struct {
+	Entry     XFRecord  `json:"entry"` // The received fax that was relayed
+	Jobid     string    `json:"jobid"`
+	Submitted time.Time `json:"submitted"`
+}
+
+// DeliveryTracker correlates the SEND records of relayed faxes with the
+// faxes they relay, so their actual delivery can be reported. Tracked
+// deliveries are persisted to a file to survive restarts.
+type DeliveryTracker struct {
+	file string
+
+	mu   sync.Mutex
+	jobs map[string]TrackedDelivery // By job ID
+}
+
+// NewDeliveryTracker creates a tracker persisting its state to file.
+func NewDeliveryTracker(file string) (*DeliveryTracker, error) {
+	t := &DeliveryTracker{
+		file: file,
+		jobs: make(map[string]TrackedDelivery),
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &t.jobs); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return t, nil
+}
+
+// Track registers a relay submitted as the given HylaFAX job.
+func (t *DeliveryTracker) Track(jobid string, entry XFRecord) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.jobs[jobid] = TrackedDelivery{Entry: entry, Jobid: jobid, Submitted: time.Now()}
+	return t.save()
+}
+
+// Match returns the tracked delivery a SEND record belongs to, by its job ID
+// or by the commid in its jobtag. Successful deliveries stop being tracked;
+// failed ones stay tracked as HylaFAX may still retry them.
+func (t *DeliveryTracker) Match(send XFRecord, tag string) (TrackedDelivery, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d, ok := t.jobs[send.Jobid]
+	if !ok && tag != "" && strings.HasPrefix(send.Jobtag, tag+":") {
+		commid := strings.TrimPrefix(send.Jobtag, tag+":")
+		for _, tracked := range t.jobs {
+			if tracked.Entry.Commid == commid {
+				d, ok = tracked, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return d, false, nil
+	}
+
+	if reasonOK(send.Reason) {
+		delete(t.jobs, d.Jobid)
+		return d, true, t.save()
+	}
+	return d, true, nil
+}
+
+// save expires stale deliveries and writes the state file. The caller must hold t.mu.
+func (t *DeliveryTracker) save() error {
+	for jobid, d := range t.jobs {
+		if time.Since(d.Submitted) > deliveryExpiry {
+			delete(t.jobs, jobid)
+		}
+	}
+	data, err := json.Marshal(t.jobs)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(t.file, data, 0644)
+}
+
+// reasonOK reports whether an xferfaxlog reason denotes success.
+func reasonOK(reason string) bool {
+	return reason == "" || reason == "OK"
+}
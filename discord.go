@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DiscordNotifier posts events as embeds to a Discord webhook, optionally
+// with a preview of the first page attached.
+type DiscordNotifier struct {
+	WebhookURL string      `json:"webhook_url"`
+	Username   string      `json:"username,omitempty"` // Overrides the webhook's name
+	Preview    bool        `json:"preview,omitempty"`  // Attach a first-page preview
+	Message    string      `json:"message,omitempty"`  // Go template over the event used as the embed's description instead of the default fields
+	Events     eventFilter `json:"events,omitempty"`
+
+	message *template.Template
+}
+
+// compile checks that the webhook is configured and parses the message
+// template.
+func (d *DiscordNotifier) compile() error {
+	if d.WebhookURL == "" {
+		return fmt.Errorf("discord: webhook_url is required")
+	}
+	var err error
+	d.message, err = parseNotifyTemplate("discord message", d.Message)
+	return err
+}
+
+// Notify posts the event to the webhook.
+func (d *DiscordNotifier) Notify(ctx context.Context, event Event) error {
+	if !d.Events.accepts(event.Type) {
+		return nil
+	}
+	err := d.post(ctx, event)
+	countPush("notify_discord", err)
+	if err != nil {
+		sinkDropped.WithLabelValues("notify_discord").Inc()
+	}
+	return err
+}
+
+func (d *DiscordNotifier) post(ctx context.Context, event Event) error {
+	var fields []any
+	for _, f := range eventDetails(event) {
+		// Discord rejects embeds with empty or overlong field values
+		value := f[1]
+		if value == "" {
+			value = "-"
+		}
+		fields = append(fields, map[string]any{"name": f[0], "value": truncate(value, 1024), "inline": len(value) < 40})
+	}
+	color := 0x5865f2
+	switch event.Type {
+	case EventRelayFailed, EventDeliveryFailed, EventQuarantined:
+		color = 0xed4245
+	case EventDeliveryConfirmed:
+		color = 0x57f287
+	}
+	embed := map[string]any{
+		"title":     truncate(eventSummary(event), 256),
+		"color":     color,
+		"fields":    fields,
+		"timestamp": event.Time.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if d.message != nil {
+		text, err := renderEvent(d.message, event)
+		if err != nil {
+			return err
+		}
+		delete(embed, "fields")
+		embed["description"] = truncate(text, 4096)
+	}
+
+	var png []byte
+	if d.Preview && event.path != "" {
+		var err error
+		if png, err = renderPreview(event.path); err != nil {
+			log.WithFields(event.Fields()).Warnf("Error rendering preview for Discord: %s", err)
+		} else {
+			embed["image"] = map[string]string{"url": "attachment://fax.png"}
+		}
+	}
+
+	msg := map[string]any{"embeds": []any{embed}}
+	if d.Username != "" {
+		msg["username"] = d.Username
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error marshaling json: %w", err)
+	}
+
+	body := bytes.NewBuffer(payload)
+	contentType := "application/json"
+	if png != nil {
+		body = &bytes.Buffer{}
+		w := multipart.NewWriter(body)
+		if err := w.WriteField("payload_json", string(payload)); err != nil {
+			return err
+		}
+		part, err := w.CreateFormFile("files[0]", "fax.png")
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(png); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		contentType = w.FormDataContentType()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", d.WebhookURL, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+	return nil
+}
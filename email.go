@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultEmailSubject = `Fax from {{.Cidnum}}{{if .Cidname}} ({{.Cidname}}){{end}} to {{.Destnum}}`
+	defaultEmailBody    = `You have received a {{.Pages}} page fax from {{.Cidnum}}{{if .Cidname}} ({{.Cidname}}){{end}}
+to {{.Destnum}} at {{.Ts.Format "2006-01-02 15:04 MST"}}.
+
+The document is attached as PDF.
+`
+)
+
+// EmailDelivery configures the fax-to-email relay backend.
+type EmailDelivery struct {
+	Server     string              `json:"server"` // SMTP server as host:port
+	From       string              `json:"from"`
+	Username   string              `json:"username,omitempty"`
+	Password   string              `json:"password,omitempty"`
+	Recipients map[string][]string `json:"recipients,omitempty"` // Recipients per destination DID
+	Default    []string            `json:"default,omitempty"`    // Recipients for DIDs not in Recipients
+	Subject    string              `json:"subject,omitempty"`    // Go template over the XFRecord
+	Body       string              `json:"body,omitempty"`       // Go template over the XFRecord
+
+	subject *template.Template
+	body    *template.Template
+}
+
+// compile parses the subject and body templates.
+func (e *EmailDelivery) compile() error {
+	subject, body := e.Subject, e.Body
+	if subject == "" {
+		subject = defaultEmailSubject
+	}
+	if body == "" {
+		body = defaultEmailBody
+	}
+
+	var err error
+	if e.subject, err = template.New("subject").Parse(subject); err != nil {
+		return fmt.Errorf("email subject: %w", err)
+	}
+	if e.body, err = template.New("body").Parse(body); err != nil {
+		return fmt.Errorf("email body: %w", err)
+	}
+	return nil
+}
+
+// recipients returns the addresses faxes to the DID are mailed to.
+func (e *EmailDelivery) recipients(did string) []string {
+	if to, ok := e.Recipients[did]; ok {
+		return to
+	}
+	return e.Default
+}
+
+// EmailBackend relays faxes by converting them to PDF and mailing them.
+type EmailBackend struct{}
+
+// Deliver mails the fax as PDF to the recipients of its destination DID.
+func (b *EmailBackend) Deliver(ctx context.Context, job *RelayJob, path string, route *Route, cfg *Config) (string, error) {
+	e := cfg.Email
+	if e == nil {
+		return "", fmt.Errorf("email delivery is not configured")
+	}
+	to := e.recipients(job.Entry.Destnum)
+	if len(to) == 0 {
+		return "", fmt.Errorf("no email recipients for %s", job.Entry.Destnum)
+	}
+
+	pdfPath, err := convertTiffToPdf(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := os.Remove(pdfPath); err != nil {
+			log.Error(err)
+		}
+	}()
+	pdf, err := os.ReadFile(pdfPath)
+	if err != nil {
+		return "", err
+	}
+
+	var subject, body bytes.Buffer
+	if err := e.subject.Execute(&subject, job.Entry); err != nil {
+		return "", fmt.Errorf("error rendering email subject: %w", err)
+	}
+	if err := e.body.Execute(&body, job.Entry); err != nil {
+		return "", fmt.Errorf("error rendering email body: %w", err)
+	}
+
+	name := fmt.Sprintf("fax_%s_%s.pdf", job.Entry.Commid, job.Entry.Cidnum)
+	msg, err := buildMail(e.From, to, subject.String(), body.String(), name, "application/pdf", pdf)
+	if err != nil {
+		return "", err
+	}
+
+	if err := sendMail(ctx, e.Server, smtpAuth(e.Server, e.Username, e.Password), e.From, to, msg); err != nil {
+		return "", fmt.Errorf("error sending email: %w", err)
+	}
+	return "mailed to " + strings.Join(to, ", "), nil
+}
+
+// sendMail is smtp.SendMail, aborted once ctx is done.
+func sendMail(ctx context.Context, server string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	conn, err := dialContext(ctx, server)
+	if err != nil {
+		return err
+	}
+	host, _, _ := net.SplitHostPort(server)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// smtpAuth returns PLAIN auth for the server, or nil if no username is set.
+func smtpAuth(server, username, password string) smtp.Auth {
+	if username == "" {
+		return nil
+	}
+	host := server
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	return smtp.PlainAuth("", username, password, host)
+}
+
+// encodeSubject returns subject as an RFC 2047 header value. Control
+// characters, like line breaks in a caller name, become spaces so they
+// can't inject headers.
+func encodeSubject(subject string) string {
+	subject = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, subject)
+	return mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject), " "))
+}
+
+// buildMail assembles a MIME message with a text body and an attachment.
+func buildMail(from string, to []string, subject, body, attachmentName, attachmentType string, attachment []byte) ([]byte, error) {
+	var msg bytes.Buffer
+	writer := multipart.NewWriter(&msg)
+
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", encodeSubject(subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+
+	part, err = writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {attachmentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", attachmentName)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(attachment)
+	for len(encoded) > 76 {
+		if _, err := part.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return nil, err
+		}
+		encoded = encoded[76:]
+	}
+	if _, err := part.Write([]byte(encoded + "\r\n")); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// convertTiffToPdf converts all pages of a TIFF into a temporary PDF and returns its path.
+func convertTiffToPdf(ctx context.Context, inputPath string) (string, error) {
+	if _, err := os.Stat(inputPath); os.IsNotExist(err) {
+		return "", fmt.Errorf("TIFF file does not exist: %s", inputPath)
+	}
+
+	pdfPath := filepath.Join(os.TempDir(), fmt.Sprintf("fax_%d.pdf", time.Now().UnixNano()))
+	cmd := exec.CommandContext(ctx, "convert", inputPath, pdfPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to convert TIFF to PDF: %v, output: %s", err, string(output))
+	}
+	return pdfPath, nil
+}
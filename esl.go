@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ESLDelivery configures the FreeSWITCH event socket relay backend.
+type ESLDelivery struct {
+	Address   string            `json:"address"`             // Event socket address (default: 127.0.0.1:8021)
+	Password  string            `json:"password"`            // Event socket password (default: ClueCon)
+	Gateway   string            `json:"gateway"`             // Sofia gateway to originate through, unless the route sets one
+	Ident     string            `json:"ident,omitempty"`     // Fax station identifier (default: caller ID number)
+	Header    string            `json:"header,omitempty"`    // Fax page header
+	T38       *bool             `json:"t38,omitempty"`       // Request T.38 (default: true)
+	Timeout   Duration          `json:"timeout,omitempty"`   // Maximum time for one transmission (default: 30m)
+	Variables map[string]string `json:"variables,omitempty"` // Extra channel variables
+}
+
+// compile fills in defaults.
+func (e *ESLDelivery) compile() error {
+	if e.Address == "" {
+		e.Address = "127.0.0.1:8021"
+	}
+	if e.Password == "" {
+		e.Password = "ClueCon"
+	}
+	if e.Timeout.Duration == 0 {
+		e.Timeout.Duration = 30 * time.Minute
+	}
+	if e.Gateway == "" {
+		return fmt.Errorf("esl: gateway is required")
+	}
+	if !eslName.MatchString(e.Gateway) {
+		return fmt.Errorf("esl: invalid gateway %q", e.Gateway)
+	}
+	for k := range e.Variables {
+		if !eslName.MatchString(k) {
+			return fmt.Errorf("esl: invalid channel variable name %q", k)
+		}
+	}
+	return nil
+}
+
+var (
+	// eslNumber matches numbers that are safe to dial and to set as caller ID
+	eslNumber = regexp.MustCompile(`^\+?[0-9]+$`)
+	// eslName matches gateway and channel variable names
+	eslName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// eslQuote quotes a channel variable value. Quotes, braces and control
+// characters can't be escaped in an originate string and are removed.
+func eslQuote(v string) string {
+	v = strings.Map(func(r rune) rune {
+		if r == '\'' || r == '{' || r == '}' || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, v)
+	return "'" + v + "'"
+}
+
+// ESLBackend relays faxes by originating a T.38 call with txfax through the
+// FreeSWITCH event socket, bypassing HylaFAX.
+type ESLBackend struct{}
+
+// Deliver transmits the fax and waits for the txfax result.
+func (b *ESLBackend) Deliver(ctx context.Context, job *RelayJob, path string, route *Route, cfg *Config) (string, error) {
+	e := cfg.ESL
+	if e == nil {
+		return "", fmt.Errorf("esl delivery is not configured")
+	}
+
+	gateway := e.Gateway
+	if route != nil && route.Gateway != "" {
+		gateway = route.Gateway
+	}
+	if !eslName.MatchString(gateway) {
+		return "", fmt.Errorf("invalid gateway %q", gateway)
+	}
+	if !eslNumber.MatchString(job.Entry.Destnum) {
+		return "", fmt.Errorf("invalid destination number %q", job.Entry.Destnum)
+	}
+
+	conn, err := dialESL(ctx, e.Address, e.Password)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	uuid, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+
+	// Only receive events for our call and background job
+	if _, err := conn.command("event plain BACKGROUND_JOB CHANNEL_HANGUP_COMPLETE CUSTOM spandsp::txfaxresult spandsp::txfaxpageresult"); err != nil {
+		return "", err
+	}
+	if _, err := conn.command("filter Unique-ID " + uuid); err != nil {
+		return "", err
+	}
+	if _, err := conn.command("filter Job-UUID " + uuid); err != nil {
+		return "", err
+	}
+
+	originate := fmt.Sprintf("bgapi originate %s%s &txfax(%s)\nJob-UUID: %s",
+		e.channelVariables(job.Entry, uuid), "sofia/gateway/"+gateway+"/"+job.Entry.Destnum, path, uuid)
+	if _, err := conn.command(originate); err != nil {
+		return "", err
+	}
+	log.Infof("Originated ESL fax call %s for %s via %s", uuid, job.Entry.Commid, gateway)
+
+	conn.conn.SetDeadline(time.Now().Add(e.Timeout.Duration))
+	output, err := waitESLResult(conn, uuid)
+	if err != nil {
+		// A call left up keeps transmitting while the retry sends the fax again
+		killESLCall(e, uuid)
+	}
+	return output, err
+}
+
+// waitESLResult reads the events of the call until its fax result or hangup.
+func waitESLResult(conn *eslConn, uuid string) (string, error) {
+	var pages string
+	for {
+		hdr, body, err := conn.read()
+		if err != nil {
+			return "", fmt.Errorf("error waiting for fax result: %w", err)
+		}
+		if hdr["Content-Type"] != "text/event-plain" {
+			continue
+		}
+		event := parseESLEvent(body)
+
+		switch {
+		case event["Event-Name"] == "BACKGROUND_JOB":
+			if result := strings.TrimSpace(event["_body"]); strings.HasPrefix(result, "-ERR") {
+				return result, fmt.Errorf("originate failed: %s", result)
+			}
+		case event["Event-Subclass"] == "spandsp::txfaxpageresult":
+			pages = event["fax-document-transferred-pages"]
+			log.Infof("ESL fax call %s: page %s sent", uuid, pages)
+		case event["Event-Subclass"] == "spandsp::txfaxresult":
+			output := fmt.Sprintf("fax result %s: %s (%s pages)", event["fax-result-code"],
+				event["fax-result-text"], event["fax-document-transferred-pages"])
+			log.Infof("ESL fax call %s: %s", uuid, output)
+			if event["fax-success"] != "1" {
+				return output, fmt.Errorf("txfax failed: %s", event["fax-result-text"])
+			}
+			return output, nil
+		case event["Event-Name"] == "CHANNEL_HANGUP_COMPLETE":
+			output := "hangup: " + event["Hangup-Cause"]
+			if pages != "" {
+				output += " after " + pages + " pages"
+			}
+			return output, fmt.Errorf("call ended without fax result: %s", event["Hangup-Cause"])
+		}
+	}
+}
+
+// killESLCall hangs up the call over a new connection, as the one waiting
+// for its result may be canceled or past its deadline.
+func killESLCall(e *ESLDelivery, uuid string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := dialESL(ctx, e.Address, e.Password)
+	if err != nil {
+		log.Errorf("Error hanging up ESL fax call %s: %s", uuid, err)
+		return
+	}
+	defer conn.Close()
+
+	conn.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	result, err := conn.api("uuid_kill " + uuid)
+	if err != nil {
+		log.Errorf("Error hanging up ESL fax call %s: %s", uuid, err)
+		return
+	}
+	// The call may have ended already
+	log.Infof("Hung up ESL fax call %s: %s", uuid, result)
+}
+
+// channelVariables returns the originate variable block for the call.
+func (e *ESLDelivery) channelVariables(entry XFRecord, uuid string) string {
+	ident := e.Ident
+	if ident == "" {
+		ident = entry.Cidnum
+	}
+	t38 := e.T38 == nil || *e.T38
+
+	vars := []string{
+		"origination_uuid=" + uuid,
+		"origination_caller_id_name=" + eslQuote(entry.Cidname),
+		"fax_ident=" + eslQuote(ident),
+		"fax_verbose=true",
+		"fax_use_ecm=true",
+		"fax_enable_t38=" + strconv.FormatBool(t38),
+		"fax_enable_t38_request=" + strconv.FormatBool(t38),
+		"ignore_early_media=true",
+	}
+	// Withheld or malformed caller IDs are sent without a number
+	if eslNumber.MatchString(entry.Cidnum) {
+		vars = append(vars, "origination_caller_id_number="+entry.Cidnum)
+	}
+	if e.Header != "" {
+		vars = append(vars, "fax_header="+eslQuote(e.Header))
+	}
+	for k, v := range e.Variables {
+		vars = append(vars, k+"="+eslQuote(v))
+	}
+	return "{" + strings.Join(vars, ",") + "}"
+}
+
+// eslConn is a connection to the FreeSWITCH event socket.
+type eslConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialESL connects and authenticates to the event socket.
+func dialESL(ctx context.Context, address, password string) (*eslConn, error) {
+	conn, err := dialContext(ctx, address)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to event socket: %w", err)
+	}
+	c := &eslConn{conn: conn, r: bufio.NewReader(conn)}
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	hdr, _, err := c.read()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if hdr["Content-Type"] != "auth/request" {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected event socket greeting: %s", hdr["Content-Type"])
+	}
+	if _, err := c.command("auth " + password); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the connection.
+func (c *eslConn) Close() error {
+	return c.conn.Close()
+}
+
+// command sends a command and waits for its reply, skipping any events.
+func (c *eslConn) command(cmd string) (map[string]string, error) {
+	if _, err := fmt.Fprintf(c.conn, "%s\n\n", cmd); err != nil {
+		return nil, err
+	}
+	for {
+		hdr, _, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if hdr["Content-Type"] != "command/reply" {
+			continue
+		}
+		if reply := hdr["Reply-Text"]; strings.HasPrefix(reply, "-ERR") {
+			return hdr, fmt.Errorf("event socket: %s", reply)
+		}
+		return hdr, nil
+	}
+}
+
+// api runs an API command and returns its result, skipping any events.
+func (c *eslConn) api(cmd string) (string, error) {
+	if _, err := fmt.Fprintf(c.conn, "api %s\n\n", cmd); err != nil {
+		return "", err
+	}
+	for {
+		hdr, body, err := c.read()
+		if err != nil {
+			return "", err
+		}
+		if hdr["Content-Type"] == "api/response" {
+			return strings.TrimSpace(string(body)), nil
+		}
+	}
+}
+
+// read reads one message with its headers and body.
+func (c *eslConn) read() (map[string]string, []byte, error) {
+	hdr := make(map[string]string)
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if len(hdr) == 0 {
+				continue
+			}
+			break
+		}
+		if k, v, ok := strings.Cut(line, ": "); ok {
+			hdr[k] = v
+		}
+	}
+
+	var body []byte
+	if n, err := strconv.Atoi(hdr["Content-Length"]); err == nil && n > 0 {
+		body = make([]byte, n)
+		if _, err := io.ReadFull(c.r, body); err != nil {
+			return nil, nil, err
+		}
+	}
+	return hdr, body, nil
+}
+
+// parseESLEvent parses a plain event body. Any content following the
+// event headers is returned under the "_body" key.
+func parseESLEvent(body []byte) map[string]string {
+	event := make(map[string]string)
+	text := string(body)
+	headers, content, _ := strings.Cut(text, "\n\n")
+	for _, line := range strings.Split(headers, "\n") {
+		if k, v, ok := strings.Cut(line, ": "); ok {
+			if unescaped, err := url.QueryUnescape(v); err == nil {
+				v = unescaped
+			}
+			event[k] = v
+		}
+	}
+	event["_body"] = content
+	return event
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Event types emitted by the bridge.
+const (
+	EventReceived            = "fax_received"
+	EventRelayFailed         = "relay_failed"
+	EventDuplicateSuppressed = "duplicate_suppressed"
+	EventLoopSuppressed      = "loop_suppressed"
+	EventQuarantined         = "quarantined"
+	EventDeliveryConfirmed   = "delivery_confirmed"
+	EventDeliveryFailed      = "delivery_failed"
+)
+
+// Event is a structured notification about the outcome of a relay.
+type Event struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	Commid     string    `json:"commid"`
+	Cidnum     string    `json:"cidnum,omitempty"`
+	Cidname    string    `json:"cidname,omitempty"`
+	Destnum    string    `json:"destnum,omitempty"`
+	Attempts   int       `json:"attempts,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Output     string    `json:"output,omitempty"`      // sendfax output of the last attempt
+	Jobid      string    `json:"jobid,omitempty"`       // HylaFAX job of the relayed fax
+	Reason     string    `json:"reason,omitempty"`      // Downstream reason from the SEND record
+	ReasonCode string    `json:"reason_code,omitempty"` // Stable code of Reason, e.g. NO_CARRIER
+	ReasonType string    `json:"reason_type,omitempty"` // retryable or permanent for failed deliveries
+	Cost       *Cost     `json:"cost,omitempty"`        // Rated cost of the record
+	Record     XFRecord  `json:"record"`
+
+	path string // TIFF of the fax, for previews
+}
+
+// newEvent creates an event of the given type for a relay job.
+func newEvent(eventType string, job *RelayJob) Event {
+	return Event{
+		Type:     eventType,
+		Time:     time.Now(),
+		Commid:   job.Entry.Commid,
+		Cidnum:   job.Entry.Cidnum,
+		Cidname:  job.Entry.Cidname,
+		Destnum:  job.Entry.Destnum,
+		Attempts: job.Attempts,
+		Error:    job.LastError,
+		Output:   job.LastOutput,
+		Record:   job.Entry,
+		path:     job.Path,
+	}
+}
+
+// Fields returns the event as logrus fields.
+func (e Event) Fields() log.Fields {
+	return log.Fields{
+		"event":    e.Type,
+		"commid":   e.Commid,
+		"cidnum":   e.Cidnum,
+		"destnum":  e.Destnum,
+		"filename": e.Record.Filename,
+		"attempts": e.Attempts,
+	}
+}
+
+// hub passes messages to subscribers like API streams.
+type hub[T any] struct {
+	name string // What is passed, for logging
+	mu   sync.Mutex
+	subs map[chan T]bool
+}
+
+func newHub[T any](name string) *hub[T] {
+	return &hub[T]{name: name, subs: make(map[chan T]bool)}
+}
+
+// eventBus passes the events the bridge emits, recordBus the records it
+// pushes to the sinks.
+var (
+	eventBus  = newHub[Event]("event")
+	recordBus = newHub[XFRecord]("record")
+)
+
+// subscribe returns a channel receiving messages from now on, and a
+// function ending the subscription.
+func (h *hub[T]) subscribe() (<-chan T, func()) {
+	ch := make(chan T, 100)
+	h.mu.Lock()
+	h.subs[ch] = true
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs, ch)
+		h.mu.Unlock()
+	}
+}
+
+// publish passes a message to all subscribers. Subscribers that fall behind
+// miss it, so they can't hold up relaying.
+func (h *hub[T]) publish(msg T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- msg:
+		default:
+			log.Warnf("Subscriber falls behind, dropping %s", h.name)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterSink("file", newFileSink)
+}
+
+// FileSink appends every record as a JSON line to a local file, which is
+// rotated by size and age. Rotated files are optionally gzipped.
+type FileSink struct {
+	Path       string   `json:"path"`        // Default: <logDir>/<name>.ndjson
+	MaxSizeMB  int      `json:"max_size_mb"` // Rotate once the file reaches this size (default: 100, 0 disables)
+	MaxAge     Duration `json:"max_age"`     // Rotate once the file is this old (0 disables)
+	Compress   *bool    `json:"compress"`    // Gzip rotated files (default: true)
+	MaxBackups int      `json:"max_backups"` // Rotated files to keep (0 keeps all)
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func newFileSink(raw json.RawMessage, env SinkEnv) (Sink, error) {
+	return openFileSink(raw, filepath.Join(env.LogDir, env.Name+".ndjson"))
+}
+
+// openFileSink creates a file sink from its options, writing to
+// defaultPath unless they set a path.
+func openFileSink(raw json.RawMessage, defaultPath string) (*FileSink, error) {
+	s := &FileSink{MaxSizeMB: 100}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	if s.Path == "" {
+		s.Path = defaultPath
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating directory: %w", err)
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the current file for appending.
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", s.Path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.size, s.opened = f, info.Size(), info.ModTime()
+	if s.size == 0 {
+		s.opened = time.Now()
+	}
+	return nil
+}
+
+// Push appends the record and syncs the file.
+func (s *FileSink) Push(ctx context.Context, record XFRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling json: %w", err)
+	}
+	return s.write(append(line, '\n'), nil)
+}
+
+// write appends a line, rotating the file first if it is due, and syncs
+// the file. header is written first to new files.
+func (s *FileSink) write(line, header []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.due(int64(len(line))) {
+		if err := s.rotate(); err != nil {
+			log.Errorf("Error rotating %s: %s", s.Path, err)
+		}
+	}
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	if s.size == 0 && len(header) > 0 {
+		line = append(append([]byte{}, header...), line...)
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", s.Path, err)
+	}
+	return s.file.Sync()
+}
+
+// due reports whether the file has to be rotated before writing n bytes.
+func (s *FileSink) due(n int64) bool {
+	if s.size == 0 {
+		return false
+	}
+	if s.MaxSizeMB > 0 && s.size+n > int64(s.MaxSizeMB)<<20 {
+		return true
+	}
+	return s.MaxAge.Duration > 0 && time.Since(s.opened) >= s.MaxAge.Duration
+}
+
+// Close closes the current file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// rotate moves the current file aside and compresses it in the background.
+func (s *FileSink) rotate() error {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+
+	ext := filepath.Ext(s.Path)
+	rotated := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(s.Path, ext), time.Now().Format("20060102T150405"), ext)
+	if err := os.Rename(s.Path, rotated); err != nil {
+		return err
+	}
+
+	go func() {
+		if s.Compress == nil || *s.Compress {
+			if err := gzipFile(rotated); err != nil {
+				log.Errorf("Error compressing %s: %s", rotated, err)
+			}
+		}
+		s.prune()
+	}()
+	return nil
+}
+
+// prune removes the oldest rotated files beyond MaxBackups.
+func (s *FileSink) prune() {
+	if s.MaxBackups <= 0 {
+		return
+	}
+	ext := filepath.Ext(s.Path)
+	files, err := filepath.Glob(strings.TrimSuffix(s.Path, ext) + "-*" + ext + "*")
+	if err != nil || len(files) <= s.MaxBackups {
+		return
+	}
+	sort.Strings(files)
+	for _, f := range files[:len(files)-s.MaxBackups] {
+		if err := os.Remove(f); err != nil {
+			log.Errorf("Error removing old record file: %s", err)
+		}
+	}
+}
+
+// gzipFile compresses a file to name.gz and removes the original.
+func gzipFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(name + ".gz.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(out.Name(), name+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// NumberList matches phone numbers exactly, by prefix or by regexp.
+type NumberList struct {
+	Numbers  []string `json:"numbers,omitempty"`
+	Prefixes []string `json:"prefixes,omitempty"`
+	Patterns []string `json:"patterns,omitempty"`
+
+	res []*regexp.Regexp
+}
+
+// compile compiles the list's patterns.
+func (l *NumberList) compile() error {
+	l.res = nil
+	for _, pattern := range l.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		l.res = append(l.res, re)
+	}
+	return nil
+}
+
+// empty reports whether the list has no entries.
+func (l *NumberList) empty() bool {
+	return len(l.Numbers) == 0 && len(l.Prefixes) == 0 && len(l.Patterns) == 0
+}
+
+// Contains reports whether the number matches any entry of the list.
+func (l *NumberList) Contains(number string) bool {
+	for _, n := range l.Numbers {
+		if n == number {
+			return true
+		}
+	}
+	for _, prefix := range l.Prefixes {
+		if strings.HasPrefix(number, prefix) {
+			return true
+		}
+	}
+	for _, re := range l.res {
+		if re.MatchString(number) {
+			return true
+		}
+	}
+	return false
+}
+
+// RelayFilter decides which received faxes are relayed, by the DID they were
+// received on. Denied DIDs are never relayed; if the allow list is not empty
+// only DIDs on it are relayed.
+type RelayFilter struct {
+	Allow NumberList `json:"allow"`
+	Deny  NumberList `json:"deny"`
+}
+
+// compile compiles the filter's patterns.
+func (f *RelayFilter) compile() error {
+	if err := f.Allow.compile(); err != nil {
+		return fmt.Errorf("filter allow: %w", err)
+	}
+	if err := f.Deny.compile(); err != nil {
+		return fmt.Errorf("filter deny: %w", err)
+	}
+	return nil
+}
+
+// Allows reports whether a fax received on the DID should be relayed.
+func (f *RelayFilter) Allows(did string) bool {
+	if f.Deny.Contains(did) {
+		return false
+	}
+	return f.Allow.empty() || f.Allow.Contains(did)
+}
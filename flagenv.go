@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// flagEnvPrefix is prepended to the upper snake case name of a flag to get
+// the environment variable overriding it, e.g. GOFAXIP_LOKI_URL for -lokiURL.
+const flagEnvPrefix = "GOFAXIP_"
+
+func flagEnv(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return flagEnvPrefix + b.String()
+}
+
+// setFlags returns the flags given on the command line or set since.
+func setFlags() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// applyFlagEnv sets the flags not given on the command line from their
+// environment variables.
+func applyFlagEnv() error {
+	set := setFlags()
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(flagEnv(f.Name))
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+		if serr := flag.Set(f.Name, value); serr != nil {
+			err = fmt.Errorf("%s: %w", flagEnv(f.Name), serr)
+		}
+	})
+	return err
+}
+
+// applyConfigFlags sets the flags neither given on the command line nor in
+// the environment from the flags section of the config file.
+func applyConfigFlags(values Settings) error {
+	set := setFlags()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if flag.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("flags: unknown flag %s", name)
+		}
+		if set[name] {
+			continue
+		}
+		if err := flag.Set(name, string(values[name])); err != nil {
+			return fmt.Errorf("flags: %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// secretFiles are the files the values of secret flags are read from, by
+// flag name.
+var secretFiles = make(map[string]*string)
+
+// secretFileFlag defines a <name>File flag reading the value of the secret
+// flag name from a file, so it does not show in the process arguments.
+func secretFileFlag(name string) {
+	file := new(string)
+	secretFiles[name] = file
+	flag.StringVar(file, name+"File", "", "File holding the value of -"+name+" (takes precedence over it)")
+}
+
+// applySecretFiles sets secret flags from the files given for them.
+func applySecretFiles() error {
+	for name, file := range secretFiles {
+		if *file == "" {
+			continue
+		}
+		value, err := readSecretFile(*file)
+		if err != nil {
+			return fmt.Errorf("%sFile: %w", name, err)
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("%sFile: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+func init() {
+	RegisterSink("gcp_logging", newGCPLoggingSink)
+}
+
+const gcpLoggingWriteURL = "https://logging.googleapis.com/v2/entries:write"
+
+// GCPLoggingSink writes records as structured entries through the Cloud
+// Logging API. It authenticates with a service account key file or the
+// application default credentials.
+type GCPLoggingSink struct {
+	Project         string            `json:"project"`
+	LogName         string            `json:"log_name,omitempty"`         // Default: xferfaxlog
+	CredentialsFile string            `json:"credentials_file,omitempty"` // Service account key; default: application default credentials
+	ResourceType    string            `json:"resource_type,omitempty"`    // Monitored resource type (default: global)
+	ResourceLabels  map[string]string `json:"resource_labels,omitempty"`  // e.g. {"instance_id": "...", "zone": "..."}
+	Labels          map[string]string `json:"labels,omitempty"`           // Added to every entry
+	BatchOptions
+
+	client *http.Client
+	*recordBatcher
+}
+
+type gcpLogEntry struct {
+	Timestamp   string            `json:"timestamp"`
+	Severity    string            `json:"severity"`
+	InsertID    string            `json:"insertId,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	JSONPayload XFRecord          `json:"jsonPayload"`
+}
+
+type gcpWriteRequest struct {
+	LogName  string `json:"logName"`
+	Resource struct {
+		Type   string            `json:"type"`
+		Labels map[string]string `json:"labels,omitempty"`
+	} `json:"resource"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Entries []gcpLogEntry     `json:"entries"`
+}
+
+func newGCPLoggingSink(raw json.RawMessage, env SinkEnv) (Sink, error) {
+	s := &GCPLoggingSink{LogName: "xferfaxlog", ResourceType: "global"}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
+	scope := "https://www.googleapis.com/auth/logging.write"
+	var creds *google.Credentials
+	var err error
+	if s.CredentialsFile != "" {
+		var key []byte
+		if key, err = os.ReadFile(s.CredentialsFile); err != nil {
+			return nil, fmt.Errorf("error reading credentials: %w", err)
+		}
+		creds, err = google.CredentialsFromJSON(ctx, key, scope)
+	} else {
+		creds, err = google.FindDefaultCredentials(ctx, scope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading credentials: %w", err)
+	}
+	if s.Project == "" {
+		s.Project = creds.ProjectID
+	}
+	if s.Project == "" {
+		return nil, fmt.Errorf("project is required")
+	}
+
+	s.client = oauth2.NewClient(ctx, creds.TokenSource)
+	s.client.Timeout = httpClient.Timeout
+	s.recordBatcher = startBatcher(env.Name, s.BatchOptions, s.write)
+	return s, nil
+}
+
+// write sends a batch of records as log entries.
+func (s *GCPLoggingSink) write(ctx context.Context, records []XFRecord) error {
+	req := gcpWriteRequest{
+		LogName: fmt.Sprintf("projects/%s/logs/%s", s.Project, url.PathEscape(s.LogName)),
+		Labels:  s.Labels,
+	}
+	req.Resource.Type = s.ResourceType
+	req.Resource.Labels = s.ResourceLabels
+	for _, r := range records {
+		severity := "INFO"
+		if !reasonOK(r.Reason) {
+			severity = "WARNING"
+		}
+		ts := r.Ts
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		req.Entries = append(req.Entries, gcpLogEntry{
+			Timestamp:   ts.UTC().Format(time.RFC3339Nano),
+			Severity:    severity,
+			InsertID:    string(r.Direction) + "-" + recordKey(r),
+			Labels:      map[string]string{"direction": string(r.Direction), "modem": r.Modem},
+			JSONPayload: r,
+		})
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("error marshaling json: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", gcpLoggingWriteURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("error writing log entries: %w", err)
+	}
+	defer resp.Body.Close()
+	responseBody, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(responseBody))}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/sagostin/gofaxip-bridge/pkg/faxbridgepb"
+)
+
+// grpcServer implements the FaxBridge gRPC service over the API's records
+// and the emitted events.
+type grpcServer struct {
+	pb.UnimplementedFaxBridgeServer
+	api *API
+}
+
+// serveGRPC serves the gRPC API on lis.
+func serveGRPC(lis net.Listener, api *API) {
+	opts := api.Access.ServerOptions()
+	if api.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(api.TLS)))
+	}
+	server := grpc.NewServer(opts...)
+	pb.RegisterFaxBridgeServer(server, &grpcServer{api: api})
+	log.Infof("Serving the gRPC API on %s", lis.Addr())
+	log.Fatal(server.Serve(lis))
+}
+
+// WatchFaxEvents streams events until the client goes away.
+func (s *grpcServer) WatchFaxEvents(req *pb.WatchFaxEventsRequest, stream pb.FaxBridge_WatchFaxEventsServer) error {
+	types := make(map[string]bool, len(req.Types))
+	for _, t := range req.Types {
+		types[t] = true
+	}
+
+	ch, cancel := eventBus.subscribe()
+	defer cancel()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-ch:
+			if len(types) > 0 && !types[event.Type] {
+				continue
+			}
+			if err := stream.Send(eventProto(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ListFaxes returns a page of stored records.
+func (s *grpcServer) ListFaxes(ctx context.Context, req *pb.ListFaxesRequest) (*pb.ListFaxesResponse, error) {
+	q := RecordQuery{
+		Direction: XFDirection(req.Direction),
+		Number:    req.Number,
+		Page:      int(req.Page),
+		PerPage:   int(req.PerPage),
+	}
+	switch q.Direction {
+	case "", XflRECV, XflSEND, XflJOB:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid direction %q, expected RECV, SEND or JOB", req.Direction)
+	}
+	if req.Since != nil {
+		q.Since = req.Since.AsTime()
+	}
+	if req.Until != nil {
+		q.Until = req.Until.AsTime()
+	}
+	if q.Page == 0 {
+		q.Page = 1
+	}
+	if q.PerPage == 0 {
+		q.PerPage = defaultPerPage
+	}
+	if q.Page < 0 || q.PerPage < 0 || q.PerPage > maxPerPage {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid page or per_page, expected per_page of 1 to %d", maxPerPage)
+	}
+
+	page, err := s.query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.ListFaxesResponse{Page: int32(page.Page), PerPage: int32(page.PerPage), Total: int32(page.Total)}
+	for _, raw := range page.Records {
+		record, err := recordFromJSON(raw)
+		if err != nil {
+			return nil, err
+		}
+		resp.Faxes = append(resp.Faxes, record)
+	}
+	return resp, nil
+}
+
+// GetFax returns the stored record of a commid.
+func (s *grpcServer) GetFax(ctx context.Context, req *pb.GetFaxRequest) (*pb.FaxRecord, error) {
+	if req.Commid == "" {
+		return nil, status.Error(codes.InvalidArgument, "commid is required")
+	}
+	page, err := s.query(ctx, RecordQuery{Commid: req.Commid, Page: 1, PerPage: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Records) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no record of commid %s", req.Commid)
+	}
+	return recordFromJSON(page.Records[0])
+}
+
+func (s *grpcServer) query(ctx context.Context, q RecordQuery) (*RecordPage, error) {
+	source, err := s.api.source()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	page, err := source.QueryRecords(ctx, q)
+	if err != nil {
+		log.Errorf("Error querying records: %s", err)
+		return nil, status.Error(codes.Internal, "error querying records")
+	}
+	return page, nil
+}
+
+func recordFromJSON(raw json.RawMessage) (*pb.FaxRecord, error) {
+	var r XFRecord
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, status.Errorf(codes.Internal, "error parsing stored record: %s", err)
+	}
+	return recordProto(r), nil
+}
+
+func recordProto(r XFRecord) *pb.FaxRecord {
+	return &pb.FaxRecord{
+		Ts:         timestamppb.New(r.Ts),
+		Commid:     r.Commid,
+		Modem:      r.Modem,
+		Jobid:      r.Jobid,
+		Jobtag:     r.Jobtag,
+		Filename:   r.Filename,
+		Sender:     r.Sender,
+		Destnum:    r.Destnum,
+		RemoteId:   r.RemoteID,
+		Params:     r.Params,
+		Pages:      uint32(r.Pages),
+		Jobtime:    r.Jobtime,
+		Conntime:   r.Conntime,
+		Reason:     r.Reason,
+		Cidname:    r.Cidname,
+		Cidnum:     r.Cidnum,
+		Owner:      r.Owner,
+		Dcs:        r.Dcs,
+		Direction:  string(r.Direction),
+		Text:       r.Text,
+		ReasonCode: r.ReasonCode,
+		ReasonType: r.ReasonType,
+		State:      r.State,
+		Ndials:     int32(r.Ndials),
+		Tottries:   int32(r.Tottries),
+	}
+}
+
+func eventProto(e Event) *pb.FaxEvent {
+	return &pb.FaxEvent{
+		Type:       e.Type,
+		Time:       timestamppb.New(e.Time),
+		Commid:     e.Commid,
+		Cidnum:     e.Cidnum,
+		Cidname:    e.Cidname,
+		Destnum:    e.Destnum,
+		Attempts:   int32(e.Attempts),
+		Error:      e.Error,
+		Output:     e.Output,
+		Jobid:      e.Jobid,
+		Reason:     e.Reason,
+		ReasonCode: e.ReasonCode,
+		ReasonType: e.ReasonType,
+		Record:     recordProto(e.Record),
+	}
+}
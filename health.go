@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// healthChecker is implemented by sinks that can check their own reachability.
+type healthChecker interface {
+	Check(ctx context.Context) error
+}
+
+// sinkErrors holds the error of the last push to each sink, or nil.
+var sinkErrors sync.Map
+
+func trackSinkError(sink string, err error) {
+	sinkErrors.Store(sink, err)
+}
+
+// Check reports sinks that failed their own check or their last push.
+func (s Sinks) Check(ctx context.Context) map[string]error {
+	results := make(map[string]error, len(s))
+	for _, sink := range s {
+		var err error
+		if c, ok := sink.Sink.(healthChecker); ok {
+			err = c.Check(ctx)
+		}
+		if last, ok := sinkErrors.Load(sink.name); err == nil && ok && last != nil {
+			err = fmt.Errorf("last push failed: %w", last.(error))
+		}
+		results[sink.name] = err
+	}
+	return results
+}
+
+// Health serves liveness and readiness checks of the bridge.
+type Health struct {
+	LogFile    string
+	SpoolerDir string
+}
+
+// live checks that the xferfaxlog is watched and readable.
+func (h *Health) live() map[string]error {
+	checks := map[string]error{"watcher": h.checkWatcher()}
+	f, err := os.Open(h.LogFile)
+	if err == nil {
+		f.Close()
+	}
+	checks["xferfaxlog"] = err
+	return checks
+}
+
+func (h *Health) checkWatcher() error {
+	if fsWatcher == nil {
+		return errors.New("not started")
+	}
+	for _, name := range fsWatcher.WatchList() {
+		if name == h.LogFile {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not watched", h.LogFile)
+}
+
+// ready additionally checks the spool, sendfax, the store and the sinks.
+func (h *Health) ready(ctx context.Context) map[string]error {
+	checks := h.live()
+	for _, dir := range []string{"recvq", "sendq"} {
+		checks["spool_"+dir] = checkDir(filepath.Join(h.SpoolerDir, dir))
+	}
+	if relayer != nil && relayer.Config().usesBackend(BackendSendfax) {
+		_, err := exec.LookPath("sendfax")
+		checks["sendfax"] = err
+	}
+	if store != nil {
+		checks["store"] = store.Ping(ctx)
+	}
+	for name, err := range sinks.Load().Check(ctx) {
+		checks["sink_"+name] = err
+	}
+	return checks
+}
+
+func checkDir(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	return nil
+}
+
+// ServeLive handles /healthz.
+func (h *Health) ServeLive(w http.ResponseWriter, r *http.Request) {
+	writeChecks(w, h.live())
+}
+
+// ServeReady handles /readyz.
+func (h *Health) ServeReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	writeChecks(w, h.ready(ctx))
+}
+
+// writeChecks writes the check results as JSON, with status 503 if any failed.
+func writeChecks(w http.ResponseWriter, checks map[string]error) {
+	status := http.StatusOK
+	results := make(map[string]string, len(checks))
+	for name, err := range checks {
+		if err != nil {
+			status = http.StatusServiceUnavailable
+			results[name] = err.Error()
+		} else {
+			results[name] = "ok"
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}{http.StatusText(status), results})
+}
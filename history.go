@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RecordQuery filters stored records. Zero fields don't filter.
+type RecordQuery struct {
+	Commid    string
+	Direction XFDirection
+	Number    string // Matches the destination or caller ID number
+	Since     time.Time
+	Until     time.Time
+	Page      int // 1-based
+	PerPage   int
+}
+
+// RecordPage is a page of stored records, newest first.
+type RecordPage struct {
+	Records []json.RawMessage `json:"faxes"`
+	Page    int               `json:"page"`
+	PerPage int               `json:"per_page"`
+	Total   int               `json:"total"`
+}
+
+// recordSource is implemented by stores that can be queried for records.
+type recordSource interface {
+	QueryRecords(ctx context.Context, q RecordQuery) (*RecordPage, error)
+}
+
+// queryRecords runs q against a records table with recordColumns. arg
+// returns the placeholder of the nth argument.
+func queryRecords(ctx context.Context, db *sql.DB, table string, arg func(n int) string, q RecordQuery) (*RecordPage, error) {
+	var where []string
+	var args []any
+	if q.Commid != "" {
+		where = append(where, "commid = "+arg(len(args)+1))
+		args = append(args, q.Commid)
+	}
+	if q.Direction != "" {
+		where = append(where, "direction = "+arg(len(args)+1))
+		args = append(args, string(q.Direction))
+	}
+	if q.Number != "" {
+		where = append(where, fmt.Sprintf("(destnum = %s OR cidnum = %s)", arg(len(args)+1), arg(len(args)+2)))
+		args = append(args, q.Number, q.Number)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "ts >= "+arg(len(args)+1))
+		args = append(args, q.Since.UTC())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "ts < "+arg(len(args)+1))
+		args = append(args, q.Until.UTC())
+	}
+	cond := ""
+	if len(where) > 0 {
+		cond = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	page := &RecordPage{Records: []json.RawMessage{}, Page: q.Page, PerPage: q.PerPage}
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+cond, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("error counting records: %w", err)
+	}
+
+	query := fmt.Sprintf("SELECT record FROM %s%s ORDER BY ts DESC, commid LIMIT %d OFFSET %d",
+		table, cond, q.PerPage, (q.Page-1)*q.PerPage)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying records: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var record []byte
+		if err := rows.Scan(&record); err != nil {
+			return nil, fmt.Errorf("error reading record: %w", err)
+		}
+		page.Records = append(page.Records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading records: %w", err)
+	}
+	return page, nil
+}
+
+// QueryRecords returns the records of the bridge's database matching q.
+func (s *Store) QueryRecords(ctx context.Context, q RecordQuery) (*RecordPage, error) {
+	return queryRecords(ctx, s.db, "records", func(int) string { return "?" }, q)
+}
+
+// QueryRecords returns the records of the sink's table matching q.
+func (s *PostgresSink) QueryRecords(ctx context.Context, q RecordQuery) (*RecordPage, error) {
+	return queryRecords(ctx, s.db, s.Table, func(n int) string { return fmt.Sprintf("$%d", n) }, q)
+}
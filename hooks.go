@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hook is a user script or HTTP endpoint called before or after each relay
+// attempt with the XFRecord as JSON.
+type Hook struct {
+	Command []string   `json:"command,omitempty"` // Program and arguments; the record is passed on stdin
+	URL     string     `json:"url,omitempty"`     // Endpoint the record is POSTed to
+	Timeout Duration   `json:"timeout,omitempty"` // Maximum run time (default: 30s)
+	TLS     TLSOptions `json:"tls"`               // Private CA and client certificate of the endpoint
+
+	client *http.Client
+}
+
+// Hooks holds the hooks run around relay attempts. A failing pre_relay hook
+// fails the attempt, so hooks can veto relays (e.g. after a virus scan).
+type Hooks struct {
+	PreRelay  []Hook `json:"pre_relay,omitempty"`
+	PostRelay []Hook `json:"post_relay,omitempty"`
+}
+
+// validate checks that every hook has exactly one target, and sets up the
+// clients of HTTP hooks.
+func (h *Hooks) validate() error {
+	for _, hooks := range [][]Hook{h.PreRelay, h.PostRelay} {
+		for i := range hooks {
+			hook := &hooks[i]
+			if (len(hook.Command) == 0) == (hook.URL == "") {
+				return fmt.Errorf("hook %d: exactly one of command or url is required", i)
+			}
+			client, err := hook.TLS.client()
+			if err != nil {
+				return fmt.Errorf("hook %d: %w", i, err)
+			}
+			hook.client = client
+		}
+	}
+	return nil
+}
+
+// hookEnv describes a relay attempt to a hook.
+type hookEnv struct {
+	stage   string // pre_relay or post_relay
+	path    string
+	attempt int
+	err     error // post_relay only
+}
+
+// vars returns the values passed as environment variables or HTTP headers.
+func (e hookEnv) vars() map[string]string {
+	vars := map[string]string{
+		"RELAY_STAGE":   e.stage,
+		"RELAY_ATTEMPT": strconv.Itoa(e.attempt),
+		"FAX_PATH":      e.path,
+	}
+	if e.stage == "post_relay" {
+		vars["RELAY_RESULT"] = "ok"
+		if e.err != nil {
+			vars["RELAY_RESULT"] = "failed"
+			vars["RELAY_ERROR"] = e.err.Error()
+		}
+	}
+	return vars
+}
+
+// runHooks runs the hooks in order and returns the first error.
+func runHooks(ctx context.Context, hooks []Hook, entry XFRecord, env hookEnv) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error marshaling json: %w", err)
+	}
+	for _, hook := range hooks {
+		if err := hook.run(ctx, payload, env); err != nil {
+			return fmt.Errorf("%s hook: %w", env.stage, err)
+		}
+	}
+	return nil
+}
+
+func (h Hook) run(ctx context.Context, payload []byte, env hookEnv) error {
+	timeout := h.Timeout.Duration
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if len(h.Command) > 0 {
+		cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+		cmd.WaitDelay = time.Second
+		cmd.Stdin = bytes.NewReader(payload)
+		cmd.Env = os.Environ()
+		for k, v := range env.vars() {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %w: %s", h.Command[0], err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", h.URL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range env.vars() {
+		req.Header.Set(hookHeader(k), v)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned status code: %d", h.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// hookHeader converts a variable name like RELAY_STAGE into the header X-Relay-Stage.
+func hookHeader(name string) string {
+	parts := strings.Split(strings.ToLower(name), "_")
+	for i, part := range parts {
+		if part != "" {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return "X-" + strings.Join(parts, "-")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// httpClient is shared by webhooks and hooks so connections to the same
+// endpoints are reused. Its timeout is set by the httpTimeout flag.
+var httpClient = newHTTPClient(30*time.Second, nil)
+
+// newHTTPClient returns a pooling client whose requests, including reading
+// the response, are aborted after timeout. The transport has no timeout of
+// its own, so changing the client's Timeout is enough.
+func newHTTPClient(timeout time.Duration, tlsConfig *tls.Config) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		ForceAttemptHTTP2:   true,
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// sharedTimeout aborts requests, including reading the response, after the
+// current timeout of httpClient.
+type sharedTimeout struct {
+	transport http.RoundTripper
+}
+
+func (t sharedTimeout) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := withTimeout(req.Context(), httpClient.Timeout)
+	resp, err := t.transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody cancels the request context of a response once it is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// dialContext connects to a TCP address and closes the connection once ctx
+// is done, aborting reads and writes blocked on it.
+func dialContext(ctx context.Context, address string) (net.Conn, error) {
+	conn, err := (&net.Dialer{Timeout: 10 * time.Second}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	return &ctxConn{Conn: conn, stop: stop}, nil
+}
+
+// ctxConn stops watching the context of dialContext once it is closed.
+type ctxConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func (c *ctxConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
+
+// withTimeout is context.WithTimeout, without a timeout if d is 0.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// statusError is returned for requests answered with an error status.
+type statusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *statusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("received non-2xx response status: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("received non-2xx response status: %d: %s", e.StatusCode, e.Body)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HylaFAXDelivery configures the remote HylaFAX relay backend.
+type HylaFAXDelivery struct {
+	Address  string `json:"address"`            // hfaxd address as host:port, unless the route sets a host
+	Username string `json:"username"`           // hfaxd login
+	Password string `json:"password,omitempty"` // hfaxd password, if the server requires one
+}
+
+// compile fills in defaults.
+func (h *HylaFAXDelivery) compile() error {
+	if h.Address == "" {
+		return fmt.Errorf("hylafax: address is required")
+	}
+	if h.Username == "" {
+		h.Username = "fax"
+	}
+	return nil
+}
+
+// HylaFAXBackend relays faxes to a remote HylaFAX server by speaking the
+// hfaxd client protocol directly, so the bridge can run on a different host
+// than the sending server.
+type HylaFAXBackend struct {
+	Tag string // Jobtag prefix marking our own relays
+}
+
+// Deliver uploads the TIFF to hfaxd and submits a job for it.
+func (b *HylaFAXBackend) Deliver(ctx context.Context, job *RelayJob, path string, route *Route, cfg *Config) (string, error) {
+	h := cfg.HylaFAX
+	if h == nil {
+		return "", fmt.Errorf("hylafax delivery is not configured")
+	}
+	address := h.Address
+	if route != nil && route.Host != "" {
+		address = route.Host
+	}
+	if !strings.Contains(address, ":") {
+		address += ":4559"
+	}
+
+	c, err := dialHfaxd(ctx, address)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	code, _, err := c.cmd("USER " + h.Username)
+	if err != nil {
+		return "", err
+	}
+	if code == 331 {
+		if _, _, err := c.expect(230, "PASS "+h.Password); err != nil {
+			return "", err
+		}
+	} else if code != 230 {
+		return "", fmt.Errorf("hfaxd login failed with code %d", code)
+	}
+	if _, _, err := c.expect(200, "TYPE I"); err != nil {
+		return "", err
+	}
+
+	document, err := c.storeTemp(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	_, msg, err := c.expect(200, "JNEW")
+	if err != nil {
+		return "", err
+	}
+	jobid := parseHfaxdJobID(msg)
+
+	params := jobParams(job.Entry, b.Tag+":"+job.Entry.Commid, cfg.profile(route))
+	if route != nil && route.Modem != "" {
+		params = append(params, [2]string{"MODEM", route.Modem})
+	}
+	params = append(params, [2]string{"DOCUMENT", document})
+	for _, p := range params {
+		if _, _, err := c.expect(213, fmt.Sprintf("JPARM %s %s", p[0], p[1])); err != nil {
+			return "", fmt.Errorf("error setting %s: %w", p[0], err)
+		}
+	}
+
+	_, msg, err = c.expect(200, "JSUBM")
+	if err != nil {
+		return "", err
+	}
+	_, _, _ = c.cmd("QUIT")
+
+	log.Infof("Submitted %s to %s as job %s", job.Entry.Commid, address, jobid)
+	return fmt.Sprintf("request id is %s for host %s: %s", jobid, address, msg), nil
+}
+
+// jobParams returns the JPARM settings for the fax, following the same
+// defaults the sendfax backend uses.
+func jobParams(entry XFRecord, jobtag string, profile SendfaxProfile) [][2]string {
+	maxDials, maxTries := faxRetryCount, faxRetryCount
+	if profile.MaxDials > 0 {
+		maxDials = strconv.Itoa(profile.MaxDials)
+	}
+	if profile.MaxTries > 0 {
+		maxTries = strconv.Itoa(profile.MaxTries)
+	}
+
+	params := [][2]string{
+		{"FROMUSER", quoteHfaxd(entry.Cidnum)},
+		{"DIALSTRING", quoteHfaxd(entry.Destnum)},
+		{"JOBINFO", quoteHfaxd(jobtag)},
+		{"MAXDIALS", maxDials},
+		{"MAXTRIES", maxTries},
+		{"LASTTIME", formatLastTime(parseKillTime(profile.KillTime))},
+		{"SENDTIME", "NOW"},
+	}
+	if res, ok := map[string]string{"low": "98", "fine": "196", "superfine": "391"}[profile.Resolution]; ok {
+		params = append(params, [2]string{"VRES", res})
+	}
+	if profile.Notify != "" {
+		params = append(params, [2]string{"NOTIFYADDR", quoteHfaxd(profile.Notify)})
+	}
+	if notify, ok := map[string]string{"done": "DONE", "requeue": "DONE+REQUEUE", "none": "NONE"}[profile.NotifyOn]; ok {
+		params = append(params, [2]string{"NOTIFY", notify})
+	}
+	if profile.Priority != "" {
+		priority := profile.Priority
+		if p, ok := map[string]string{"high": "63", "normal": "127", "low": "190", "bulk": "191"}[priority]; ok {
+			priority = p
+		}
+		params = append(params, [2]string{"SCHEDPRI", priority})
+	}
+	return params
+}
+
+var killTimePattern = regexp.MustCompile(`^now\s*\+\s*(\d+)\s*(minute|hour|day|week)s?$`)
+
+// parseKillTime converts a sendfax style "now + N units" kill time into a
+// duration, defaulting to two days.
+func parseKillTime(killTime string) time.Duration {
+	m := killTimePattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(killTime)))
+	if m == nil {
+		return 48 * time.Hour
+	}
+	n, _ := strconv.Atoi(m[1])
+	unit := map[string]time.Duration{
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+		"week":   7 * 24 * time.Hour,
+	}[m[2]]
+	return time.Duration(n) * unit
+}
+
+// formatLastTime formats a duration as the DDHHMM value hfaxd expects for LASTTIME.
+func formatLastTime(d time.Duration) string {
+	minutes := int(d.Minutes())
+	return fmt.Sprintf("%02d%02d%02d", minutes/(24*60), minutes/60%24, minutes%60)
+}
+
+func quoteHfaxd(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "") + `"`
+}
+
+var hfaxdJobID = regexp.MustCompile(`jobid:\s*(\d+)`)
+
+func parseHfaxdJobID(msg string) string {
+	if m := hfaxdJobID.FindStringSubmatch(msg); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// hfaxdConn is a control connection to an hfaxd server.
+type hfaxdConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialHfaxd(ctx context.Context, address string) (*hfaxdConn, error) {
+	conn, err := dialContext(ctx, address)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to hfaxd: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Minute))
+
+	c := &hfaxdConn{conn: conn, r: bufio.NewReader(conn)}
+	if code, msg, err := c.readReply(); err != nil || code != 220 {
+		conn.Close()
+		if err == nil {
+			err = fmt.Errorf("unexpected hfaxd greeting: %d %s", code, msg)
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the control connection.
+func (c *hfaxdConn) Close() error {
+	return c.conn.Close()
+}
+
+// cmd sends a command and returns the reply code and message.
+func (c *hfaxdConn) cmd(command string) (int, string, error) {
+	if _, err := fmt.Fprintf(c.conn, "%s\r\n", command); err != nil {
+		return 0, "", err
+	}
+	return c.readReply()
+}
+
+// expect sends a command and fails unless the reply has the given code.
+func (c *hfaxdConn) expect(code int, command string) (int, string, error) {
+	got, msg, err := c.cmd(command)
+	if err != nil {
+		return got, msg, err
+	}
+	if got != code {
+		verb, _, _ := strings.Cut(command, " ")
+		return got, msg, fmt.Errorf("hfaxd %s failed: %d %s", verb, got, msg)
+	}
+	return got, msg, nil
+}
+
+// readReply reads a possibly multi-line reply.
+func (c *hfaxdConn) readReply() (int, string, error) {
+	var lines []string
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return 0, "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+		if len(line) >= 4 && line[3] == ' ' {
+			code, err := strconv.Atoi(line[:3])
+			if err != nil {
+				return 0, "", fmt.Errorf("invalid hfaxd reply: %s", line)
+			}
+			return code, strings.Join(lines, "\n")[4:], nil
+		}
+		if len(line) == 3 {
+			code, err := strconv.Atoi(line)
+			if err == nil {
+				return code, "", nil
+			}
+		}
+	}
+}
+
+var pasvAddress = regexp.MustCompile(`(\d+),(\d+),(\d+),(\d+),(\d+),(\d+)`)
+
+// storeTemp uploads the file into a temporary server-side file using passive
+// mode and returns the name hfaxd assigned to it.
+func (c *hfaxdConn) storeTemp(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	_, msg, err := c.expect(227, "PASV")
+	if err != nil {
+		return "", err
+	}
+	m := pasvAddress.FindStringSubmatch(msg)
+	if m == nil {
+		return "", fmt.Errorf("invalid PASV reply: %s", msg)
+	}
+	p1, _ := strconv.Atoi(m[5])
+	p2, _ := strconv.Atoi(m[6])
+	dataAddress := net.JoinHostPort(strings.Join(m[1:5], "."), strconv.Itoa(p1*256+p2))
+
+	data, err := dialContext(ctx, dataAddress)
+	if err != nil {
+		return "", fmt.Errorf("error opening data connection: %w", err)
+	}
+
+	code, msg, err := c.cmd("STOT")
+	if err != nil {
+		data.Close()
+		return "", err
+	}
+	if code != 150 && code != 125 {
+		data.Close()
+		return "", fmt.Errorf("hfaxd STOT failed: %d %s", code, msg)
+	}
+	name := ""
+	if fields := strings.Fields(msg); len(fields) >= 2 && fields[0] == "FILE:" {
+		name = fields[1]
+	}
+
+	_, err = io.Copy(data, f)
+	data.Close()
+	if err != nil {
+		return "", fmt.Errorf("error uploading document: %w", err)
+	}
+
+	if code, msg, err := c.readReply(); err != nil {
+		return "", err
+	} else if code != 226 {
+		return "", fmt.Errorf("document upload failed: %d %s", code, msg)
+	}
+	if name == "" {
+		return "", fmt.Errorf("hfaxd did not report the uploaded file name: %s", msg)
+	}
+	return name, nil
+}
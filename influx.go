@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterSink("influxdb", newInfluxSink)
+}
+
+// InfluxSink writes a measurement per record in InfluxDB line protocol.
+// Tags are direction, modem and result (ok or failed); fields are pages,
+// conntime and jobtime in seconds, success, reason and commid.
+type InfluxSink struct {
+	URL         string     `json:"url"`                   // e.g. http://influx:8086
+	Token       string     `json:"token,omitempty"`       // InfluxDB 2.x API token
+	Org         string     `json:"org,omitempty"`         // InfluxDB 2.x organization
+	Bucket      string     `json:"bucket,omitempty"`      // InfluxDB 2.x bucket
+	Database    string     `json:"database,omitempty"`    // InfluxDB 1.x database, used if bucket is empty
+	Username    string     `json:"username,omitempty"`    // InfluxDB 1.x user
+	Password    string     `json:"password,omitempty"`    // InfluxDB 1.x password
+	Measurement string     `json:"measurement,omitempty"` // Default: fax
+	TLS         TLSOptions `json:"tls"`
+	BatchOptions
+
+	writeURL string
+	client   *http.Client
+	*recordBatcher
+}
+
+func newInfluxSink(raw json.RawMessage, env SinkEnv) (Sink, error) {
+	s := &InfluxSink{Measurement: "fax"}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	if s.URL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+
+	base := strings.TrimSuffix(s.URL, "/")
+	q := url.Values{"precision": {"ns"}}
+	switch {
+	case s.Bucket != "":
+		q.Set("org", s.Org)
+		q.Set("bucket", s.Bucket)
+		s.writeURL = base + "/api/v2/write?" + q.Encode()
+	case s.Database != "":
+		q.Set("db", s.Database)
+		s.writeURL = base + "/write?" + q.Encode()
+	default:
+		return nil, fmt.Errorf("bucket or database is required")
+	}
+
+	client, err := s.TLS.client()
+	if err != nil {
+		return nil, err
+	}
+	s.client = client
+
+	s.recordBatcher = startBatcher(env.Name, s.BatchOptions, s.write)
+	return s, nil
+}
+
+// write sends a batch of points.
+func (s *InfluxSink) write(ctx context.Context, records []XFRecord) error {
+	var body bytes.Buffer
+	for _, r := range records {
+		body.WriteString(s.point(r))
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.writeURL, &body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.Token)
+	} else if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error writing to InfluxDB: %w", err)
+	}
+	defer resp.Body.Close()
+	responseBody, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(responseBody))}
+	}
+	return nil
+}
+
+// point renders a record as a line protocol point.
+func (s *InfluxSink) point(r XFRecord) string {
+	result := "ok"
+	if !reasonOK(r.Reason) {
+		result = "failed"
+	}
+	ts := r.Ts
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	var b strings.Builder
+	b.WriteString(influxEscape(s.Measurement, ", "))
+	for _, tag := range [][2]string{{"direction", string(r.Direction)}, {"modem", r.Modem}, {"result", result}} {
+		if tag[1] != "" {
+			b.WriteString("," + tag[0] + "=" + influxEscape(tag[1], ",= "))
+		}
+	}
+
+	fmt.Fprintf(&b, " pages=%di,conntime=%s,jobtime=%s,success=%t,commid=%s",
+		r.Pages,
+		strconv.FormatFloat(hmsSeconds(r.Conntime), 'f', -1, 64),
+		strconv.FormatFloat(hmsSeconds(r.Jobtime), 'f', -1, 64),
+		result == "ok",
+		influxString(r.Commid))
+	if r.Reason != "" {
+		b.WriteString(",reason=" + influxString(r.Reason))
+	}
+	fmt.Fprintf(&b, " %d", ts.UnixNano())
+	return b.String()
+}
+
+// influxEscape backslash-escapes the given characters in measurements, tag keys and tag values.
+func influxEscape(v, chars string) string {
+	var b strings.Builder
+	for _, c := range v {
+		if strings.ContainsRune(chars, c) || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// influxString quotes a string field value.
+func influxString(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
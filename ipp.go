@@ -0,0 +1,513 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PrintToFax configures the IPP printer of ippAddr.
+type PrintToFax struct {
+	Name       string `json:"name,omitempty"`        // Printer name (default: fax)
+	CallerID   string `json:"caller_id,omitempty"`   // Caller ID number of the faxes
+	CallerName string `json:"caller_name,omitempty"` // Caller ID name of the faxes
+	Backend    string `json:"backend,omitempty"`     // sendfax or hylafax (default: as the send API)
+	Route      string `json:"route,omitempty"`       // Route whose modem, host and profile are used
+	Profile    string `json:"profile,omitempty"`     // Sendfax profile, overriding the route's
+}
+
+// compile validates the printer and fills in defaults.
+func (p *PrintToFax) compile() error {
+	if p.Name == "" {
+		p.Name = "fax"
+	}
+	if p.Backend != "" && p.Backend != BackendSendfax && p.Backend != BackendHylaFAX {
+		return fmt.Errorf("print_to_fax: backend must be sendfax or hylafax")
+	}
+	return nil
+}
+
+// IPP operations, status codes, delimiter and value tags (RFC 8010, 8011).
+const (
+	ippPrintJob             = 0x0002
+	ippValidateJob          = 0x0004
+	ippGetJobAttributes     = 0x0009
+	ippGetJobs              = 0x000A
+	ippGetPrinterAttributes = 0x000B
+
+	ippOK                        = 0x0000
+	ippBadRequest                = 0x0400
+	ippNotFound                  = 0x0406
+	ippDocumentFormatUnsupported = 0x040A
+	ippInternalError             = 0x0500
+	ippOperationUnsupported      = 0x0501
+	ippVersionUnsupported        = 0x0503
+
+	ippOperationGroup = 0x01
+	ippJobGroup       = 0x02
+	ippEndGroup       = 0x03
+	ippPrinterGroup   = 0x04
+
+	ippInteger  = 0x21
+	ippBoolean  = 0x22
+	ippEnum     = 0x23
+	ippText     = 0x41
+	ippName     = 0x42
+	ippKeyword  = 0x44
+	ippURI      = 0x45
+	ippCharset  = 0x47
+	ippLanguage = 0x48
+	ippMIMEType = 0x49
+)
+
+// IPP job states.
+const (
+	ippJobCompleted = 9
+	ippJobAborted   = 8
+)
+
+// ippAttr is an attribute with its values.
+type ippAttr struct {
+	tag    byte
+	name   string
+	values [][]byte
+}
+
+// ippRequest is a parsed IPP request, whose document follows in the body.
+type ippRequest struct {
+	major, minor byte
+	operation    uint16
+	requestID    uint32
+	attrs        []ippAttr // Of all groups; collection members become values
+}
+
+var errIPPMalformed = errors.New("malformed IPP request")
+
+// readIPPRequest reads the header and attributes of a request.
+func readIPPRequest(r *bufio.Reader) (*ippRequest, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, errIPPMalformed
+	}
+	req := &ippRequest{
+		major:     header[0],
+		minor:     header[1],
+		operation: binary.BigEndian.Uint16(header[2:4]),
+		requestID: binary.BigEndian.Uint32(header[4:8]),
+	}
+	for {
+		tag, err := r.ReadByte()
+		if err != nil {
+			return nil, errIPPMalformed
+		}
+		if tag == ippEndGroup {
+			return req, nil
+		}
+		if tag < 0x10 {
+			continue // Begins the next group
+		}
+		name, err := readIPPString(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readIPPString(r)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" && len(req.attrs) > 0 {
+			last := &req.attrs[len(req.attrs)-1]
+			last.values = append(last.values, []byte(value))
+			continue
+		}
+		req.attrs = append(req.attrs, ippAttr{tag: tag, name: name, values: [][]byte{[]byte(value)}})
+	}
+}
+
+func readIPPString(r *bufio.Reader) (string, error) {
+	var n [2]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return "", errIPPMalformed
+	}
+	b := make([]byte, binary.BigEndian.Uint16(n[:]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", errIPPMalformed
+	}
+	return string(b), nil
+}
+
+// get returns the first value of an attribute, or "".
+func (r *ippRequest) get(name string) string {
+	for _, a := range r.attrs {
+		if a.name == name && len(a.values) > 0 {
+			return string(a.values[0])
+		}
+	}
+	return ""
+}
+
+// getInt returns the first value of an integer attribute.
+func (r *ippRequest) getInt(name string) (int, bool) {
+	for _, a := range r.attrs {
+		if a.name == name && len(a.values) > 0 && len(a.values[0]) == 4 {
+			return int(int32(binary.BigEndian.Uint32(a.values[0]))), true
+		}
+	}
+	return 0, false
+}
+
+// ippResponse encodes a response.
+type ippResponse struct {
+	buf bytes.Buffer
+}
+
+func newIPPResponse(req *ippRequest, status uint16, message string) *ippResponse {
+	resp := &ippResponse{}
+	major, minor := req.major, req.minor
+	if major > 2 {
+		major, minor = 2, 0
+	}
+	resp.buf.Write([]byte{major, minor})
+	binary.Write(&resp.buf, binary.BigEndian, status)
+	binary.Write(&resp.buf, binary.BigEndian, req.requestID)
+	resp.group(ippOperationGroup)
+	resp.strings(ippCharset, "attributes-charset", "utf-8")
+	resp.strings(ippLanguage, "attributes-natural-language", "en")
+	if message != "" {
+		resp.strings(ippText, "status-message", message)
+	}
+	return resp
+}
+
+func (r *ippResponse) group(tag byte) {
+	r.buf.WriteByte(tag)
+}
+
+func (r *ippResponse) attr(tag byte, name string, values ...[]byte) {
+	for i, v := range values {
+		r.buf.WriteByte(tag)
+		if i > 0 {
+			name = ""
+		}
+		binary.Write(&r.buf, binary.BigEndian, uint16(len(name)))
+		r.buf.WriteString(name)
+		binary.Write(&r.buf, binary.BigEndian, uint16(len(v)))
+		r.buf.Write(v)
+	}
+}
+
+func (r *ippResponse) strings(tag byte, name string, values ...string) {
+	b := make([][]byte, len(values))
+	for i, v := range values {
+		b[i] = []byte(v)
+	}
+	r.attr(tag, name, b...)
+}
+
+func (r *ippResponse) ints(tag byte, name string, values ...int) {
+	b := make([][]byte, len(values))
+	for i, v := range values {
+		b[i] = binary.BigEndian.AppendUint32(nil, uint32(int32(v)))
+	}
+	r.attr(tag, name, b...)
+}
+
+func (r *ippResponse) boolean(name string, v bool) {
+	b := byte(0)
+	if v {
+		b = 1
+	}
+	r.attr(ippBoolean, name, []byte{b})
+}
+
+func (r *ippResponse) bytes() []byte {
+	r.buf.WriteByte(ippEndGroup)
+	return r.buf.Bytes()
+}
+
+// ippJob is a print job kept for Get-Jobs and Get-Job-Attributes.
+type ippJob struct {
+	id      int
+	name    string
+	user    string
+	state   int
+	message string
+	created time.Time
+}
+
+// ippMaxJobs is how many finished jobs the printer remembers.
+const ippMaxJobs = 100
+
+// IPPPrinter is a minimal IPP printer faxing the documents printed to it.
+// Jobs are faxed while Print-Job is answered, so they are completed or
+// aborted by the time the client gets the response.
+type IPPPrinter struct {
+	started time.Time
+
+	mu     sync.Mutex
+	nextID int
+	jobs   []*ippJob
+}
+
+// NewIPPPrinter creates the printer of the config's print_to_fax section.
+func NewIPPPrinter() *IPPPrinter {
+	return &IPPPrinter{started: time.Now(), nextID: 1}
+}
+
+// serveIPP serves the printer on lis.
+func serveIPP(lis net.Listener, access *Access, tlsConfig *tls.Config) {
+	log.Infof("Serving the IPP fax printer on %s", lis.Addr())
+	log.Fatal(serve(lis, access.Handler(NewIPPPrinter()), tlsConfig))
+}
+
+// ippScheme returns the URI scheme clients reach the printer with.
+func ippScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "ipps"
+	}
+	return "ipp"
+}
+
+func (p *IPPPrinter) config() *PrintToFax {
+	if cfg := relayer.Config().PrintToFax; cfg != nil {
+		return cfg
+	}
+	return &PrintToFax{Name: "fax"}
+}
+
+// ServeHTTP handles IPP requests POSTed to any path.
+func (p *IPPPrinter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/ipp") {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "IPP fax printer %s, print to %s://%s%s\n", p.config().Name, ippScheme(r), r.Host, r.URL.Path)
+		return
+	}
+	body := bufio.NewReader(http.MaxBytesReader(w, r.Body, maxSendSize))
+	req, err := readIPPRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resp *ippResponse
+	switch {
+	case req.major < 1 || req.major > 2:
+		resp = newIPPResponse(req, ippVersionUnsupported, "IPP 1.1 or 2.0 required")
+	case req.operation == ippGetPrinterAttributes:
+		resp = p.printerAttributes(req, r)
+	case req.operation == ippValidateJob:
+		resp = p.validateJob(req)
+	case req.operation == ippPrintJob:
+		resp = p.printJob(req, body, r)
+	case req.operation == ippGetJobAttributes:
+		resp = p.getJob(req, r)
+	case req.operation == ippGetJobs:
+		resp = p.getJobs(req, r)
+	default:
+		resp = newIPPResponse(req, ippOperationUnsupported, "operation not supported")
+	}
+	w.Header().Set("Content-Type", "application/ipp")
+	w.Write(resp.bytes())
+}
+
+func (p *IPPPrinter) printerAttributes(req *ippRequest, r *http.Request) *ippResponse {
+	cfg := p.config()
+	security := "none"
+	if r.TLS != nil {
+		security = "tls"
+	}
+	resp := newIPPResponse(req, ippOK, "")
+	resp.group(ippPrinterGroup)
+	resp.strings(ippURI, "printer-uri-supported", ippScheme(r)+"://"+r.Host+r.URL.Path)
+	resp.strings(ippKeyword, "uri-security-supported", security)
+	resp.strings(ippKeyword, "uri-authentication-supported", "none")
+	resp.strings(ippName, "printer-name", cfg.Name)
+	resp.strings(ippText, "printer-info", "Fax through gofaxip-bridge")
+	resp.strings(ippText, "printer-make-and-model", "gofaxip-bridge fax")
+	resp.ints(ippEnum, "printer-state", 3) // idle
+	resp.strings(ippKeyword, "printer-state-reasons", "none")
+	resp.boolean("printer-is-accepting-jobs", true)
+	resp.strings(ippKeyword, "ipp-versions-supported", "1.1", "2.0")
+	resp.ints(ippEnum, "operations-supported", ippPrintJob, ippValidateJob, ippGetJobAttributes, ippGetJobs, ippGetPrinterAttributes)
+	resp.strings(ippCharset, "charset-configured", "utf-8")
+	resp.strings(ippCharset, "charset-supported", "utf-8")
+	resp.strings(ippLanguage, "natural-language-configured", "en")
+	resp.strings(ippLanguage, "generated-natural-language-supported", "en")
+	resp.strings(ippMIMEType, "document-format-default", "application/pdf")
+	resp.strings(ippMIMEType, "document-format-supported", "application/pdf", "image/tiff", "image/png", "image/jpeg", "application/octet-stream")
+	resp.strings(ippKeyword, "pdl-override-supported", "not-attempted")
+	resp.strings(ippKeyword, "compression-supported", "none")
+	resp.boolean("color-supported", false)
+	resp.ints(ippInteger, "queued-job-count", 0)
+	resp.ints(ippInteger, "printer-up-time", int(time.Since(p.started).Seconds())+1)
+	resp.strings(ippKeyword, "job-creation-attributes-supported", "phone")
+	return resp
+}
+
+// ippPhone matches a phone number in a job name, like "15551234567" or
+// "Fax to +1 (555) 123-4567".
+var ippPhone = regexp.MustCompile(`\+?\d[\d\s().-]{2,}\d`)
+
+// destination returns the number a job is faxed to: the CUPS fax option
+// phone, a tel: destination URI of IPP FaxOut, or the first number in the
+// job name.
+func (p *IPPPrinter) destination(req *ippRequest) string {
+	candidates := []string{req.get("phone")}
+	for _, a := range req.attrs {
+		for _, v := range a.values {
+			if bytes.HasPrefix(v, []byte("tel:")) {
+				candidates = append(candidates, string(v[4:]))
+			}
+		}
+	}
+	candidates = append(candidates, ippPhone.FindString(req.get("job-name")))
+	for _, c := range candidates {
+		number := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' || r == '+' {
+				return r
+			}
+			return -1
+		}, c)
+		if isDigits(number) {
+			return number
+		}
+	}
+	return ""
+}
+
+func (p *IPPPrinter) validateJob(req *ippRequest) *ippResponse {
+	if p.destination(req) == "" {
+		return newIPPResponse(req, ippBadRequest, "no fax number, set the phone option or put the number in the job name")
+	}
+	return newIPPResponse(req, ippOK, "")
+}
+
+func (p *IPPPrinter) printJob(req *ippRequest, document io.Reader, r *http.Request) *ippResponse {
+	cfg := p.config()
+	destnum := p.destination(req)
+	if destnum == "" {
+		return newIPPResponse(req, ippBadRequest, "no fax number, set the phone option or put the number in the job name")
+	}
+	job := p.addJob(req.get("job-name"), req.get("requesting-user-name"))
+	logger := log.WithFields(log.Fields{"ipp_job": job.id, "user": job.user, "destnum": destnum})
+
+	status, message := uint16(ippOK), ""
+	doc, err := saveDocument(document)
+	if err == nil {
+		var sub *Submission
+		sub, err = relayer.Send(r.Context(), SendRequest{
+			Destnum: destnum,
+			Cidnum:  cfg.CallerID,
+			Cidname: cfg.CallerName,
+			Backend: cfg.Backend,
+			Route:   cfg.Route,
+			Profile: cfg.Profile,
+		}, doc)
+		os.Remove(doc)
+		if err == nil {
+			message = fmt.Sprintf("Faxing to %s as %s", destnum, sub.ID)
+			logger.WithField("commid", sub.ID).Infof("Faxing printed document as job %s", sub.Jobid)
+		}
+	}
+	if errors.Is(err, errInvalidSend) {
+		status, message = ippDocumentFormatUnsupported, err.Error()
+	} else if err != nil {
+		logger.Errorf("Error faxing printed document: %s", err)
+		status, message = ippInternalError, err.Error()
+	}
+	p.finishJob(job, status == ippOK, message)
+
+	resp := newIPPResponse(req, status, message)
+	p.jobAttributes(resp, job, r)
+	return resp
+}
+
+func (p *IPPPrinter) getJob(req *ippRequest, r *http.Request) *ippResponse {
+	id, ok := req.getInt("job-id")
+	if !ok {
+		uri := req.get("job-uri")
+		if _, err := fmt.Sscanf(uri[strings.LastIndex(uri, "/")+1:], "%d", &id); err != nil {
+			return newIPPResponse(req, ippBadRequest, "job-id or job-uri required")
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, job := range p.jobs {
+		if job.id == id {
+			resp := newIPPResponse(req, ippOK, "")
+			p.jobAttributes(resp, job, r)
+			return resp
+		}
+	}
+	return newIPPResponse(req, ippNotFound, "job not found")
+}
+
+func (p *IPPPrinter) getJobs(req *ippRequest, r *http.Request) *ippResponse {
+	resp := newIPPResponse(req, ippOK, "")
+	// Jobs are finished once printed, so not-completed lists none
+	if req.get("which-jobs") == "not-completed" {
+		return resp
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := len(p.jobs) - 1; i >= 0; i-- {
+		p.jobAttributes(resp, p.jobs[i], r)
+	}
+	return resp
+}
+
+func (p *IPPPrinter) jobAttributes(resp *ippResponse, job *ippJob, r *http.Request) {
+	resp.group(ippJobGroup)
+	resp.ints(ippInteger, "job-id", job.id)
+	resp.strings(ippURI, "job-uri", fmt.Sprintf("%s://%s/jobs/%d", ippScheme(r), r.Host, job.id))
+	resp.strings(ippURI, "job-printer-uri", ippScheme(r)+"://"+r.Host+r.URL.Path)
+	if job.name != "" {
+		resp.strings(ippName, "job-name", job.name)
+	}
+	if job.user != "" {
+		resp.strings(ippName, "job-originating-user-name", job.user)
+	}
+	resp.ints(ippEnum, "job-state", job.state)
+	reason := "job-completed-successfully"
+	if job.state == ippJobAborted {
+		reason = "aborted-by-system"
+	}
+	resp.strings(ippKeyword, "job-state-reasons", reason)
+	if job.message != "" {
+		resp.strings(ippText, "job-state-message", job.message)
+	}
+	resp.ints(ippInteger, "time-at-creation", int(job.created.Sub(p.started).Seconds())+1)
+}
+
+func (p *IPPPrinter) addJob(name, user string) *ippJob {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	job := &ippJob{id: p.nextID, name: name, user: user, created: time.Now()}
+	p.nextID++
+	p.jobs = append(p.jobs, job)
+	if len(p.jobs) > ippMaxJobs {
+		p.jobs = p.jobs[len(p.jobs)-ippMaxJobs:]
+	}
+	return job
+}
+
+func (p *IPPPrinter) finishJob(job *ippJob, ok bool, message string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	job.state, job.message = ippJobCompleted, message
+	if !ok {
+		job.state = ippJobAborted
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sagostin/gofaxip-bridge/pkg/qfile"
+)
+
+// XflJOB marks records of outbound job progress, read from the qfiles in
+// sendq/ and doneq/ instead of the xferfaxlog.
+const XflJOB XFDirection = "JOB"
+
+// jobStates are the names of the HylaFAX job states stored in the qfile
+// state tag.
+var jobStates = map[int]string{
+	1: "suspended",
+	2: "pending",
+	3: "sleeping",
+	4: "blocked",
+	5: "ready",
+	6: "active",
+	7: "done",
+	8: "failed",
+}
+
+var qfileName = regexp.MustCompile(`^q\d+$`)
+
+var errIncompleteQfile = errors.New("qfile without jobid or state")
+
+// jobState is what a JobWatcher compares to detect progress of a job.
+type jobState struct {
+	state    int
+	status   string
+	ndials   int
+	tottries int
+}
+
+// JobWatcher follows the qfiles of outbound jobs and sends a JOB record
+// whenever their state, status, dials or tries change.
+type JobWatcher struct {
+	spoolerDir string
+	records    chan XFRecord
+	jobs       map[string]jobState // Last state by qfile name
+}
+
+// NewJobWatcher creates a watcher for the sendq/ and doneq/ of a spooler.
+func NewJobWatcher(spoolerDir string) *JobWatcher {
+	return &JobWatcher{
+		spoolerDir: spoolerDir,
+		records:    make(chan XFRecord, 100),
+		jobs:       make(map[string]jobState),
+	}
+}
+
+// Records returns the channel JOB records are sent to.
+func (w *JobWatcher) Records() <-chan XFRecord {
+	return w.records
+}
+
+// Start seeds the state of the jobs already queued, without sending
+// records for them, and starts watching.
+func (w *JobWatcher) Start() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error creating job watcher: %w", err)
+	}
+	for _, q := range []string{"sendq", "doneq"} {
+		dir := filepath.Join(w.spoolerDir, q)
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("error watching %s: %w", dir, err)
+		}
+	}
+
+	files, err := os.ReadDir(filepath.Join(w.spoolerDir, "sendq"))
+	if err != nil {
+		watcher.Close()
+		return fmt.Errorf("error reading sendq: %w", err)
+	}
+	for _, f := range files {
+		if qfileName.MatchString(f.Name()) {
+			if _, state, err := readJob(filepath.Join(w.spoolerDir, "sendq", f.Name())); err == nil {
+				w.jobs[f.Name()] = state
+			}
+		}
+	}
+
+	go w.run(watcher)
+	return nil
+}
+
+func (w *JobWatcher) run(watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			name := filepath.Base(event.Name)
+			if !qfileName.MatchString(name) {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+				w.check(event.Name)
+			} else if event.Op&fsnotify.Remove != 0 && filepath.Base(filepath.Dir(event.Name)) == "doneq" {
+				// faxqclean has removed the finished job
+				delete(w.jobs, name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("Job watcher error: %s", err)
+		}
+	}
+}
+
+// check sends a record if the job of a qfile has changed.
+func (w *JobWatcher) check(path string) {
+	record, state, err := readJob(path)
+	if err != nil {
+		// faxq may have moved the qfile to doneq/ in the meantime
+		if !os.IsNotExist(err) && !errors.Is(err, errIncompleteQfile) {
+			log.Errorf("Error reading qfile: %s", err)
+		}
+		return
+	}
+
+	// Finished jobs are kept until their qfile is removed from doneq/, so
+	// moving it there does not repeat the last record
+	name := filepath.Base(path)
+	prev, known := w.jobs[name]
+	w.jobs[name] = state
+	if known && prev == state {
+		return
+	}
+	w.records <- record
+}
+
+// readJob reads the record and state of the job of a qfile.
+func readJob(path string) (XFRecord, jobState, error) {
+	q, err := qfile.OpenQfileRead(path)
+	if err != nil {
+		return XFRecord{}, jobState{}, err
+	}
+	defer q.Close()
+
+	// Only half written if the writer did not lock it
+	var state jobState
+	jobid := q.GetString("jobid")
+	if state.state, err = q.GetInt("state"); err != nil || jobid == "" {
+		return XFRecord{}, jobState{}, fmt.Errorf("%s: %w", path, errIncompleteQfile)
+	}
+	state.status = q.GetString("status")
+	state.ndials, _ = q.GetInt("ndials")
+	state.tottries, _ = q.GetInt("tottries")
+	pages, _ := q.GetInt("totpages")
+
+	record := XFRecord{
+		Ts:        time.Now().UTC(),
+		Commid:    "job-" + jobid,
+		Modem:     q.GetString("modem"),
+		Jobid:     jobid,
+		Jobtag:    q.GetString("jobtag"),
+		Sender:    q.GetString("sender"),
+		Owner:     q.GetString("owner"),
+		Destnum:   q.GetString("number"),
+		Pages:     uint(pages),
+		Reason:    state.status,
+		Direction: XflJOB,
+		State:     jobStates[state.state],
+		Ndials:    state.ndials,
+		Tottries:  state.tottries,
+	}
+	if record.State == "" {
+		record.State = strconv.Itoa(state.state)
+	}
+	return record, state, nil
+}
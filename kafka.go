@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterSink("kafka", newKafkaSink)
+}
+
+// KafkaSASL configures SASL authentication with the brokers.
+type KafkaSASL struct {
+	Mechanism string `json:"mechanism"` // plain, scram-sha-256 or scram-sha-512
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+}
+
+func (s *KafkaSASL) mechanism() (sasl.Mechanism, error) {
+	switch s.Mechanism {
+	case "plain", "":
+		return plain.Mechanism{Username: s.Username, Password: s.Password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, s.Username, s.Password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, s.Username, s.Password)
+	}
+	return nil, fmt.Errorf("unknown SASL mechanism %q", s.Mechanism)
+}
+
+// KafkaSink publishes records as JSON to a Kafka topic, keyed by commid.
+type KafkaSink struct {
+	Brokers []string    `json:"brokers"`
+	Topic   string      `json:"topic"`
+	SASL    *KafkaSASL  `json:"sasl,omitempty"`
+	TLS     *TLSOptions `json:"tls,omitempty"` // Connect with TLS; {} verifies against the system roots
+	BatchOptions
+
+	writer *kafka.Writer
+}
+
+func newKafkaSink(raw json.RawMessage, env SinkEnv) (Sink, error) {
+	s := &KafkaSink{}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	if len(s.Brokers) == 0 || s.Topic == "" {
+		return nil, fmt.Errorf("brokers and topic are required")
+	}
+
+	transport := &kafka.Transport{}
+	if s.TLS != nil {
+		tlsConfig, err := s.TLS.Config()
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS settings: %w", err)
+		}
+		if tlsConfig == nil {
+			tlsConfig = defaultTLSConfig()
+		}
+		transport.TLS = tlsConfig
+	}
+	if s.SASL != nil {
+		mechanism, err := s.SASL.mechanism()
+		if err != nil {
+			return nil, err
+		}
+		transport.SASL = mechanism
+	}
+
+	batchSize, batchWait := s.BatchSize, s.BatchWait.Duration
+	if batchSize < 1 {
+		batchSize = 100
+	}
+	if batchWait <= 0 {
+		batchWait = 5 * time.Second
+	}
+
+	name := env.Name
+	s.writer = &kafka.Writer{
+		Addr:         kafka.TCP(s.Brokers...),
+		Topic:        s.Topic,
+		Balancer:     &kafka.Hash{},
+		BatchSize:    batchSize,
+		BatchTimeout: batchWait,
+		MaxAttempts:  batchRetryPolicy.MaxAttempts,
+		RequiredAcks: kafka.RequireAll,
+		Async:        true,
+		Transport:    transport,
+		Completion: func(messages []kafka.Message, err error) {
+			countPush(name, err)
+			if err != nil {
+				sinkDropped.WithLabelValues(name).Add(float64(len(messages)))
+				log.Errorf("Failed to publish %d records to kafka sink %s: %s", len(messages), name, err)
+				return
+			}
+			sinkLastSuccess.WithLabelValues(name).SetToCurrentTime()
+		},
+	}
+	return s, nil
+}
+
+func (s *KafkaSink) async() {}
+
+// Close publishes the pending records and closes the writer.
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
+
+// Push queues the record for publishing.
+func (s *KafkaSink) Push(ctx context.Context, record XFRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling json: %w", err)
+	}
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(recordKey(record)),
+		Value: value,
+		Time:  record.Ts,
+	})
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// maxLineSize is the longest xferfaxlog line read, set by -maxLineSize.
+var maxLineSize = 1 << 20
+
+// newLogScanner returns a scanner over the lines of r that skips lines
+// longer than max bytes instead of failing on them like bufio.Scanner,
+// calling tooLong with the start of each.
+func newLogScanner(r io.Reader, max int, tooLong func(prefix []byte)) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, min(bufio.MaxScanTokenSize, max)), max)
+	skipping := false
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 && skipping {
+			skipping = false
+			return i + 1, nil, nil
+		} else if i < 0 && skipping {
+			return len(data), nil, nil
+		} else if i < 0 && len(data) >= max {
+			// The scanner's buffer is full, so the line is longer than max
+			skipping = true
+			tooLong(data[:min(len(data), 80)])
+			return len(data), nil, nil
+		}
+		return bufio.ScanLines(data, atEOF)
+	})
+	return scanner
+}
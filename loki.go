@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LokiClient holds the configuration for the Loki client.
+type LokiClient struct {
+	Name     string // Sink name used in metrics
+	Username string // Username for basic auth
+	Password string // Password for basic auth
+	Format   string // Push format: json (default) or protobuf
+	Labels   *LokiLabels
+	TenantID string        // Sent as X-Scope-OrgID to multi-tenant Loki
+	TLS      *tls.Config   `json:"-"` // TLS settings for https push URLs
+	Timeout  time.Duration // Maximum time a push may take (default: 30s)
+
+	// Fanout pushes every batch to all endpoints instead of failing over.
+	Fanout bool
+
+	endpoints  []*lokiEndpoint
+	clientOnce sync.Once
+	client     *http.Client
+
+	entries  chan lokiEntry
+	spoolDir string        // Failed batches are kept here until Loki accepts them
+	wake     chan struct{} // Signals newly spooled batches
+	done     chan struct{} // Closed by Close
+	stopped  chan struct{} // Closed once the batcher has flushed after Close
+}
+
+// LogEntry represents a single log entry.
+type LogEntry struct {
+	Timestamp string `json:"timestamp"`
+	Line      string `json:"line"`
+}
+
+// LokiPushData represents the data structure required by Loki's push API.
+type LokiPushData struct {
+	Streams []LokiStream `json:"streams"`
+}
+
+// LokiStream represents a stream of logs with the same labels in Loki.
+type LokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"` // Array of [timestamp, line] tuples
+}
+
+// lokiEntry is a log entry waiting to be pushed with its labels.
+type lokiEntry struct {
+	labels map[string]string
+	entry  LogEntry
+}
+
+// NewLokiClient creates a new client to interact with Loki. Batches are
+// pushed to the first healthy of the pushURLs.
+func NewLokiClient(pushURLs []string, username, password string) *LokiClient {
+	return &LokiClient{
+		endpoints: newLokiEndpoints(pushURLs),
+		Username:  username,
+		Password:  password,
+		entries:   make(chan lokiEntry, 1024),
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+}
+
+// lokiRetryPolicy is the backoff for retrying spooled batches.
+var lokiRetryPolicy = RetryPolicy{
+	BaseDelay: 5 * time.Second,
+	MaxDelay:  5 * time.Minute,
+	Jitter:    0.2,
+}
+
+// Start launches the background batcher. Queued entries are pushed once
+// batchSize entries are buffered or the oldest has waited for batchWait.
+// Batches Loki does not accept because it is unreachable, rate limiting or
+// failing are spooled to spoolDir and retried with backoff.
+func (c *LokiClient) Start(batchSize int, batchWait time.Duration, spoolDir string) error {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if err := os.MkdirAll(spoolDir, 0755); err != nil {
+		return fmt.Errorf("error creating Loki spool directory: %w", err)
+	}
+	c.spoolDir = spoolDir
+	if len(c.endpoints) == 0 {
+		return fmt.Errorf("no Loki push URL given")
+	}
+
+	go c.run(batchSize, batchWait)
+	go c.drainSpool()
+	if len(c.endpoints) > 1 {
+		go c.checkHealth(30 * time.Second)
+	}
+	return nil
+}
+
+// Close pushes the queued entries, spooling them if Loki does not accept
+// them, and stops the background goroutines.
+func (c *LokiClient) Close() error {
+	close(c.done)
+	<-c.stopped
+	return nil
+}
+
+// Enqueue queues a log entry for the next batch. Entries enqueued after
+// Close are dropped.
+func (c *LokiClient) Enqueue(labels map[string]string, entry LogEntry) {
+	select {
+	case <-c.done:
+		sinkDropped.WithLabelValues(c.Name).Inc()
+		return
+	default:
+	}
+	select {
+	case c.entries <- lokiEntry{labels: labels, entry: entry}:
+	case <-c.done:
+		sinkDropped.WithLabelValues(c.Name).Inc()
+	}
+}
+
+func (c *LokiClient) run(batchSize int, batchWait time.Duration) {
+	var batch []lokiEntry
+	timer := time.NewTimer(batchWait)
+	timer.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		defer func() { batch = nil }()
+
+		// Keep the order of entries while older batches are still spooled
+		if files, _ := c.spooled(); len(files) > 0 {
+			c.spool(batch)
+			return
+		}
+
+		err := c.PushBatch(context.Background(), batch)
+		countPush(c.Name, err)
+		switch {
+		case err == nil:
+			sinkLastSuccess.WithLabelValues(c.Name).SetToCurrentTime()
+			log.Debugf("Pushed %d entries to Loki", len(batch))
+		case isRetryable(err):
+			log.Warnf("Failed to push %d entries to Loki, spooling them: %s", len(batch), err)
+			c.spool(batch)
+		default:
+			sinkDropped.WithLabelValues(c.Name).Add(float64(len(batch)))
+			log.Errorf("Loki rejected %d entries: %s", len(batch), err)
+		}
+	}
+
+	for {
+		select {
+		case e := <-c.entries:
+			if len(batch) == 0 {
+				timer.Reset(batchWait)
+			}
+			batch = append(batch, e)
+			if len(batch) >= batchSize {
+				timer.Stop()
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		case <-c.done:
+			timer.Stop()
+			for len(c.entries) > 0 {
+				batch = append(batch, <-c.entries)
+			}
+			flush()
+			close(c.stopped)
+			return
+		}
+	}
+}
+
+// spooledEntry is the on-disk form of a lokiEntry.
+type spooledEntry struct {
+	Labels    map[string]string `json:"labels"`
+	Timestamp string            `json:"timestamp"`
+	Line      string            `json:"line"`
+}
+
+// spool writes a batch to the spool directory.
+func (c *LokiClient) spool(batch []lokiEntry) {
+	entries := make([]spooledEntry, len(batch))
+	for i, e := range batch {
+		entries[i] = spooledEntry{Labels: e.labels, Timestamp: e.entry.Timestamp, Line: e.entry.Line}
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		log.Errorf("Error marshaling Loki spool batch: %s", err)
+		return
+	}
+
+	name := filepath.Join(c.spoolDir, fmt.Sprintf("batch-%020d.json", time.Now().UnixNano()))
+	if err := writeFileAtomic(name, data, 0644); err != nil {
+		log.Errorf("Error spooling %d Loki entries, they are lost: %s", len(batch), err)
+		return
+	}
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// spooled returns the spooled batch files, oldest first.
+func (c *LokiClient) spooled() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(c.spoolDir, "batch-*.json"))
+	sort.Strings(files)
+	return files, err
+}
+
+// drainSpool pushes spooled batches in order, backing off while Loki fails.
+func (c *LokiClient) drainSpool() {
+	attempt := 0
+	for {
+		files, err := c.spooled()
+		if err != nil {
+			log.Errorf("Error listing Loki spool: %s", err)
+		}
+		lokiSpooledBatches.WithLabelValues(c.Name).Set(float64(len(files)))
+		if len(files) == 0 {
+			select {
+			case <-c.wake:
+			case <-time.After(time.Minute):
+			case <-c.done:
+				return
+			}
+			continue
+		}
+
+		n, err := c.pushSpooled(files[0])
+		if errors.Is(err, errCorruptSpool) {
+			// Unreadable batches would block the spool forever
+			log.Errorf("Moving aside corrupt spooled Loki batch %s: %s", files[0], err)
+			if err := os.Rename(files[0], files[0]+".corrupt"); err != nil {
+				log.Errorf("Error moving corrupt spooled batch, removing it: %s", err)
+				os.Remove(files[0])
+			}
+			continue
+		}
+		sinkRetries.WithLabelValues(c.Name).Inc()
+		countPush(c.Name, err)
+		if err == nil {
+			sinkLastSuccess.WithLabelValues(c.Name).SetToCurrentTime()
+		}
+		if err == nil || !isRetryable(err) {
+			if err != nil {
+				sinkDropped.WithLabelValues(c.Name).Add(float64(n))
+				log.Errorf("Loki rejected spooled batch %s, dropping it: %s", filepath.Base(files[0]), err)
+			}
+			if err := os.Remove(files[0]); err != nil {
+				log.Errorf("Error removing spooled batch: %s", err)
+			}
+			attempt = 0
+			continue
+		}
+
+		attempt++
+		delay := lokiRetryPolicy.Delay(attempt)
+		log.Warnf("Failed to push %d spooled Loki batches, retrying in %s: %s", len(files), delay, err)
+		select {
+		case <-time.After(delay):
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// errCorruptSpool marks spooled batches that cannot be read back.
+var errCorruptSpool = errors.New("corrupt spooled batch")
+
+// pushSpooled pushes one spooled batch file and returns its number of entries.
+func (c *LokiClient) pushSpooled(name string) (int, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errCorruptSpool, err)
+	}
+	var entries []spooledEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, fmt.Errorf("%w: %w", errCorruptSpool, err)
+	}
+
+	batch := make([]lokiEntry, len(entries))
+	for i, e := range entries {
+		batch[i] = lokiEntry{labels: e.Labels, entry: LogEntry{Timestamp: e.Timestamp, Line: e.Line}}
+	}
+	return len(batch), c.PushBatch(context.Background(), batch)
+}
+
+// isRetryable reports whether a failed push may succeed later: Loki was
+// unreachable, is rate limiting (429) or failing (5xx).
+func isRetryable(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+// labelKey returns a canonical representation of a label set.
+func labelKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%q,", k, labels[k])
+	}
+	return b.String()
+}
+
+// buildStreams groups entries with the same labels into streams.
+func buildStreams(entries []lokiEntry) []LokiStream {
+	var streams []LokiStream
+	index := make(map[string]int)
+	for _, e := range entries {
+		key := labelKey(e.labels)
+		i, ok := index[key]
+		if !ok {
+			i = len(streams)
+			index[key] = i
+			streams = append(streams, LokiStream{Stream: e.labels})
+		}
+		streams[i].Values = append(streams[i].Values, [2]string{e.entry.Timestamp, e.entry.Line})
+	}
+	return streams
+}
+
+// httpClient returns the client shared by all pushes, set up with the TLS
+// settings and timeout.
+func (c *LokiClient) httpClient() *http.Client {
+	c.clientOnce.Do(func() {
+		timeout := c.Timeout
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		c.client = newHTTPClient(timeout, c.TLS)
+	})
+	return c.client
+}
+
+// PushLog sends a single log entry to Loki.
+func (c *LokiClient) PushLog(ctx context.Context, labels map[string]string, entry LogEntry) error {
+	return c.PushBatch(ctx, []lokiEntry{{labels: labels, entry: entry}})
+}
+
+// PushBatch sends several log entries to Loki in one request.
+func (c *LokiClient) PushBatch(ctx context.Context, entries []lokiEntry) error {
+	// Prepare the payload
+	payload := LokiPushData{
+		Streams: buildStreams(entries),
+	}
+
+	var body []byte
+	var contentType string
+	var err error
+	switch c.Format {
+	case LokiFormatProtobuf:
+		contentType = "application/x-protobuf"
+		if body, err = encodeLokiProtobuf(payload.Streams); err != nil {
+			return fmt.Errorf("error encoding protobuf: %w", err)
+		}
+	case LokiFormatJSON, "":
+		contentType = "application/json"
+		if body, err = json.Marshal(payload); err != nil {
+			return fmt.Errorf("error marshaling json: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown Loki push format %q", c.Format)
+	}
+
+	return c.pushEndpoints(ctx, body, contentType)
+}
+
+// send posts an encoded push request to one Loki endpoint.
+func (c *LokiClient) send(ctx context.Context, url string, body []byte, contentType string) error {
+	// Create a new request
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	// Set basic auth if credentials are provided
+	if c.Username != "" && c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	if c.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", c.TenantID)
+	}
+
+	// Send the request
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request to Loki %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, _ := io.ReadAll(resp.Body)
+
+	// Check the response status code; Loki answers 204 No Content on success
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return &statusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(responseBody))}
+	}
+
+	return nil
+}
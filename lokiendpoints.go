@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// lokiEndpoint is one of the Loki push URLs with its health state.
+type lokiEndpoint struct {
+	url string
+
+	mu      sync.Mutex
+	healthy bool
+}
+
+func newLokiEndpoints(urls []string) []*lokiEndpoint {
+	endpoints := make([]*lokiEndpoint, 0, len(urls))
+	for _, u := range urls {
+		if u = strings.TrimSpace(u); u != "" {
+			endpoints = append(endpoints, &lokiEndpoint{url: u, healthy: true})
+		}
+	}
+	return endpoints
+}
+
+func (e *lokiEndpoint) isHealthy() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.healthy
+}
+
+func (e *lokiEndpoint) setHealthy(healthy bool) {
+	e.mu.Lock()
+	changed := e.healthy != healthy
+	e.healthy = healthy
+	e.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if healthy {
+		log.Infof("Loki endpoint %s is healthy again", e.url)
+	} else {
+		log.Warnf("Loki endpoint %s is unhealthy, failing over", e.url)
+	}
+}
+
+// readyURL returns the URL of Loki's readiness endpoint next to the push API.
+func (e *lokiEndpoint) readyURL() string {
+	if i := strings.Index(e.url, "/loki/api/"); i >= 0 {
+		return e.url[:i] + "/ready"
+	}
+	return ""
+}
+
+// ordered returns the endpoints to try, healthy ones first in configured order.
+func (c *LokiClient) ordered() []*lokiEndpoint {
+	var healthy, unhealthy []*lokiEndpoint
+	for _, e := range c.endpoints {
+		if e.isHealthy() {
+			healthy = append(healthy, e)
+		} else {
+			unhealthy = append(unhealthy, e)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// pushEndpoints sends the body to the first endpoint accepting it, or to all
+// of them if Fanout is set. Endpoints failing with retryable errors are marked
+// unhealthy until they accept a push or pass a health check.
+func (c *LokiClient) pushEndpoints(ctx context.Context, body []byte, contentType string) error {
+	if c.Fanout {
+		// Only retryable failures are returned, so the batch is spooled
+		// and resent to all endpoints; Loki drops the duplicate entries.
+		var retry []error
+		var rejected error
+		for _, e := range c.endpoints {
+			err := c.send(ctx, e.url, body, contentType)
+			switch {
+			case err == nil:
+			case isRetryable(err):
+				retry = append(retry, err)
+			default:
+				rejected = err
+			}
+			e.setHealthy(err == nil || !isRetryable(err))
+		}
+		if len(retry) > 0 {
+			if rejected != nil {
+				log.Errorf("Loki rejected batch: %s", rejected)
+			}
+			return errors.Join(retry...)
+		}
+		return rejected
+	}
+
+	var err error
+	for _, e := range c.ordered() {
+		err = c.send(ctx, e.url, body, contentType)
+		if ctx.Err() != nil {
+			return err
+		}
+		if err == nil || !isRetryable(err) {
+			// Other endpoints would reject the same batch
+			e.setHealthy(true)
+			return err
+		}
+		e.setHealthy(false)
+		if len(c.endpoints) > 1 {
+			log.Warnf("Failed to push to Loki endpoint %s: %s", e.url, err)
+		}
+	}
+	return err
+}
+
+// checkHealth probes unhealthy endpoints' /ready every interval.
+func (c *LokiClient) checkHealth(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			return
+		}
+		for _, e := range c.endpoints {
+			ready := e.readyURL()
+			if e.isHealthy() || ready == "" {
+				continue
+			}
+			resp, err := c.httpClient().Get(ready)
+			if err != nil {
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				e.setHealthy(true)
+			}
+		}
+	}
+}
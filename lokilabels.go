@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// defaultLokiLabels are the labels pushed to Loki if none are configured.
+var defaultLokiLabels = map[string]string{"job": "xferfaxlog", "instance": "faxrelay"}
+
+var lokiLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// LokiLabels configures the labels of the streams pushed to Loki.
+type LokiLabels struct {
+	// Labels are Go templates over the XFRecord, e.g. "{{.Direction}}" or
+	// "{{.Modem}}"; {{hostname}} expands to the local hostname. Labels
+	// rendering to an empty value are omitted.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Extra are static labels added to every stream, e.g. the deployment.
+	Extra map[string]string `json:"extra_labels,omitempty"`
+
+	templates map[string]*template.Template
+}
+
+// compile validates the label names and parses the label templates.
+func (l *LokiLabels) compile() error {
+	if len(l.Labels) == 0 {
+		l.Labels = defaultLokiLabels
+	}
+
+	hostname, _ := os.Hostname()
+	funcs := template.FuncMap{"hostname": func() string { return hostname }}
+
+	l.templates = make(map[string]*template.Template, len(l.Labels))
+	for name, text := range l.Labels {
+		if !lokiLabelName.MatchString(name) {
+			return fmt.Errorf("loki label %q: invalid label name", name)
+		}
+		t, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return fmt.Errorf("loki label %s: %w", name, err)
+		}
+		l.templates[name] = t
+	}
+	for name := range l.Extra {
+		if !lokiLabelName.MatchString(name) {
+			return fmt.Errorf("loki extra label %q: invalid label name", name)
+		}
+	}
+	return nil
+}
+
+// render returns the labels for the stream the record is pushed to.
+func (l *LokiLabels) render(entry XFRecord) (map[string]string, error) {
+	labels := make(map[string]string, len(l.templates)+len(l.Extra))
+	for name, t := range l.templates {
+		var b bytes.Buffer
+		if err := t.Execute(&b, entry); err != nil {
+			return nil, fmt.Errorf("error rendering loki label %s: %w", name, err)
+		}
+		if value := strings.TrimSpace(b.String()); value != "" {
+			labels[name] = value
+		}
+	}
+	for name, value := range l.Extra {
+		labels[name] = value
+	}
+	return labels, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterSink("loki", newLokiSink)
+}
+
+// LokiSinkConfig configures a Loki sink. The -loki* flags configure one
+// named "loki" as well.
+type LokiSinkConfig struct {
+	URLs      []string   `json:"urls"`
+	Username  string     `json:"username,omitempty"`
+	Password  string     `json:"password,omitempty"`
+	TenantID  string     `json:"tenant_id,omitempty"`
+	Format    string     `json:"format,omitempty"` // json (default) or protobuf
+	Fanout    bool       `json:"fanout,omitempty"`
+	TLS       TLSOptions `json:"tls"`
+	Timeout   Duration   `json:"timeout"`    // Default: the httpTimeout flag
+	BatchSize int        `json:"batch_size"` // Default: 100
+	BatchWait Duration   `json:"batch_wait"` // Default: 5s
+	SpoolDir  string     `json:"spool_dir"`  // Default: <logDir>/lokispool-<name>
+
+	LokiLabels
+}
+
+// LokiSink pushes records as JSON log lines to Loki.
+type LokiSink struct {
+	client *LokiClient
+}
+
+func newLokiSink(raw json.RawMessage, env SinkEnv) (Sink, error) {
+	c := &LokiSinkConfig{}
+	if err := json.Unmarshal(raw, c); err != nil {
+		return nil, err
+	}
+	if c.SpoolDir == "" {
+		c.SpoolDir = filepath.Join(env.LogDir, "lokispool-"+env.Name)
+	}
+	return c.Open(env.Name)
+}
+
+// Open creates the Loki client and starts its batcher.
+func (c *LokiSinkConfig) Open(name string) (*LokiSink, error) {
+	switch c.Format {
+	case "":
+		c.Format = LokiFormatJSON
+	case LokiFormatJSON, LokiFormatProtobuf:
+	default:
+		return nil, fmt.Errorf("invalid format %q: must be json or protobuf", c.Format)
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = 100
+	}
+	if c.BatchWait.Duration == 0 {
+		c.BatchWait.Duration = 5 * time.Second
+	}
+	if err := c.LokiLabels.compile(); err != nil {
+		return nil, err
+	}
+	tlsConfig, err := c.TLS.Config()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS settings: %w", err)
+	}
+
+	client := NewLokiClient(c.URLs, c.Username, c.Password)
+	client.Name = name
+	client.Fanout = c.Fanout
+	client.Format = c.Format
+	client.Labels = &c.LokiLabels
+	client.TenantID = c.TenantID
+	client.TLS = tlsConfig
+	client.Timeout = c.Timeout.Duration
+	if client.Timeout == 0 {
+		client.Timeout = httpClient.Timeout
+	}
+	if err := client.Start(c.BatchSize, c.BatchWait.Duration, c.SpoolDir); err != nil {
+		return nil, err
+	}
+	log.Infof("Pushing records to Loki at %v", c.URLs)
+	return &LokiSink{client: client}, nil
+}
+
+func (s *LokiSink) async() {}
+
+// Close pushes the queued records and stops the client.
+func (s *LokiSink) Close() error {
+	return s.client.Close()
+}
+
+// Check reports whether any Loki endpoint is healthy.
+func (s *LokiSink) Check(ctx context.Context) error {
+	for _, e := range s.client.endpoints {
+		if e.isHealthy() {
+			return nil
+		}
+	}
+	return errors.New("no healthy Loki endpoint")
+}
+
+// Push queues the record for the next batch.
+func (s *LokiSink) Push(ctx context.Context, record XFRecord) error {
+	jsonData, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling log entry: %w", err)
+	}
+	labels, err := s.client.Labels.render(record)
+	if err != nil {
+		return err
+	}
+
+	s.client.Enqueue(labels, LogEntry{
+		Timestamp: strconv.FormatInt(time.Now().UnixNano(), 10),
+		Line:      string(jsonData),
+	})
+	return nil
+}
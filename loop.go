@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoopGuard detects received faxes that originate from our own relays, to
+// keep a misconfigured route from bouncing a fax between two bridges forever.
+//
+// The jobtag of a relay does not travel with the fax, so the tag is only
+// seen if the remote station puts it in its TSI, as a bridged system can
+// with its LocalIdentifier. Other loops are caught by the caller and
+// destination numbers a relay was sent with reappearing within the window.
+type LoopGuard struct {
+	tag    string
+	window time.Duration
+
+	mu     sync.Mutex
+	recent map[string]time.Time // Relay times by relayed caller and destination number
+}
+
+// NewLoopGuard creates a loop guard. Relayed faxes are tagged with tag, and a
+// fax from the caller to the destination of a relay received within window
+// of it is considered a loop.
+func NewLoopGuard(tag string, window time.Duration) *LoopGuard {
+	return &LoopGuard{
+		tag:    tag,
+		window: window,
+		recent: make(map[string]time.Time),
+	}
+}
+
+func loopKey(entry XFRecord) string {
+	return entry.Cidnum + "|" + entry.Destnum
+}
+
+// Tag returns the jobtag set on all faxes the bridge sends.
+func (g *LoopGuard) Tag() string {
+	return g.tag
+}
+
+// Check reports whether the received fax looks like one of our own relays,
+// and why.
+func (g *LoopGuard) Check(entry XFRecord) (bool, string) {
+	if g.tag != "" && strings.Contains(entry.RemoteID, g.tag) {
+		return true, "carries the bridge tag " + g.tag
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for key, ts := range g.recent {
+		if now.Sub(ts) > g.window {
+			delete(g.recent, key)
+		}
+	}
+	if ts, ok := g.recent[loopKey(entry)]; ok {
+		return true, "same caller and destination were relayed at " + ts.Format(time.RFC3339)
+	}
+	return false, ""
+}
+
+// Remember records a relay so that it is recognized if it comes back.
+func (g *LoopGuard) Remember(entry XFRecord) {
+	if g.window <= 0 {
+		return
+	}
+	g.mu.Lock()
+	g.recent[loopKey(entry)] = time.Now()
+	g.mu.Unlock()
+}
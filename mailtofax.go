@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MailToFax configures the SMTP gateway faxing the attachments of messages
+// to <number>@<domain>.
+type MailToFax struct {
+	Domains  []string          `json:"domains"`             // Recipient domains, e.g. fax.example.com
+	Users    map[string]string `json:"users,omitempty"`     // SMTP AUTH users and passwords; AUTH is required if set
+	Senders  []MailSender      `json:"senders"`             // Rules authorizing senders, the first match applies
+	CertFile string            `json:"cert_file,omitempty"` // PEM certificate offered with STARTTLS
+	KeyFile  string            `json:"key_file,omitempty"`  // PEM key of the certificate
+	Backend  string            `json:"backend,omitempty"`   // sendfax or hylafax (default: as the send API)
+	Route    string            `json:"route,omitempty"`     // Route whose modem, host and profile are used
+	Profile  string            `json:"profile,omitempty"`   // Sendfax profile, overriding the route's
+
+	tls *tls.Config
+}
+
+// MailSender authorizes senders to fax to some destinations.
+type MailSender struct {
+	Addresses    []string   `json:"addresses,omitempty"`   // Envelope senders like ops@example.com or *@example.com (default: all)
+	User         string     `json:"user,omitempty"`        // SMTP AUTH user the sender must be logged in as
+	Destinations NumberList `json:"destinations"`          // Allowed destinations (default: all)
+	CallerID     string     `json:"caller_id,omitempty"`   // Caller ID number of the faxes
+	CallerName   string     `json:"caller_name,omitempty"` // Caller ID name of the faxes
+}
+
+// compile validates the gateway config and loads its certificate.
+func (m *MailToFax) compile() error {
+	if len(m.Domains) == 0 {
+		return fmt.Errorf("mail_to_fax: domains are required")
+	}
+	if len(m.Senders) == 0 {
+		return fmt.Errorf("mail_to_fax: senders are required")
+	}
+	for i := range m.Senders {
+		s := &m.Senders[i]
+		for _, a := range s.Addresses {
+			if _, err := path.Match(strings.ToLower(a), ""); err != nil {
+				return fmt.Errorf("mail_to_fax: senders: invalid address pattern %q", a)
+			}
+		}
+		if _, ok := m.Users[s.User]; s.User != "" && !ok {
+			return fmt.Errorf("mail_to_fax: senders: unknown user %s", s.User)
+		}
+		if err := s.Destinations.compile(); err != nil {
+			return fmt.Errorf("mail_to_fax: senders: %w", err)
+		}
+	}
+	if m.Backend != "" && m.Backend != BackendSendfax && m.Backend != BackendHylaFAX {
+		return fmt.Errorf("mail_to_fax: backend must be sendfax or hylafax")
+	}
+
+	m.tls = nil
+	if m.CertFile != "" || m.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(m.CertFile, m.KeyFile)
+		if err != nil {
+			return fmt.Errorf("mail_to_fax: error loading certificate: %w", err)
+		}
+		m.tls = &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+	}
+	return nil
+}
+
+// sender returns the rule authorizing a sender, logged in as user (or ""),
+// to fax to destnum, or nil if none does.
+func (m *MailToFax) sender(from, user, destnum string) *MailSender {
+	from = strings.ToLower(from)
+	for i := range m.Senders {
+		s := &m.Senders[i]
+		if s.User != "" && s.User != user {
+			continue
+		}
+		if !s.Destinations.empty() && !s.Destinations.Contains(destnum) {
+			continue
+		}
+		if len(s.Addresses) == 0 {
+			return s
+		}
+		for _, a := range s.Addresses {
+			if ok, _ := path.Match(strings.ToLower(a), from); ok {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+// recipient returns the number of a recipient address in one of the
+// domains.
+func (m *MailToFax) recipient(addr string) (string, bool) {
+	local, domain, ok := strings.Cut(addr, "@")
+	if !ok || !isDigits(local) {
+		return "", false
+	}
+	for _, d := range m.Domains {
+		if strings.EqualFold(d, domain) {
+			return local, true
+		}
+	}
+	return "", false
+}
+
+// mailRecipient is an authorized recipient of a message.
+type mailRecipient struct {
+	destnum string
+	sender  *MailSender
+}
+
+var errNoAttachment = errors.New("no PDF, TIFF or image attachment")
+
+// submit faxes every attachment of a message to each recipient, and
+// returns the submissions.
+func (m *MailToFax) submit(from string, msg []byte, rcpts []mailRecipient) ([]*Submission, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing message: %w", err)
+	}
+	var docs []string
+	defer func() {
+		for _, doc := range docs {
+			os.Remove(doc)
+		}
+	}()
+	err = walkAttachments(message.Header.Get("Content-Type"), message.Header.Get("Content-Transfer-Encoding"), "", message.Body, func(body io.Reader) error {
+		doc, err := saveDocument(body)
+		if errors.Is(err, errInvalidSend) {
+			return nil // Not a document, e.g. a signature
+		} else if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, errNoAttachment
+	}
+
+	var subs []*Submission
+	for _, rcpt := range rcpts {
+		for _, doc := range docs {
+			sub, err := relayer.Send(context.Background(), SendRequest{
+				Destnum: rcpt.destnum,
+				Cidnum:  rcpt.sender.CallerID,
+				Cidname: rcpt.sender.CallerName,
+				Backend: m.Backend,
+				Route:   m.Route,
+				Profile: m.Profile,
+			}, doc)
+			if err != nil {
+				return subs, fmt.Errorf("error faxing to %s: %w", rcpt.destnum, err)
+			}
+			log.WithFields(log.Fields{"from": from, "destnum": rcpt.destnum, "commid": sub.ID}).Info("Faxing mail attachment")
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+// documentMediaTypes are the media types of attachments that are faxed.
+var documentMediaTypes = map[string]bool{
+	"application/pdf": true,
+	"image/tiff":      true,
+	"image/png":       true,
+	"image/jpeg":      true,
+}
+
+// walkAttachments calls fn with the decoded body of every document in a
+// MIME entity, descending into multiparts. Untyped attachments are
+// included by their file name.
+func walkAttachments(contentType, encoding, filename string, body io.Reader, fn func(io.Reader) error) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("error reading message part: %w", err)
+			}
+			// NextPart has already decoded quoted-printable parts
+			err = walkAttachments(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part.FileName(), part, fn)
+			part.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if filename == "" {
+		filename = params["name"]
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".pdf", ".tif", ".tiff", ".png", ".jpg", ".jpeg":
+	default:
+		if !documentMediaTypes[mediaType] {
+			return nil
+		}
+	}
+	switch strings.ToLower(encoding) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	return fn(body)
+}
@@ -1,117 +1,26 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/fsnotify/fsnotify"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
-	"io"
-	"io/ioutil"
-	"net/http"
+	"net"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
-// LokiClient holds the configuration for the Loki client.
-type LokiClient struct {
-	PushURL  string // URL to Loki's push API
-	Username string // Username for basic auth
-	Password string // Password for basic auth
-}
-
-// LogEntry represents a single log entry.
-type LogEntry struct {
-	Timestamp string `json:"timestamp"`
-	Line      string `json:"line"`
-}
-
-// LokiPushData represents the data structure required by Loki's push API.
-type LokiPushData struct {
-	Streams []LokiStream `json:"streams"`
-}
-
-// LokiStream represents a stream of logs with the same labels in Loki.
-type LokiStream struct {
-	Stream map[string]string `json:"stream"`
-	Values [][2]string       `json:"values"` // Array of [timestamp, line] tuples
-}
-
-// NewLokiClient creates a new client to interact with Loki.
-func NewLokiClient(pushURL, username, password string) *LokiClient {
-	return &LokiClient{
-		PushURL:  pushURL,
-		Username: username,
-		Password: password,
-	}
-}
-
-// PushLog sends a log entry to Loki.
-func (c *LokiClient) PushLog(labels map[string]string, entry LogEntry) error {
-	// Prepare the payload
-	payload := LokiPushData{
-		Streams: []LokiStream{
-			{
-				Stream: labels,
-				Values: [][2]string{{entry.Timestamp, entry.Line}},
-			},
-		},
-	}
-
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("error marshaling json: %w", err)
-	}
-
-	// Create a new request
-	req, err := http.NewRequest("POST", c.PushURL, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	// Set basic auth if credentials are provided
-	if c.Username != "" && c.Password != "" {
-		req.SetBasicAuth(c.Username, c.Password)
-	}
-
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("error sending request to Loki: %w", err)
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-
-		}
-	}(resp.Body)
-
-	responseBody, _ := ioutil.ReadAll(resp.Body)
-	fmt.Println("Loki response:", string(responseBody)) // Print response body for debugging
-	marshal, err := json.Marshal(payload)
-	if err != nil {
-		return err
-	}
-	log.Warnf("Loki response: %s", string(marshal))
-
-	// Check the response status code
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("received non-200 response status: %d", resp.StatusCode)
-	}
-
-	return nil
-}
-
 // XFDirection is a custom type to represent the direction of the fax transmission.
 type XFDirection string
 
@@ -123,34 +32,47 @@ const (
 
 // XFRecord holds all data for a HylaFAX xferfaxlog record.
 type XFRecord struct {
-	Ts        time.Time   `json:"ts"`
-	Commid    string      `json:"commid,omitempty"`
-	Modem     string      `json:"modem,omitempty"`
-	Jobid     string      `json:"jobid,omitempty"`
-	Jobtag    string      `json:"jobtag,omitempty"`
-	Filename  string      `json:"filename,omitempty"`
-	Sender    string      `json:"sender,omitempty"`
-	Destnum   string      `json:"destnum,omitempty"`
-	RemoteID  string      `json:"remoteID,omitempty"`
-	Params    string      `json:"params,omitempty"`
-	Pages     uint        `json:"pages,omitempty"`
-	Jobtime   string      `json:"jobtime,omitempty"`
-	Conntime  string      `json:"conntime,omitempty"`
-	Reason    string      `json:"reason,omitempty"`
-	Cidname   string      `json:"cidname,omitempty"`
-	Cidnum    string      `json:"cidnum,omitempty"`
-	Owner     string      `json:"owner,omitempty"`
-	Dcs       string      `json:"dcs,omitempty"`
-	Direction XFDirection `json:"direction,omitempty"`
+	Ts         time.Time   `json:"ts"`
+	Commid     string      `json:"commid,omitempty"`
+	Modem      string      `json:"modem,omitempty"`
+	Jobid      string      `json:"jobid,omitempty"`
+	Jobtag     string      `json:"jobtag,omitempty"`
+	Filename   string      `json:"filename,omitempty"`
+	Sender     string      `json:"sender,omitempty"`
+	Destnum    string      `json:"destnum,omitempty"`
+	RemoteID   string      `json:"remoteID,omitempty"`
+	Params     string      `json:"params,omitempty"`
+	Pages      uint        `json:"pages,omitempty"`
+	Jobtime    string      `json:"jobtime,omitempty"`
+	Conntime   string      `json:"conntime,omitempty"`
+	Reason     string      `json:"reason,omitempty"`
+	Cidname    string      `json:"cidname,omitempty"`
+	Cidnum     string      `json:"cidnum,omitempty"`
+	Owner      string      `json:"owner,omitempty"`
+	Dcs        string      `json:"dcs,omitempty"`
+	Direction  XFDirection `json:"direction,omitempty"`
+	Text       string      `json:"text,omitempty"`        // OCR text of the first page of received faxes
+	ReasonCode string      `json:"reason_code,omitempty"` // Stable code of Reason, e.g. BUSY
+	ReasonType string      `json:"reason_type,omitempty"` // retryable or permanent for failed records
+	State      string      `json:"state,omitempty"`       // Job state of JOB records, e.g. active or done
+	Ndials     int         `json:"ndials,omitempty"`      // Consecutive failed dials of JOB records
+	Tottries   int         `json:"tottries,omitempty"`    // Attempts to send JOB records
 }
 
 var lokiURL, lokiUser, lokiPass, faxRetryCount string
 
-var processedFilePath string // New flag for log file path
+var store *Store
+var ocr *OCR
 var fsWatcher *fsnotify.Watcher
-var lokiClient *LokiClient
+var sinks atomic.Pointer[Sinks] // Replaced when the config is reloaded
+var relayer *Relayer
 
-func main() {
+// Timeouts of a relay attempt or send, and of pushing a record to a sink or
+// an event to a notifier. 0 disables them.
+var relayTimeout, pushTimeout = 30 * time.Minute, time.Minute
+
+// runBridge runs the bridge, and fax_notify next to it if withNotify is set.
+func runBridge(withNotify bool) {
 	var logFilePath string
 	var spoolerPath string
 	var logDirPath string // New variable for log directory path
@@ -159,39 +81,352 @@ func main() {
 	flag.StringVar(&spoolerPath, "spoolerPath", "/var/spool/hylafax", "Path to the spooler directory")
 	flag.StringVar(&logDirPath, "logDir", "./log", "Path to the log directory") // New flag for log directory
 
-	flag.StringVar(&lokiURL, "lokiURL", "", "URL to Loki's push API")
+	flag.StringVar(&lokiURL, "lokiURL", "", "URL to Loki's push API; a comma-separated list fails over between them")
 	flag.StringVar(&lokiUser, "lokiUser", "", "Username for Loki")
 	flag.StringVar(&lokiPass, "lokiPass", "", "Password for Loki")
+	secretFileFlag("lokiPass")
+	var lokiBatchSize int
+	var lokiBatchWait time.Duration
+	flag.IntVar(&lokiBatchSize, "lokiBatchSize", 100, "Maximum number of entries pushed to Loki in one request")
+	flag.DurationVar(&lokiBatchWait, "lokiBatchWait", 5*time.Second, "Maximum time entries are buffered before they are pushed to Loki")
+	var lokiSpoolDir, lokiFormat, lokiTenantID string
+	var lokiTLS TLSOptions
+	var lokiFanout bool
+	flag.BoolVar(&lokiFanout, "lokiFanout", false, "Push to all Loki URLs instead of failing over between them")
+	flag.StringVar(&lokiTenantID, "lokiTenantID", "", "Tenant sent as X-Scope-OrgID header to multi-tenant Loki")
+	flag.StringVar(&lokiTLS.CAFile, "lokiCACert", "", "PEM CA bundle to verify Loki's certificate with (default: system roots)")
+	flag.StringVar(&lokiTLS.CertFile, "lokiClientCert", "", "PEM client certificate for Loki")
+	flag.StringVar(&lokiTLS.KeyFile, "lokiClientKey", "", "PEM key of the Loki client certificate")
+	flag.BoolVar(&lokiTLS.InsecureSkipVerify, "lokiInsecureSkipVerify", false, "Do not verify Loki's certificate")
+	flag.StringVar(&lokiFormat, "lokiFormat", LokiFormatJSON, "Loki push format: json or protobuf (snappy-compressed, as sent by promtail)")
+	flag.StringVar(&lokiSpoolDir, "lokiSpoolDir", "", "Path batches are spooled to while Loki is unavailable (default: <logDir>/lokispool)")
+
+	var pushgatewayURL, pushgatewayJob, pushgatewayUser, pushgatewayPass string
+	var pushgatewayInterval time.Duration
+	flag.StringVar(&pushgatewayURL, "pushgatewayURL", "", "URL of a Prometheus Pushgateway to push metrics to")
+	flag.StringVar(&pushgatewayJob, "pushgatewayJob", "gofaxip_bridge", "Job name metrics are pushed to the Pushgateway under")
+	flag.StringVar(&pushgatewayUser, "pushgatewayUser", "", "Username for the Pushgateway")
+	flag.StringVar(&pushgatewayPass, "pushgatewayPass", "", "Password for the Pushgateway")
+	secretFileFlag("pushgatewayPass")
+	flag.DurationVar(&pushgatewayInterval, "pushgatewayInterval", 15*time.Second, "How often metrics are pushed to the Pushgateway")
+
+	var pprofAddr, metricsAddr string
+	flag.StringVar(&metricsAddr, "metricsAddr", ":9100", "Address to serve Prometheus metrics and health checks on")
+	var apiAddr, apiSource, apiAdminToken string
+	flag.StringVar(&apiAddr, "apiAddr", "", "Address to serve the fax history API on, e.g. :8080 (disabled if empty)")
+	flag.StringVar(&apiSource, "apiSource", "", "Name of a postgres sink the API queries instead of the bridge's database")
+	flag.StringVar(&apiAdminToken, "apiAdminToken", "", "Bearer token required by the admin endpoints of the API (disabled if empty)")
+	secretFileFlag("apiAdminToken")
+	var grpcAddr, smtpAddr, ippAddr string
+	flag.StringVar(&smtpAddr, "smtpAddr", "", "Address to accept mail to fax on, e.g. :2525, configured in mail_to_fax (disabled if empty)")
+	flag.StringVar(&ippAddr, "ippAddr", "", "Address to serve an IPP printer faxing printed documents on, e.g. :6310, configured in print_to_fax (disabled if empty)")
+	flag.StringVar(&grpcAddr, "grpcAddr", "", "Address to serve the gRPC API on, e.g. :9090 (disabled if empty)")
+	flag.StringVar(&pprofAddr, "pprofAddr", "", "Address to serve pprof profiles on, e.g. localhost:6060 (disabled if empty)")
+	metricsAccess := accessFlags("metrics", "metrics, health check and pprof endpoints")
+	apiAccess := accessFlags("api", "API, dashboard and gRPC API")
+	ippAccess := accessFlags("ipp", "IPP printer")
+	metricsTLS := serverTLSFlags("metrics", "metrics, health check and pprof endpoints")
+	apiTLS := serverTLSFlags("api", "API, dashboard and gRPC API")
+	ippTLS := serverTLSFlags("ipp", "IPP printer")
+
+	var ocrEnabled bool
+	var ocrLang string
+	var ocrTimeout time.Duration
+	flag.BoolVar(&ocrEnabled, "ocr", false, "Extract the text of the first page of received faxes with tesseract")
+	flag.StringVar(&ocrLang, "ocrLang", "eng", "tesseract language(s) used for OCR, e.g. eng+fra")
+	flag.DurationVar(&ocrTimeout, "ocrTimeout", time.Minute, "Maximum time OCR of a fax may take")
+	var ocrWorkers int
+	flag.IntVar(&ocrWorkers, "ocrWorkers", 2, "Number of faxes recognized at once")
+
+	var httpTimeout time.Duration
+	flag.DurationVar(&httpTimeout, "httpTimeout", 30*time.Second, "Maximum time Loki pushes, webhooks and hook calls may take")
 
 	flag.StringVar(&faxRetryCount, "faxRetryCount", "5", "Fax Retry Count")
 
+	var retryPolicy RetryPolicy
+	flag.IntVar(&retryPolicy.MaxAttempts, "relayMaxAttempts", 5, "Maximum relay attempts per received fax")
+	flag.DurationVar(&retryPolicy.BaseDelay, "relayBackoff", 30*time.Second, "Initial delay before retrying a failed relay")
+	flag.DurationVar(&retryPolicy.MaxDelay, "relayMaxBackoff", 30*time.Minute, "Maximum delay between relay retries")
+	flag.Float64Var(&retryPolicy.Jitter, "relayJitter", 0.2, "Random jitter fraction applied to relay retry delays")
+
+	var relayQueueDir string
+	var relayWorkers int
+	flag.StringVar(&relayQueueDir, "relayQueueDir", "", "Path to the persistent relay queue (default: <logDir>/relayq)")
+	flag.IntVar(&relayWorkers, "relayWorkers", 4, "Number of concurrent relay workers")
+
+	flag.DurationVar(&relayTimeout, "relayTimeout", relayTimeout, "Maximum time a relay attempt or send through a backend may take, including hooks (0 disables)")
+	flag.DurationVar(&pushTimeout, "pushTimeout", pushTimeout, "Maximum time pushing a record to a sink or an event to a notifier may take (0 disables)")
+
+	flag.IntVar(&maxLineSize, "maxLineSize", maxLineSize, "Maximum length of xferfaxlog lines in bytes; longer lines are skipped")
+
+	var runAsUser, runAsGroup, umask string
+	flag.StringVar(&runAsUser, "runAsUser", "", "User to switch to once the ports are bound, e.g. uucp (requires starting as root; default: keep running as the current user)")
+	flag.StringVar(&runAsGroup, "runAsGroup", "", "Group to switch to with runAsUser (default: the user's primary group)")
+	flag.StringVar(&umask, "umask", "", "Octal umask of the files and directories the bridge creates, e.g. 027 (default: inherited)")
+
+	var shutdownTimeout time.Duration
+	flag.DurationVar(&shutdownTimeout, "shutdownTimeout", 30*time.Second, "Maximum time to wait for running relays, and then for the sinks to flush, on SIGTERM or SIGINT")
+
+	var configPath string
+	var archiveDir, archivePolicy string
+	var archiveRetention time.Duration
+	var reportDir string
+	flag.StringVar(&archiveDir, "archiveDir", "", "Path to the archive of relayed faxes (default: <logDir>/archive)")
+	flag.StringVar(&archivePolicy, "archivePolicy", ArchivePolicyArchive, "What to do with relayed TIFFs: archive, delete or keep")
+	flag.StringVar(&reportDir, "reportDir", "", "Directory the traffic reports of the config are written to (default: <logDir>/reports)")
+	flag.DurationVar(&archiveRetention, "archiveRetention", 0, "How long to keep archived faxes (0 keeps them forever), unless retention.documents is configured")
+
+	var loopTag string
+	var loopWindow time.Duration
+	flag.StringVar(&loopTag, "loopTag", "gofaxip-bridge", "Jobtag marker set on relayed faxes; received faxes whose TSI contains it are not relayed")
+	flag.DurationVar(&loopWindow, "loopWindow", 0, "Faxes to and from the numbers a fax was relayed with within this window of the relay are treated as loops (0 disables)")
+
+	var duplicateWindow time.Duration
+	flag.DurationVar(&duplicateWindow, "duplicateWindow", 0, "Suppress relaying faxes with identical content, sender and page count received within this window (0 disables)")
+
+	var watchJobs bool
+	flag.BoolVar(&watchJobs, "watchJobs", false, "Push the progress of outbound jobs in sendq and doneq to the sinks")
+
+	var validateTiffs bool
+	var quarantineDir string
+	flag.BoolVar(&validateTiffs, "validateTiff", true, "Verify received TIFFs and their page count before relaying")
+	flag.StringVar(&quarantineDir, "quarantineDir", "", "Path TIFFs failing validation are moved to (default: <logDir>/quarantine)")
+
+	var dbPath string
+	flag.StringVar(&dbPath, "db", "", "Path to the SQLite database of processed records, relay attempts and events (default: <logDir>/bridge.db)")
+
+	flag.StringVar(&configPath, "config", "", "Path to the JSON, YAML or TOML config file (flags, routing, number rewriting, sendfax profiles, notifications, DID filter, relay backends, Loki labels, sinks, mail to fax, watch folder, print to fax, S3 archive, retention, reports, rating)")
+
 	flag.Parse()
+	if err := applyFlagEnv(); err != nil {
+		log.Fatalf("Invalid environment: %s", err)
+	}
+	if maxLineSize <= 0 {
+		log.Fatalf("Invalid maxLineSize: %d", maxLineSize)
+	}
+	if ocrWorkers <= 0 {
+		log.Fatalf("Invalid ocrWorkers: %d", ocrWorkers)
+	}
+
+	cfg := &Config{}
+	if configPath != "" {
+		var err error
+		if cfg, err = LoadConfig(configPath); err != nil {
+			log.Fatalf("Failed to load config: %s", err)
+		}
+		if err := applyConfigFlags(cfg.Flags); err != nil {
+			log.Fatalf("Failed to load config: %s: %s", configPath, err)
+		}
+	} else if err := cfg.compile(); err != nil {
+		log.Fatalf("Invalid default config: %s", err)
+	}
+	if err := applySecretFiles(); err != nil {
+		log.Fatalf("Failed to read secret: %s", err)
+	}
+	httpClient.Timeout = httpTimeout
+	metricsAuth, err := metricsAccess()
+	if err != nil {
+		log.Fatalf("Invalid metrics access: %s", err)
+	}
+	apiAuth, err := apiAccess()
+	if err != nil {
+		log.Fatalf("Invalid API access: %s", err)
+	}
+	ippAuth, err := ippAccess()
+	if err != nil {
+		log.Fatalf("Invalid IPP access: %s", err)
+	}
+	metricsTLSConfig, err := metricsTLS()
+	if err != nil {
+		log.Fatalf("Invalid metrics TLS: %s", err)
+	}
+	apiTLSConfig, err := apiTLS()
+	if err != nil {
+		log.Fatalf("Invalid API TLS: %s", err)
+	}
+	ippTLSConfig, err := ippTLS()
+	if err != nil {
+		log.Fatalf("Invalid IPP TLS: %s", err)
+	}
+	if apiAuth.requiresCredentials() && apiAdminToken != "" {
+		// Admin requests only carry the admin token
+		apiAuth.Tokens = append(apiAuth.Tokens, apiAdminToken)
+	}
 
 	taskQueue := make(chan Task)
 	//go processTasks(taskQueue)
 
-	if lokiURL != "" {
-		lokiClient = NewLokiClient(lokiURL, lokiUser, lokiPass)
-
-		marshal, err := json.Marshal(lokiClient)
+	if umask != "" {
+		mask, err := parseUmask(umask)
 		if err != nil {
-			return
+			log.Fatalf("Invalid umask: %s", err)
 		}
-		log.Info(string(marshal))
+		syscall.Umask(mask)
+	}
+
+	// Bind the ports while still privileged
+	metricsLis := listen("metrics", metricsAddr)
+	var apiLis, grpcLis, smtpLis, ippLis, pprofLis net.Listener
+	if apiAddr != "" {
+		apiLis = listen("the API", apiAddr)
+	}
+	if grpcAddr != "" {
+		grpcLis = listen("gRPC", grpcAddr)
+	}
+	if smtpAddr != "" {
+		smtpLis = listen("SMTP", smtpAddr)
+	}
+	if ippAddr != "" {
+		ippLis = listen("IPP", ippAddr)
+	}
+	if pprofAddr != "" {
+		pprofLis = listen("pprof", pprofAddr)
 	}
 
 	// Ensure log directory exists
 	if err := os.MkdirAll(logDirPath, os.ModePerm); err != nil {
 		log.Fatalf("Failed to create log directory: %s", err)
 	}
-	processedFilePath = filepath.Join(logDirPath, "processed_faxes.log") // Set the processed file path
+	if runAsUser != "" {
+		runAs, err := lookupRunAs(runAsUser, runAsGroup)
+		if err != nil {
+			log.Fatalf("Invalid runAsUser: %s", err)
+		}
+		// State outside logDir is only handed over if its path is given
+		paths := []string{logDirPath, relayQueueDir, archiveDir, reportDir, lokiSpoolDir, quarantineDir}
+		if dbPath != "" {
+			paths = append(paths, dbPath, dbPath+"-wal", dbPath+"-shm")
+		}
+		if err := runAs.chown(paths...); err != nil {
+			log.Fatalf("Failed to change ownership: %s", err)
+		}
+		if err := runAs.drop(); err != nil {
+			log.Fatalf("Failed to drop privileges: %s", err)
+		}
+	}
+	if dbPath == "" {
+		dbPath = filepath.Join(logDirPath, "bridge.db")
+	}
+	if store, err = OpenStore(dbPath); err != nil {
+		log.Fatalf("Failed to open database: %s", err)
+	}
+	defer store.Close()
+	if n, err := store.ImportProcessedLog(filepath.Join(logDirPath, "processed_faxes.log")); err != nil {
+		log.Fatalf("Failed to import processed_faxes.log: %s", err)
+	} else if n > 0 {
+		log.Infof("Imported %d processed lines from processed_faxes.log", n)
+	}
+
+	opened, err := OpenSinks(cfg.Sinks, logDirPath)
+	if err != nil {
+		log.Fatalf("Failed to open sinks: %s", err)
+	}
+	if lokiURL != "" {
+		if lokiSpoolDir == "" {
+			lokiSpoolDir = filepath.Join(logDirPath, "lokispool")
+		}
+		loki := &LokiSinkConfig{
+			URLs:       strings.Split(lokiURL, ","),
+			Username:   lokiUser,
+			Password:   lokiPass,
+			TenantID:   lokiTenantID,
+			Format:     lokiFormat,
+			Fanout:     lokiFanout,
+			TLS:        lokiTLS,
+			Timeout:    Duration{httpTimeout},
+			BatchSize:  lokiBatchSize,
+			BatchWait:  Duration{lokiBatchWait},
+			SpoolDir:   lokiSpoolDir,
+			LokiLabels: cfg.Loki,
+		}
+		sink, err := loki.Open("loki")
+		if err != nil {
+			log.Fatalf("Failed to start Loki client: %s", err)
+		}
+		opened = opened.With("loki", sink)
+	}
+	sinks.Store(&opened)
+
+	if relayQueueDir == "" {
+		relayQueueDir = filepath.Join(logDirPath, "relayq")
+	}
+	relayQueue, err := OpenRelayQueue(relayQueueDir)
+	if err != nil {
+		log.Fatalf("Failed to open relay queue: %s", err)
+	}
+	registerQueueMetrics(relayQueue)
+	if archiveDir == "" {
+		archiveDir = filepath.Join(logDirPath, "archive")
+	}
+	archiver, err := NewArchiver(archiveDir, archivePolicy)
+	if err != nil {
+		log.Fatalf("Failed to set up archive: %s", err)
+	}
+
+	dups, err := NewDuplicateFilter(duplicateWindow, filepath.Join(logDirPath, "duplicates.json"))
+	if err != nil {
+		log.Fatalf("Failed to load duplicate filter: %s", err)
+	}
+
+	tracker, err := NewDeliveryTracker(filepath.Join(logDirPath, "deliveries.json"))
+	if err != nil {
+		log.Fatalf("Failed to load delivery tracking: %s", err)
+	}
+
+	relayer = NewRelayer(spoolerPath, retryPolicy, relayQueue, archiver, NewLoopGuard(loopTag, loopWindow), dups, tracker, cfg)
+	if validateTiffs {
+		if quarantineDir == "" {
+			quarantineDir = filepath.Join(logDirPath, "quarantine")
+		}
+		relayer.QuarantineDir = quarantineDir
+	}
+	relayer.Store = store
+	(&Janitor{
+		Archiver:      archiver,
+		Queue:         relayQueue,
+		Store:         store,
+		SpoolDir:      spoolerPath,
+		QuarantineDir: relayer.QuarantineDir,
+		Documents:     archiveRetention,
+	}).Start()
+	if reportDir == "" {
+		reportDir = filepath.Join(logDirPath, "reports")
+	}
+	(&Reporter{Dir: reportDir}).Start()
+	if ocrEnabled {
+		ocr = &OCR{Lang: ocrLang, Timeout: ocrTimeout, SpoolDir: spoolerPath}
+	}
+	relayer.Start(relayWorkers)
+	if err := relayer.Resume(); err != nil {
+		log.Errorf("Failed to resume queued relays: %s", err)
+	}
 
 	log.Info("Starting up")
 
-	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		log.Fatal(http.ListenAndServe(":9100", nil))
-	}()
+	go serveHTTP(metricsLis, &Health{LogFile: logFilePath, SpoolerDir: spoolerPath}, metricsAuth, metricsTLSConfig)
+	api := &API{Source: apiSource, AdminToken: apiAdminToken, Access: apiAuth, TLS: apiTLSConfig}
+	if apiAddr != "" {
+		go serveAPI(apiLis, api)
+	}
+	if grpcAddr != "" {
+		go serveGRPC(grpcLis, api)
+	}
+	if smtpAddr != "" {
+		go serveSMTP(smtpLis)
+	}
+	if ippAddr != "" {
+		go serveIPP(ippLis, ippAuth, ippTLSConfig)
+	}
+	NewFolderWatcher().Start()
+	if withNotify {
+		startNotify(cfg, configPath != "")
+	}
+	if pprofAddr != "" {
+		startPprof(pprofLis, metricsAuth, metricsTLSConfig)
+	}
+	if pushgatewayURL != "" {
+		startPushgateway(pushgatewayURL, pushgatewayJob, pushgatewayUser, pushgatewayPass, pushgatewayInterval)
+	}
 	// Create a new watcher
 	watcher, err := fsnotify.NewWatcher()
 	fsWatcher = watcher
@@ -217,45 +452,104 @@ func main() {
 	// Add the file to the watcher initially
 	reAddFileToWatcher()
 
-	// Process file initially
-	go processFile(logFilePath, spoolerPath, taskQueue)
+	// All passes over the file run from the loop below, one at a time. Events
+	// arriving before a pending pass starts are folded into it, as HylaFAX
+	// writes a record in several steps. The first pass starts right away.
+	process := time.After(0)
 
-	// Watcher and polling loop
+	var reload <-chan struct{}
+	if configPath != "" {
+		reload = watchConfig(configPath)
+	}
+
+	var jobRecords <-chan XFRecord
+	if watchJobs {
+		jobs := NewJobWatcher(spoolerPath)
+		if err := jobs.Start(); err != nil {
+			log.Fatalf("Failed to watch jobs: %s", err)
+		}
+		jobRecords = jobs.Records()
+	}
+
+	// The watchdog is pinged from the loop, so systemd restarts the bridge
+	// when processing a record hangs, e.g. on a dead sink
+	pollInterval := 10 * time.Second
+	watchdog := sdWatchdogInterval()
+	if watchdog > 0 && watchdog/2 < pollInterval {
+		pollInterval = watchdog / 2
+	}
+	if err := sdNotify("READY=1"); err != nil {
+		log.Errorf("Error signaling readiness: %s", err)
+	}
+
+	// Cancelled on SIGTERM or SIGINT
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 	go func() {
-		for {
-			select {
-			case event := <-watcher.Events:
-				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove|fsnotify.Chmod) != 0 {
-					processFile(logFilePath, spoolerPath, taskQueue)
-					if event.Op&(fsnotify.Rename|fsnotify.Remove) != 0 {
-						reAddFileToWatcher()
-					}
+		sig := <-stop
+		log.Infof("Received %s, shutting down", sig)
+		cancel()
+	}()
+	if ocr != nil {
+		ocr.Start(ctx, ocrWorkers)
+	}
+
+	// Watcher and polling loop, left between runs of processFile on shutdown
+loop:
+	for {
+		if watchdog > 0 {
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				log.Errorf("Error pinging watchdog: %s", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-reload:
+			// Between runs of processFile, so no record is pushed to a closed sink
+			reloadConfig(configPath, logDirPath)
+		case job := <-ocr.Done():
+			relayer.Relay(job.entry)
+			finishRecord(ctx, job.line, job.entry)
+			ocr.finish(job.line)
+		case record := <-jobRecords:
+			log.WithFields(log.Fields{"jobid": record.Jobid, "state": record.State, "status": record.Reason}).Info("Job progress")
+			sinks.Load().Push(context.WithoutCancel(ctx), record)
+			recordBus.publish(record)
+		case event := <-watcher.Events:
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove|fsnotify.Chmod) != 0 {
+				if process == nil {
+					process = time.After(processDebounce)
+				}
+				if event.Op&(fsnotify.Rename|fsnotify.Remove) != 0 {
+					reAddFileToWatcher()
 				}
-			case err := <-watcher.Errors:
-				log.Errorf("Watcher error: %s", err)
-				reAddFileToWatcher() // Attempt to recover from watcher error
-			case <-time.After(10 * time.Second): // Polling interval
-				processFile(logFilePath, spoolerPath, taskQueue) // Periodic recheck
 			}
+		case err := <-watcher.Errors:
+			log.Errorf("Watcher error: %s", err)
+			reAddFileToWatcher() // Attempt to recover from watcher error
+		case <-process:
+			process = nil
+			processFile(ctx, logFilePath, spoolerPath, taskQueue)
+		case <-time.After(pollInterval): // Polling interval
+			processFile(ctx, logFilePath, spoolerPath, taskQueue) // Periodic recheck
 		}
-	}()
+	}
 
-	// Block forever
-	select {}
+	shutdown(shutdownTimeout)
 }
 
-// processFile processes the log file, skipping already processed lines
-func processFile(filePath string, spoolerDir string, queueTask chan Task) {
-	processedLines, err := readLines(processedFilePath)
-	if err != nil {
-		log.Errorf("Error reading processed lines log: %s", err)
-		return
-	}
-	processedLinesSet := make(map[string]struct{})
-	for _, line := range processedLines {
-		processedLinesSet[line] = struct{}{}
-	}
+// processDebounce is how long a pass over the xferfaxlog waits for further
+// changes after the first one.
+const processDebounce = 250 * time.Millisecond
 
+// processFile processes the log file, skipping already processed lines. Once
+// ctx is cancelled, the line being processed is finished and the rest are
+// left for the next run. It must not run concurrently, so it is only called
+// from the main loop.
+func processFile(ctx context.Context, filePath string, spoolerDir string, queueTask chan Task) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		log.Errorf("Error opening log file: %s", err)
@@ -268,89 +562,99 @@ func processFile(filePath string, spoolerDir string, queueTask chan Task) {
 		}
 	}(file)
 
-	scanner := bufio.NewScanner(file)
+	// HylaFAX appends records under an exclusive flock, so a partly
+	// written one is never read
+	if err := lockShared(ctx, file, logLockTimeout); err != nil {
+		log.Errorf("Error locking log file, retrying on the next change: %s", err)
+		return
+	}
+	logScans.Inc()
+
+	// Collect the unprocessed lines first so the backlog is known
+	var pending []string
+	oversized := 0
+	scanner := newLogScanner(file, maxLineSize, func(prefix []byte) {
+		oversized++
+		log.Errorf("Skipping xferfaxlog line longer than maxLineSize (%d bytes): %q...", maxLineSize, prefix)
+	})
 	for scanner.Scan() {
 		line := scanner.Text()
-		if _, processed := processedLinesSet[line]; processed {
-			continue // Skip already processed lines
+		if ocr.queued(line) {
+			continue
+		}
+		if processed, err := store.Processed(line); err != nil {
+			log.Errorf("Error checking processed lines: %s", err)
+			return
+		} else if !processed {
+			pending = append(pending, line)
 		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Errorf("Scanner error: %s", err)
+	}
+	logOversized.Set(float64(oversized))
 
+	// Lines failing to parse stay in the backlog
+	backlog := len(pending)
+	logBacklog.Set(float64(backlog))
+	for _, line := range pending {
+		if ctx.Err() != nil {
+			return
+		}
 		entry, err := parseLogLine(line, spoolerDir, queueTask)
 		if err != nil {
 			log.Errorf("ERROR: %s", err)
 			continue
 		}
 
-		log.Printf("%+v\n", entry)
-
-		err = appendToLogFile(line) // Append the processed line to the log
-		if err != nil {
-			log.Errorf("Error appending to processed lines log: %s", err)
-		}
-
-		// If Loki client is configured, send the log entry to Loki
-		if lokiClient != nil {
-			jsonData, err := json.Marshal(entry)
-			if err != nil {
-				log.Errorf("Failed to marshal log entry: %v", err)
-				continue
-			}
-
-			labels := map[string]string{"job": "xferfaxlog", "instance": "faxrelay"}
-			logEntry := LogEntry{
-				Timestamp: strconv.FormatInt(time.Now().UnixNano(), 10),
-				Line:      string(jsonData),
-			}
-			err = lokiClient.PushLog(labels, logEntry)
-			if err != nil {
-				fmt.Printf("Failed to push log to Loki: %v\n", err)
-			} else {
-				fmt.Println("Log pushed to Loki successfully.")
-			}
+		if ocr.recognizes(entry) {
+			// Relayed and processed once recognized, so a crash meanwhile
+			// leaves the line to be processed again
+			ocr.Submit(line, entry)
+		} else {
+			finishRecord(ctx, line, entry)
 		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		log.Errorf("Scanner error: %s", err)
+		backlog--
+		logBacklog.Set(float64(backlog))
 	}
 }
 
-// appendToLogFile appends a line to the processed faxes log file
-func appendToLogFile(line string) error {
-	f, err := os.OpenFile(processedFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
-	}
-	defer func(f *os.File) {
-		err := f.Close()
-		if err != nil {
+// finishRecord marks the line of a parsed record processed and hands the
+// record to the sinks. It is only called from the main loop, so no record is
+// pushed to a sink closed by a reload.
+func finishRecord(ctx context.Context, line string, entry XFRecord) {
+	log.Printf("%+v\n", entry)
+	observeRecord(entry)
 
-		}
-	}(f)
+	if err := store.MarkProcessed(line, entry); err != nil {
+		log.Errorf("Error storing processed line: %s", err)
+	}
 
-	_, err = f.WriteString(line + "\n")
-	return err
+	sinks.Load().Push(context.WithoutCancel(ctx), entry)
+	recordBus.publish(entry)
 }
 
-// readLines reads all lines from a file and returns them as a slice of strings
-func readLines(filePath string) ([]string, error) {
-	file, err := os.OpenFile(filePath, os.O_RDONLY|os.O_CREATE, 0644)
-	if err != nil {
-		return nil, err
-	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-
+// logLockTimeout is how long processFile waits for writers of the
+// xferfaxlog to release it.
+const logLockTimeout = 5 * time.Second
+
+// lockShared takes a shared flock on f, which is released when it is
+// closed, giving up after timeout.
+func lockShared(ctx context.Context, f *os.File, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			return err
+		}
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			return fmt.Errorf("%s: still locked after %s", f.Name(), timeout)
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-	}(file)
-
-	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
 	}
-	return lines, scanner.Err()
 }
 
 var recvPattern = `(?P<Date>\d{2}\/\d{2}\/\d{2} \d{2}:\d{2})\s+(?P<Direction>RECV)\s+(?P<CommID>\w+)\s+(?P<Modem>\w+)\s+(?P<Filename>\S+)\s+""\s+fax\s+"(?P<DestPhoneNumber>\d+)"\s+"(?P<RemoteID>[^"]*)"(\s+|)(?P<Params>\d+|)\t+(?P<Pages>\d+)\t(?P<JobTime>\d+:\d{2}:\d{2})\s+(?P<ConnTime>\d+:\d{2}:(\d{2}|\d{1}))(\t|)"(?P<Reason>[^"]*)"\s+""(?P<CIDName>[^"]*)""(\s+|)""(?P<CIDNumber>[^"]*)""(\s+(""+\s+|"")""+\s+"(?P<Dcs>[^"]*)"|)`
@@ -418,6 +722,7 @@ func parseLogLine(line string, spoolerDir string, taskQueue chan Task) (XFRecord
 	entry.Modem = match[r.SubexpIndex("Modem")]
 	entry.RemoteID = match[r.SubexpIndex("RemoteID")]
 	entry.Reason = match[r.SubexpIndex("Reason")]
+	entry.classify()
 
 	entry.Jobtime = match[r.SubexpIndex("JobTime")]
 	entry.Conntime = match[r.SubexpIndex("ConnTime")]
@@ -450,10 +755,10 @@ func parseLogLine(line string, spoolerDir string, taskQueue chan Task) (XFRecord
 			log.Warning("Failed to receive fax...")
 			return entry, nil
 		} else {
-			err := sendFax(entry, spoolerDir)
-			if err != nil {
-				log.Errorf("Failed to send fax: %s", err)
-				return entry, err
+			// With OCR, the fax is relayed once recognized so routes can
+			// match keywords
+			if !ocr.recognizes(entry) {
+				relayer.Relay(entry)
 			}
 			//taskQueue <- Task{spoolDir: spoolerDir, filename: entry.Filename}
 		}
@@ -461,6 +766,7 @@ func parseLogLine(line string, spoolerDir string, taskQueue chan Task) (XFRecord
 	case "SEND":
 		//sentFaxes.Inc()
 		log.Warning("Sent fax... not processing...")
+		relayer.Confirm(entry)
 		if entry.Reason != "OK" {
 			//failedRecv.Inc()
 			log.Warning("Failed to bridge fax...")
@@ -472,63 +778,6 @@ func parseLogLine(line string, spoolerDir string, taskQueue chan Task) (XFRecord
 		return entry, nil
 	}
 
-	/*// Create a temporary file for writing
-	tempFile, err := ioutil.TempFile("", "temp")
-	if err != nil {
-		log.Errorf("ERROR: %s", err)
-		return XFRecord{}, err // Make sure to return here to avoid nil pointer dereference
-	}
-
-	// Set file permissions to be readable and writable by all users
-	if err := tempFile.Chmod(0666); err != nil {
-		log.Errorf("ERROR: %s", err)
-		return XFRecord{}, err
-	}
-
-	// Read the file line by line
-	lines, err := readLines(logFilePath)
-	if err != nil {
-		log.Errorf("ERROR: %s", err)
-		return XFRecord{}, err
-	}
-
-	/*var removedLine string*/
-	/*for _, line1 := range lines {
-		if line1 == line {
-			//removedLine = line1
-			continue // Skip the line to remove
-		}
-		_, err := tempFile.WriteString(line1 + "\n") // It should be line1 here, not line
-		if err != nil {
-			log.Errorf("ERROR: %s", err)
-			return XFRecord{}, err
-		}
-	}
-
-	err = tempFile.Close()
-	if err != nil {
-		log.Errorf("ERROR: %s", err)
-	}*/
-
-	/*// Write the removed line to the log file
-	err = appendToLogFile(removedLine)
-	if err != nil {
-		log.Errorf("ERROR: %s", err)
-		return XFRecord{}, err
-	}*/
-
-	/*// Replace the original file with the temporary file
-	err = os.Rename(tempFile.Name(), logFilePath)
-	if err != nil {
-		log.Errorf("ERROR: %s", err)
-		return XFRecord{}, err
-	}
-
-	err = fsWatcher.Add(logFilePath)
-	if err != nil {
-		return XFRecord{}, err
-	}*/
-
 	return entry, nil
 }
 
@@ -554,49 +803,42 @@ func processTasks(taskQueue <-chan Task) {
 	}
 }
 
-func sendFax(entry XFRecord, spoolDir string) error {
-	time.Sleep(2 * time.Second) // wait for fax to be written to disk
+// sendFax submits the received fax to sendfax and returns its combined output.
+func sendFax(ctx context.Context, entry XFRecord, path string, jobtag string, route *Route, profile SendfaxProfile) (string, error) {
+	// wait for fax to be written to disk
+	select {
+	case <-time.After(2 * time.Second):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
 	// Example command: sendfax -d destination_number -c caller_id file_path
 	log.Info("Sending fax...")
-	//log.Warning("/bin/bash", "-c", "sendfax", "-o", entry.SrcPhoneNumber, "-d", entry.DstPhoneNumber, "-c", entry.CallerID, fmt.Sprintf("%s/%s", spoolDir, entry.FilePath))
 	// sendfax -n -S 2507620300 -c "TOPS Telecom" -d 2508591501 /var/spool/hylafax/recvq/fax00000343.tif
-	log.Warn("sendfax" +
-		" -n -S " + entry.Cidnum +
-		" -o " + entry.Cidnum +
-		" -c \"" + entry.Cidname +
-		"\" -k \"now + 2 days\"" +
-		" -T " + faxRetryCount +
-		" -t " + faxRetryCount +
-		//" -I \"10min\"" +
-		" -d " + entry.Destnum +
-		" " + fmt.Sprintf("%s/%s", spoolDir, entry.Filename))
-	cmd := exec.Command("/bin/bash", "-c", "sendfax"+
-		" -n -S "+entry.Cidnum+
-		" -o "+entry.Cidnum+
-		" -c \""+entry.Cidname+
-		"\" -k \"now + 2 days\""+
-		" -T "+faxRetryCount+
-		" -t "+faxRetryCount+
-		//" -I 10min"+
-		" -d "+entry.Destnum+
-		" "+fmt.Sprintf("%s/%s", spoolDir, entry.Filename))
-
-	_, err := cmd.CombinedOutput()
+	args := []string{
+		"-n",
+		"-S", entry.Cidnum,
+		"-o", entry.Cidnum,
+		"-c", entry.Cidname,
+		"-i", jobtag,
+	}
+	args = append(args, profile.sendfaxArgs()...)
+	if route != nil {
+		log.Infof("Using route %q", route.Name)
+		args = append(args, route.sendfaxArgs()...)
+	}
+	args = append(args,
+		"-d", entry.Destnum,
+		path)
+
+	log.Warnf("sendfax %q", args)
+	cmd := exec.CommandContext(ctx, "sendfax", args...)
+	cmd.WaitDelay = time.Second // Children of a killed sendfax may hold its output open
+
+	output, err := cmd.CombinedOutput()
 	//log.Info(string(output))
 	if err != nil {
-		return fmt.Errorf("sendfax command failed: %w", err)
-	}
-
-	// Delete the fax file after sending
-	err = os.Remove(fmt.Sprintf("%s/%s", spoolDir, entry.Filename))
-	if err != nil {
-		log.Errorf("Failed to delete fax file: %s", err)
-		return err
+		return string(output), fmt.Errorf("sendfax command failed: %w", err)
 	}
 
-	log.Info("Fax file deleted successfully")
-
-	// todo convert file deletion to a cronjob
-
-	return nil
+	return string(output), nil
 }
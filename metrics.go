@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "gofaxip_bridge"
+
+var (
+	faxesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "faxes_received_total",
+		Help:      "Faxes received (RECV records with reason OK).",
+	}, []string{"direction", "modem"})
+
+	faxesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "faxes_sent_total",
+		Help:      "Faxes sent (SEND records with reason OK).",
+	}, []string{"direction", "modem"})
+
+	faxesRelayed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "faxes_relayed_total",
+		Help:      "Received faxes handed to all relay backends.",
+	}, []string{"direction", "modem"})
+
+	faxesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "faxes_failed_total",
+		Help:      "Failed fax transmissions by reason class, and relays that permanently failed (reason_class relay_failed).",
+	}, []string{"direction", "modem", "reason_class"})
+
+	pagesTransferred = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "pages_total",
+		Help:      "Pages transferred.",
+	}, []string{"direction", "modem"})
+
+	connDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "conntime_seconds",
+		Help:      "Connection time of fax transmissions.",
+		Buckets:   durationBuckets,
+	}, []string{"direction", "modem"})
+
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "jobtime_seconds",
+		Help:      "Job time of fax transmissions, including negotiation.",
+		Buckets:   durationBuckets,
+	}, []string{"direction", "modem"})
+)
+
+var (
+	logBacklog = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "xferfaxlog_backlog_lines",
+		Help:      "Unprocessed xferfaxlog lines of the current scan.",
+	})
+
+	logOversized = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "xferfaxlog_oversized_lines",
+		Help:      "xferfaxlog lines of the current scan skipped for exceeding maxLineSize.",
+	})
+
+	logScans = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "xferfaxlog_scans_total",
+		Help:      "Passes over the xferfaxlog looking for new lines.",
+	})
+
+	configReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "config_reloads_total",
+		Help:      "Config reloads by result (ok or error).",
+	}, []string{"result"})
+
+	lokiSpooledBatches = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "loki_spooled_batches",
+		Help:      "Batches spooled to disk waiting for Loki to accept them.",
+	}, []string{"sink"})
+
+	sinkLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "sink_last_success_timestamp_seconds",
+		Help:      "Time of the last successful push to the sink.",
+	}, []string{"sink"})
+)
+
+var (
+	sinkPushes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "sink_push_attempts_total",
+		Help:      "Push attempts to the sink, including retries.",
+	}, []string{"sink"})
+
+	sinkFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "sink_push_failures_total",
+		Help:      "Failed pushes to the sink by HTTP status code (error for other failures).",
+	}, []string{"sink", "code"})
+
+	sinkRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "sink_push_retries_total",
+		Help:      "Pushes to the sink retried after a failure.",
+	}, []string{"sink"})
+
+	sinkDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "sink_dropped_records_total",
+		Help:      "Records that were given up on and never reached the sink.",
+	}, []string{"sink"})
+
+	s3ArchiveUploads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "s3_archive_uploads_total",
+		Help:      "Objects uploaded to the S3 archive by format (tif, pdf or json) and result (ok or error).",
+	}, []string{"format", "result"})
+
+	retentionPurged = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "retention_purged_total",
+		Help:      "Items purged past their retention by kind (document, metadata, record, relay_attempt, event, spool or quarantine).",
+	}, []string{"kind"})
+
+	retentionLastRun = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "retention_last_run_timestamp_seconds",
+		Help:      "Time the retention janitor last ran.",
+	})
+)
+
+// countPush counts a push attempt to a sink and its failure.
+func countPush(sink string, err error) {
+	trackSinkError(sink, err)
+	sinkPushes.WithLabelValues(sink).Inc()
+	if err != nil {
+		sinkFailures.WithLabelValues(sink, statusCode(err)).Inc()
+	}
+}
+
+// statusCode returns the HTTP status of a failed request, or "error".
+func statusCode(err error) string {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return strconv.Itoa(statusErr.StatusCode)
+	}
+	return "error"
+}
+
+// registerQueueMetrics exports the depth of the relay queue.
+func registerQueueMetrics(q *RelayQueue) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_queue_depth",
+		Help:      "Relay jobs waiting in the relay queue.",
+	}, func() float64 {
+		n, err := q.Len()
+		if err != nil {
+			return -1
+		}
+		return float64(n)
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_queue_failed",
+		Help:      "Relay jobs that permanently failed and are kept in failed/.",
+	}, func() float64 {
+		n, err := q.FailedLen()
+		if err != nil {
+			return -1
+		}
+		return float64(n)
+	})
+}
+
+// durationBuckets suit fax calls, which take from seconds to several minutes.
+var durationBuckets = []float64{5, 10, 20, 30, 45, 60, 90, 120, 180, 300, 600, 1200}
+
+// observeRecord counts a processed xferfaxlog record.
+func observeRecord(r XFRecord) {
+	modems.observe(r)
+
+	direction := string(r.Direction)
+	pagesTransferred.WithLabelValues(direction, r.Modem).Add(float64(r.Pages))
+	if r.Conntime != "" {
+		connDuration.WithLabelValues(direction, r.Modem).Observe(hmsSeconds(r.Conntime))
+	}
+	if r.Jobtime != "" {
+		jobDuration.WithLabelValues(direction, r.Modem).Observe(hmsSeconds(r.Jobtime))
+	}
+
+	if !reasonOK(r.Reason) {
+		faxesFailed.WithLabelValues(direction, r.Modem, reasonClass(r.Reason)).Inc()
+		return
+	}
+	switch r.Direction {
+	case XflRECV:
+		faxesReceived.WithLabelValues(direction, r.Modem).Inc()
+	case XflSEND:
+		faxesSent.WithLabelValues(direction, r.Modem).Inc()
+	}
+}
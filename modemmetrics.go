@@ -0,0 +1,131 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// modemFailureWindow is the window of the rolling failure ratio.
+const modemFailureWindow = time.Hour
+
+var (
+	modemLastSuccessDesc = prometheus.NewDesc(metricsNamespace+"_modem_last_success_age_seconds",
+		"Seconds since the last successful record of the modem.", []string{"direction", "modem"}, nil)
+	modemRelaysDesc = prometheus.NewDesc(metricsNamespace+"_modem_relays_in_progress",
+		"Relay attempts of faxes received on the modem that are in progress.", []string{"modem"}, nil)
+	modemFailureDesc = prometheus.NewDesc(metricsNamespace+"_modem_failure_ratio",
+		"Ratio of failed records of the modem during the last hour.", []string{"direction", "modem"}, nil)
+)
+
+type modemKey struct {
+	direction XFDirection
+	modem     string
+}
+
+type modemResult struct {
+	time   time.Time
+	failed bool
+}
+
+// modemStats tracks per-modem activity for the modem gauges.
+type modemStats struct {
+	mu          sync.Mutex
+	lastSuccess map[modemKey]time.Time
+	results     map[modemKey][]modemResult
+	relays      map[string]int
+}
+
+var modems = &modemStats{
+	lastSuccess: make(map[modemKey]time.Time),
+	results:     make(map[modemKey][]modemResult),
+	relays:      make(map[string]int),
+}
+
+func init() {
+	prometheus.MustRegister(modems)
+}
+
+// observe records the outcome of a record.
+func (m *modemStats) observe(r XFRecord) {
+	if r.Modem == "" {
+		return
+	}
+	key := modemKey{r.Direction, r.Modem}
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ok := reasonOK(r.Reason)
+	if ok {
+		ts := r.Ts
+		if ts.IsZero() || ts.After(now) {
+			ts = now
+		}
+		if ts.After(m.lastSuccess[key]) {
+			m.lastSuccess[key] = ts
+		}
+	}
+	m.results[key] = append(pruneResults(m.results[key], now), modemResult{time: now, failed: !ok})
+}
+
+// relayStarted and relayDone count in-progress relays of faxes received on a modem.
+func (m *modemStats) relayStarted(modem string) {
+	m.mu.Lock()
+	m.relays[modem]++
+	m.mu.Unlock()
+}
+
+func (m *modemStats) relayDone(modem string) {
+	m.mu.Lock()
+	m.relays[modem]--
+	m.mu.Unlock()
+}
+
+// pruneResults drops results older than the failure window.
+func pruneResults(results []modemResult, now time.Time) []modemResult {
+	i := 0
+	for i < len(results) && now.Sub(results[i].time) > modemFailureWindow {
+		i++
+	}
+	return results[i:]
+}
+
+func (m *modemStats) Describe(ch chan<- *prometheus.Desc) {
+	ch <- modemLastSuccessDesc
+	ch <- modemRelaysDesc
+	ch <- modemFailureDesc
+}
+
+func (m *modemStats) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, t := range m.lastSuccess {
+		ch <- prometheus.MustNewConstMetric(modemLastSuccessDesc, prometheus.GaugeValue,
+			now.Sub(t).Seconds(), string(key.direction), key.modem)
+	}
+	for modem, n := range m.relays {
+		ch <- prometheus.MustNewConstMetric(modemRelaysDesc, prometheus.GaugeValue, float64(n), modem)
+	}
+	for key, results := range m.results {
+		results = pruneResults(results, now)
+		m.results[key] = results
+
+		ratio := 0.0
+		if len(results) > 0 {
+			failed := 0
+			for _, r := range results {
+				if r.failed {
+					failed++
+				}
+			}
+			ratio = float64(failed) / float64(len(results))
+		}
+		ch <- prometheus.MustNewConstMetric(modemFailureDesc, prometheus.GaugeValue, ratio, string(key.direction), key.modem)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A Notifier delivers events to operators.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// NotifyConfig configures where events are delivered.
+type NotifyConfig struct {
+	Webhook *WebhookNotifier `json:"webhook,omitempty"`
+	Email   *EmailNotifier   `json:"email,omitempty"`
+	SMS     *SMSNotifier     `json:"sms,omitempty"`
+	Slack   *SlackNotifier   `json:"slack,omitempty"`
+	Teams   *TeamsNotifier   `json:"teams,omitempty"`
+	Discord *DiscordNotifier `json:"discord,omitempty"`
+}
+
+// notifiers returns all configured notifiers.
+func (c NotifyConfig) notifiers() Notifiers {
+	var n Notifiers
+	if c.Webhook != nil {
+		n = append(n, c.Webhook)
+	}
+	if c.Email != nil {
+		n = append(n, c.Email)
+	}
+	if c.SMS != nil {
+		n = append(n, c.SMS)
+	}
+	if c.Slack != nil {
+		n = append(n, c.Slack)
+	}
+	if c.Teams != nil {
+		n = append(n, c.Teams)
+	}
+	if c.Discord != nil {
+		n = append(n, c.Discord)
+	}
+	return n
+}
+
+// compile validates the notifiers and parses their templates.
+func (c *NotifyConfig) compile(routes RoutingTable) error {
+	if c.Webhook != nil {
+		if err := c.Webhook.compile(); err != nil {
+			return err
+		}
+	}
+	if c.Email != nil {
+		if err := c.Email.compile(); err != nil {
+			return err
+		}
+	}
+	if c.SMS != nil {
+		if err := c.SMS.compile(routes); err != nil {
+			return err
+		}
+	}
+	if c.Slack != nil {
+		if err := c.Slack.compile(); err != nil {
+			return err
+		}
+	}
+	if c.Teams != nil {
+		if err := c.Teams.compile(); err != nil {
+			return err
+		}
+	}
+	if c.Discord != nil {
+		if err := c.Discord.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseNotifyTemplate parses a Go template over the Event, or returns nil if
+// text is empty. Besides the builtins, templates can use upper, lower,
+// replace, hostname and json (which encodes a value as JSON).
+func parseNotifyTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	hostname, _ := os.Hostname()
+	funcs := template.FuncMap{
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"replace":  strings.ReplaceAll,
+		"hostname": func() string { return hostname },
+		"slack":    slackEscape,
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}
+	t, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return t, nil
+}
+
+// renderEvent executes the template over the event.
+func renderEvent(t *template.Template, event Event) (string, error) {
+	var out bytes.Buffer
+	if err := t.Execute(&out, event); err != nil {
+		return "", fmt.Errorf("error rendering %s: %w", t.Name(), err)
+	}
+	return out.String(), nil
+}
+
+// Notifiers delivers events to several notifiers.
+type Notifiers []Notifier
+
+// Notify delivers the event to all notifiers in the background and logs
+// failures. Each notifier has up to pushTimeout.
+func (n Notifiers) Notify(event Event) {
+	for _, notifier := range n {
+		go func(notifier Notifier) {
+			ctx, cancel := withTimeout(context.Background(), pushTimeout)
+			defer cancel()
+			if err := notifier.Notify(ctx, event); err != nil {
+				log.WithFields(event.Fields()).Errorf("Error sending notification: %s", err)
+			}
+		}(notifier)
+	}
+}
+
+// eventFilter limits a notifier to some event types. An empty filter accepts
+// all events but fax_received, which would be sent for every fax.
+type eventFilter []string
+
+func (f eventFilter) accepts(eventType string) bool {
+	if len(f) == 0 {
+		return eventType != EventReceived
+	}
+	for _, t := range f {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookNotifier posts events as JSON, or rendered through a template, to
+// an HTTP endpoint.
+type WebhookNotifier struct {
+	URL         string      `json:"url"`
+	Username    string      `json:"username,omitempty"`
+	Password    string      `json:"password,omitempty"`
+	Template    string      `json:"template,omitempty"`     // Go template over the event rendering the body
+	ContentType string      `json:"content_type,omitempty"` // Content type of the body (default: application/json)
+	Events      eventFilter `json:"events,omitempty"`
+	TLS         TLSOptions  `json:"tls"` // Private CA and client certificate, e.g. for mutual TLS
+
+	template *template.Template
+	client   *http.Client
+}
+
+// compile parses the body template.
+func (w *WebhookNotifier) compile() error {
+	if w.ContentType == "" {
+		w.ContentType = "application/json"
+	}
+	var err error
+	if w.client, err = w.TLS.client(); err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	w.template, err = parseNotifyTemplate("webhook template", w.Template)
+	return err
+}
+
+// Notify posts the event to the webhook.
+func (w *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	if !w.Events.accepts(event.Type) {
+		return nil
+	}
+	err := w.post(ctx, event)
+	countPush("notify_webhook", err)
+	if err != nil {
+		sinkDropped.WithLabelValues("notify_webhook").Inc()
+	}
+	return err
+}
+
+func (w *WebhookNotifier) post(ctx context.Context, event Event) error {
+	var body []byte
+	if w.template != nil {
+		text, err := renderEvent(w.template, event)
+		if err != nil {
+			return err
+		}
+		body = []byte(text)
+	} else {
+		var err error
+		if body, err = json.Marshal(event); err != nil {
+			return fmt.Errorf("error marshaling json: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", w.ContentType)
+	if w.Username != "" && w.Password != "" {
+		req.SetBasicAuth(w.Username, w.Password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+const (
+	defaultNotifySubject = `Fax {{replace .Type "_" " "}}: {{.Commid}}`
+	defaultNotifyBody    = `Event:       {{.Type}}
+Time:        {{.Time.Format "2006-01-02 15:04:05 MST"}}
+CommID:      {{.Commid}}
+Caller:      {{.Cidnum}} {{.Cidname}}
+Destination: {{.Destnum}}
+Attempts:    {{.Attempts}}
+{{- if .Error}}
+Error:       {{.Error}}
+{{- end}}
+{{- if .Output}}
+
+sendfax output:
+{{.Output}}
+{{- end}}
+`
+)
+
+// EmailNotifier sends events as plain-text email.
+type EmailNotifier struct {
+	Server   string      `json:"server"` // SMTP server as host:port
+	From     string      `json:"from"`
+	To       []string    `json:"to"`
+	Username string      `json:"username,omitempty"`
+	Password string      `json:"password,omitempty"`
+	Subject  string      `json:"subject,omitempty"` // Go template over the event
+	Body     string      `json:"body,omitempty"`    // Go template over the event
+	Events   eventFilter `json:"events,omitempty"`
+
+	subject *template.Template
+	body    *template.Template
+}
+
+// compile parses the subject and body templates.
+func (e *EmailNotifier) compile() error {
+	subject, body := e.Subject, e.Body
+	if subject == "" {
+		subject = defaultNotifySubject
+	}
+	if body == "" {
+		body = defaultNotifyBody
+	}
+	var err error
+	if e.subject, err = parseNotifyTemplate("email subject", subject); err != nil {
+		return err
+	}
+	e.body, err = parseNotifyTemplate("email body", body)
+	return err
+}
+
+// Notify mails the event to all recipients.
+func (e *EmailNotifier) Notify(ctx context.Context, event Event) error {
+	if !e.Events.accepts(event.Type) {
+		return nil
+	}
+	subject, err := renderEvent(e.subject, event)
+	if err != nil {
+		return err
+	}
+	body, err := renderEvent(e.body, event)
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", encodeSubject(subject))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return sendMail(ctx, e.Server, smtpAuth(e.Server, e.Username, e.Password), e.From, e.To, msg.Bytes())
+}
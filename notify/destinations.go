@@ -0,0 +1,186 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// webhookDestination is a webhook endpoint with the jobs it is notified of.
+// Empty filters match every job.
+type webhookDestination struct {
+	Name         string   `json:"name"`
+	URL          string   `json:"url"`
+	Username     string   `json:"username,omitempty"`
+	Password     string   `json:"password,omitempty"`
+	Secret       string   `json:"secret,omitempty"`       // Shared secret requests are signed with (default: WEBHOOK_SECRET)
+	SecretFile   string   `json:"secret_file,omitempty"`  // File holding the shared secret instead
+	Format       string   `json:"format,omitempty"`       // Body format, multipart or json (default: WEBHOOK_FORMAT)
+	Reasons      []string `json:"reasons,omitempty"`      // Reasons notified (default: NOTIFY_REASONS)
+	Sources      []string `json:"sources,omitempty"`      // Prefixes of the source number (src_cid)
+	Destinations []string `json:"destinations,omitempty"` // Prefixes of the destination number (dest_num)
+	Owners       []string `json:"owners,omitempty"`       // Exact job owners (src_num)
+}
+
+// destinations holds the webhook endpoints by name, in configured order.
+var destinations []*webhookDestination
+
+// loadDestinations reads the webhook endpoints from the JSON file in
+// WEBHOOKS_FILE, or uses WEBHOOK_URL as single endpoint without filters.
+func loadDestinations() error {
+	name := os.Getenv("WEBHOOKS_FILE")
+	if name == "" && os.Getenv("WEBHOOK_URL") == "" {
+		// Only emails are sent
+		return nil
+	}
+	defaultSecret, err := webhookSecret(os.Getenv("WEBHOOK_SECRET"), os.Getenv("WEBHOOK_SECRET_FILE"))
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		destinations = []*webhookDestination{{
+			Name:     "default",
+			URL:      os.Getenv("WEBHOOK_URL"),
+			Username: os.Getenv("WEBHOOK_USERNAME"),
+			Password: os.Getenv("WEBHOOK_PASSWORD"),
+			Secret:   defaultSecret,
+			Format:   os.Getenv("WEBHOOK_FORMAT"),
+		}}
+		return nil
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("error reading webhooks file: %w", err)
+	}
+	if err := json.Unmarshal(data, &destinations); err != nil {
+		return fmt.Errorf("error parsing webhooks file: %w", err)
+	}
+	seen := make(map[string]bool)
+	for i, d := range destinations {
+		if d.Name == "" {
+			d.Name = fmt.Sprintf("webhook%d", i+1)
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("duplicate webhook name: %s", d.Name)
+		}
+		seen[d.Name] = true
+		if d.URL == "" {
+			return fmt.Errorf("webhook %s: missing url", d.Name)
+		}
+		if d.Format == "" {
+			d.Format = os.Getenv("WEBHOOK_FORMAT")
+		}
+		if d.Secret, err = webhookSecret(d.Secret, d.SecretFile); err != nil {
+			return fmt.Errorf("webhook %s: %w", d.Name, err)
+		}
+		if d.Secret == "" {
+			d.Secret = defaultSecret
+		}
+		if d.Format != "" && d.Format != formatMultipart && d.Format != formatJSON {
+			return fmt.Errorf("webhook %s: unknown format: %s", d.Name, d.Format)
+		}
+	}
+	return nil
+}
+
+// webhookSecret returns secret, or else the content of file without
+// trailing newlines.
+func webhookSecret(secret, file string) (string, error) {
+	if secret != "" || file == "" {
+		return secret, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("error reading webhook secret: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// format returns the body format of the endpoint.
+func (d *webhookDestination) format() string {
+	if d.Format == formatJSON {
+		return formatJSON
+	}
+	return formatMultipart
+}
+
+// destination returns the endpoint with the name, or nil.
+func destination(name string) *webhookDestination {
+	if name == "" {
+		name = "default"
+	}
+	for _, d := range destinations {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// wantsReason reports whether the endpoint is notified for the reason.
+func (d *webhookDestination) wantsReason(why string) bool {
+	if len(d.Reasons) == 0 {
+		return notifyReasons[why]
+	}
+	for _, r := range d.Reasons {
+		if r == why {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the endpoint is notified of the job.
+func (d *webhookDestination) matches(data QFileData) bool {
+	return d.wantsReason(data.Why) &&
+		matchPrefix(d.Sources, data.SrcCid) &&
+		matchPrefix(d.Destinations, data.DestNum) &&
+		matchExact(d.Owners, data.SrcNum)
+}
+
+// wantsAnyReason reports whether any endpoint, or email, is notified for the reason.
+func wantsAnyReason(why string) bool {
+	for _, d := range destinations {
+		if d.wantsReason(why) {
+			return true
+		}
+	}
+	return mailer != nil && mailer.wantsReason(why)
+}
+
+// matchingDestinations returns the endpoints notified of the job.
+func matchingDestinations(data QFileData) []*webhookDestination {
+	var matched []*webhookDestination
+	for _, d := range destinations {
+		if d.matches(data) {
+			matched = append(matched, d)
+		}
+	}
+	return matched
+}
+
+func matchPrefix(prefixes []string, s string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchExact(values []string, s string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
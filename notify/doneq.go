@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// HylaFAX job states of finished jobs, as stored in the qfile state tag.
+const (
+	jobStateDone   = 7
+	jobStateFailed = 8
+)
+
+var qfileName = regexp.MustCompile(`^q\d+$`)
+
+// watchDoneq sends webhooks for jobs whose qfiles faxq moves to doneq/ when
+// they are finished, without depending on the journal. docq/ is not watched,
+// as documents are put there on submission; they are read from it until
+// faxqclean removes them.
+func watchDoneq(dir string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error creating watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(dir); err != nil {
+		return fmt.Errorf("error watching %s: %w", dir, err)
+	}
+	log.Infof("Watching %s for finished jobs", dir)
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// faxq renames finished qfiles into doneq/
+			if event.Op&fsnotify.Create == 0 || !qfileName.MatchString(filepath.Base(event.Name)) {
+				continue
+			}
+			handleDoneq(event.Name)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Errorf("Watcher error: %s", err)
+		}
+	}
+}
+
+// handleDoneq sends a webhook for a finished job in doneq/.
+func handleDoneq(filePath string) {
+	log.Info("filePath: " + filePath)
+
+	qfileContents, err := readQfile(filePath)
+	if err != nil {
+		log.Errorf("Error reading qfile: %s", err)
+		return
+	}
+	switch qfileContents.State {
+	case jobStateFailed:
+		notify(qfileContents, "failed")
+	case jobStateDone:
+		notify(qfileContents, "done")
+	default:
+		log.Warnf("Unexpected job state %d in %s", qfileContents.State, filePath)
+	}
+}
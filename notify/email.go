@@ -0,0 +1,228 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultEmailSubject = `Fax to {{.DestNum}} {{.Why}}`
+	defaultEmailBody    = `Fax job {{.JobID}} to {{.DestNum}} ({{.Pages}} pages): {{.Why}} after {{.TotalDials}} dials.
+
+Status: {{.Status}}
+`
+)
+
+// emailNotifier mails notifications with the PDF attached, configured by the
+// SMTP_* environment variables.
+type emailNotifier struct {
+	server   string // host:port
+	from     string
+	to       []string
+	username string
+	password string
+	tls      bool // Implicit TLS (port 465) instead of STARTTLS
+	reasons  map[string]bool
+	subject  *template.Template
+	body     *template.Template
+}
+
+// loadEmailNotifier returns the email notifier, or nil if SMTP_SERVER is not set.
+func loadEmailNotifier() (*emailNotifier, error) {
+	server := os.Getenv("SMTP_SERVER")
+	if server == "" {
+		return nil, nil
+	}
+	e := &emailNotifier{
+		server:   server,
+		from:     os.Getenv("SMTP_FROM"),
+		to:       splitList(os.Getenv("SMTP_TO")),
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		tls:      os.Getenv("SMTP_TLS") == "tls",
+	}
+	if e.from == "" || len(e.to) == 0 {
+		return nil, fmt.Errorf("SMTP_SERVER requires SMTP_FROM and SMTP_TO")
+	}
+	if reasons := splitList(os.Getenv("SMTP_REASONS")); len(reasons) > 0 {
+		e.reasons = make(map[string]bool, len(reasons))
+		for _, why := range reasons {
+			e.reasons[why] = true
+		}
+	}
+
+	subject, body := os.Getenv("SMTP_SUBJECT"), os.Getenv("SMTP_BODY")
+	if subject == "" {
+		subject = defaultEmailSubject
+	}
+	if body == "" {
+		body = defaultEmailBody
+	}
+	var err error
+	if e.subject, err = template.New("subject").Parse(subject); err != nil {
+		return nil, fmt.Errorf("SMTP_SUBJECT: %w", err)
+	}
+	// .env values cannot span lines
+	if e.body, err = template.New("body").Parse(strings.ReplaceAll(body, `\n`, "\n")); err != nil {
+		return nil, fmt.Errorf("SMTP_BODY: %w", err)
+	}
+	return e, nil
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// wantsReason reports whether jobs are mailed for the reason, SMTP_REASONS
+// (default: NOTIFY_REASONS).
+func (e *emailNotifier) wantsReason(why string) bool {
+	if e.reasons == nil {
+		return notifyReasons[why]
+	}
+	return e.reasons[why]
+}
+
+// send mails the job to all recipients, with the PDF attached if there is one.
+func (e *emailNotifier) send(data QFileData, doc *webhookDocument) error {
+	var subject, body bytes.Buffer
+	if err := e.subject.Execute(&subject, data); err != nil {
+		return fmt.Errorf("error rendering email subject: %w", err)
+	}
+	if err := e.body.Execute(&body, data); err != nil {
+		return fmt.Errorf("error rendering email body: %w", err)
+	}
+	return e.mail(strings.TrimSpace(subject.String()), body.String(), doc)
+}
+
+// mail sends a message to all recipients through the SMTP server.
+func (e *emailNotifier) mail(subject, body string, doc *webhookDocument) error {
+	msg, err := e.buildMail(subject, body, doc)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	host, _, _ := net.SplitHostPort(e.server)
+	if e.username != "" {
+		auth = smtp.PlainAuth("", e.username, e.password, host)
+	}
+	if !e.tls {
+		// Upgrades to STARTTLS if the server offers it
+		return smtp.SendMail(e.server, auth, e.from, e.to, msg)
+	}
+
+	conn, err := tls.Dial("tcp", e.server, &tls.Config{ServerName: host})
+	if err != nil {
+		return fmt.Errorf("error connecting to SMTP server: %w", err)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(e.from); err != nil {
+		return err
+	}
+	for _, to := range e.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// encodeSubject returns subject as an RFC 2047 header value, with control
+// characters turned into spaces so they can't inject headers.
+func encodeSubject(subject string) string {
+	subject = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, subject)
+	return mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject), " "))
+}
+
+// buildMail assembles a MIME message with a text body and the PDF attached.
+func (e *emailNotifier) buildMail(subject, body string, doc *webhookDocument) ([]byte, error) {
+	var msg bytes.Buffer
+	writer := multipart.NewWriter(&msg)
+
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", encodeSubject(subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+
+	if doc != nil {
+		part, err = writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/pdf"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", doc.Name)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(doc.Data)
+		for len(encoded) > 76 {
+			if _, err := part.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+				return nil, err
+			}
+			encoded = encoded[76:]
+		}
+		if _, err := part.Write([]byte(encoded + "\r\n")); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
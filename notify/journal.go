@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// journalEntry is a faxq journal message with its cursor.
+type journalEntry struct {
+	Cursor  string
+	Message string
+}
+
+// journalUnit returns the systemd unit of faxq, JOURNAL_UNIT (default: faxq.service).
+func journalUnit() string {
+	unit := os.Getenv("JOURNAL_UNIT")
+	if unit == "" {
+		unit = "faxq"
+	}
+	if !strings.Contains(unit, ".") {
+		unit += ".service"
+	}
+	return unit
+}
+
+// cursorFile returns the file the journal cursor is persisted in,
+// JOURNAL_CURSOR_FILE (default: journal_cursor.txt).
+func cursorFile() string {
+	if name := os.Getenv("JOURNAL_CURSOR_FILE"); name != "" {
+		return name
+	}
+	return "journal_cursor.txt"
+}
+
+// loadCursor returns the cursor of the last handled entry, or "" if there is none.
+func loadCursor() string {
+	content, err := os.ReadFile(cursorFile())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// saveCursor persists the cursor, replacing the file atomically so a crash
+// never leaves a truncated cursor behind.
+func saveCursor(cursor string) error {
+	name := cursorFile()
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(cursor); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// startTime returns where to start reading the journal without a cursor:
+// the time of the last run of older versions, or firstRun ago.
+func startTime() time.Time {
+	content, err := os.ReadFile(lastRunFile)
+	if err == nil {
+		if t, err := time.ParseInLocation(timeLayout, string(content), time.Local); err == nil {
+			return t
+		}
+	}
+	return time.Now().Add(-firstRun)
+}
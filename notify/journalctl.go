@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// followJournalctl follows the journal of the unit with journalctl, starting
+// after cursor (or at since if cursor is empty), and calls handle for every
+// entry in order. It returns when journalctl exits.
+func followJournalctl(unit, cursor string, since time.Time, handle func(journalEntry) error) error {
+	args := []string{"--no-pager", "--follow", "--output=json", "--unit", unit}
+	if cursor != "" {
+		args = append(args, "--after-cursor", cursor)
+	} else {
+		args = append(args, "--since", since.Format(timeLayout))
+	}
+	cmd := exec.Command("journalctl", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error running journalctl: %w", err)
+	}
+	// journalctl follows forever, so it has to be stopped on every return
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var fields struct {
+			Cursor  string          `json:"__CURSOR"`
+			Message json.RawMessage `json:"MESSAGE"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &fields); err != nil {
+			return fmt.Errorf("error parsing journalctl output: %w", err)
+		}
+		if err := handle(journalEntry{Cursor: fields.Cursor, Message: journalMessage(fields.Message)}); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading journalctl output: %w", err)
+	}
+	return fmt.Errorf("journalctl exited")
+}
+
+// journalMessage decodes MESSAGE, which journalctl outputs as an array of
+// bytes if it is not valid UTF-8.
+func journalMessage(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var b []byte
+	var ints []int
+	if json.Unmarshal(raw, &ints) == nil {
+		for _, i := range ints {
+			b = append(b, byte(i))
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,11 @@
+//go:build !sdjournal
+
+package notify
+
+import "time"
+
+// followJournal follows the journal with journalctl, as libsystemd is not
+// built in.
+func followJournal(unit, cursor string, since time.Time, handle func(journalEntry) error) error {
+	return followJournalctl(unit, cursor, since, handle)
+}
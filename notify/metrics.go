@@ -0,0 +1,24 @@
+package notify
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics are registered with the default registry, which the bridge's
+// /metrics endpoint serves.
+var (
+	notificationsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gofaxip_bridge",
+		Subsystem: "notify",
+		Name:      "sent_total",
+		Help:      "Job notifications by channel (webhook or email) and result (ok, queued or error).",
+	}, []string{"channel", "result"})
+
+	notificationsSuppressed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gofaxip_bridge",
+		Subsystem: "notify",
+		Name:      "suppressed_total",
+		Help:      "Job notifications suppressed as duplicate or by the rate limit.",
+	}, []string{"reason"})
+)
@@ -0,0 +1,451 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sagostin/gofaxip-bridge/pkg/qfile"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+const lastRunFile = "last_run.txt" // Start time of versions before the journal cursor
+const firstRun = 10 * time.Minute
+const restartDelay = 10 * time.Second
+const retryCount = 3 // Default NOTIFY_MIN_DIALS
+
+// webhookClient is reused for all webhooks; WEBHOOK_TIMEOUT (e.g. "30s") bounds each request.
+var webhookClient = &http.Client{Timeout: 30 * time.Second}
+
+// mailer emails notifications if SMTP_SERVER is set.
+var mailer *emailNotifier
+
+// retryQueue holds webhooks that failed until the endpoint accepts them.
+var retryQueue *webhookQueue
+
+// qfileOptions are how qfiles are opened, see NOTIFY_QFILE_LOCK.
+var qfileOptions []qfile.Option
+
+type QFileData struct {
+	SrcNum     string `json:"src_num"`
+	SrcCid     string `json:"src_cid"`
+	DestNum    string `json:"dest_num"`
+	DestCid    string `json:"dest_cid"`
+	Pages      int    `json:"total_pages"`
+	TotalDials int    `json:"total_dials"`
+	TotalTries int    `json:"total_tries"`
+	JobID      int    `json:"job_id"`
+	Status     string `json:"status"`
+	Why        string `json:"why"`
+	TiffPath   string `json:"tiff_path"`
+	MaxDials   int    `json:"max_dials"`
+	MaxTries   int    `json:"max_tries"`
+	SendAt     string `json:"send_at,omitempty"`    // RFC 3339 time the job was scheduled at
+	KillAt     string `json:"kill_at,omitempty"`    // RFC 3339 time the job expires at
+	RetryTime  string `json:"retry_time,omitempty"` // Delay between tries, if the job sets it
+	State      int    `json:"-"`                    // HylaFAX job state, see jobState*
+
+	tiffPaths []string // All TIFF documents of the job, TiffPath first
+}
+
+// Options configure Run.
+type Options struct {
+	// Env holds variables of the config file's fax_notify section, used
+	// where neither the environment nor .env sets them. With Env set,
+	// .env is optional.
+	Env map[string]string
+	// HTTPClient is the client webhooks are posted with; WEBHOOK_TIMEOUT
+	// still overrides its timeout.
+	HTTPClient *http.Client
+}
+
+// Run follows faxq's journal, or watches doneq, and notifies of finished
+// jobs. It only returns if setting up fails or the doneq watcher stops.
+func Run(opts Options) error {
+	// Load environment variables from .env file
+	err := godotenv.Load()
+	if err != nil && (opts.Env == nil || !errors.Is(err, fs.ErrNotExist)) {
+		return err
+	}
+	for name, value := range opts.Env {
+		if _, ok := os.LookupEnv(name); !ok {
+			os.Setenv(name, value)
+		}
+	}
+
+	if opts.HTTPClient != nil {
+		webhookClient = &http.Client{Transport: opts.HTTPClient.Transport, Timeout: opts.HTTPClient.Timeout}
+	}
+	if timeout := os.Getenv("WEBHOOK_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("invalid WEBHOOK_TIMEOUT: %w", err)
+		}
+		webhookClient.Timeout = d
+	}
+	tlsConfig, err := webhookTLS()
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		webhookClient = withTLS(webhookClient, tlsConfig)
+	}
+
+	switch lock := os.Getenv("NOTIFY_QFILE_LOCK"); lock {
+	case "", "shared":
+	case "none":
+		qfileOptions = []qfile.Option{qfile.NoLock()}
+	default:
+		return fmt.Errorf("invalid NOTIFY_QFILE_LOCK %q, expected shared or none", lock)
+	}
+
+	if err := loadDestinations(); err != nil {
+		return err
+	}
+	mailer, err = loadEmailNotifier()
+	if err != nil {
+		return err
+	}
+	retryQueue, err = openWebhookQueue()
+	if err != nil {
+		return err
+	}
+	limiter, err = loadLimiter()
+	if err != nil {
+		return err
+	}
+	defaults := defaultJournalReasons
+	if os.Getenv("NOTIFY_SOURCE") == "doneq" {
+		defaults = defaultDoneqReasons
+	}
+	if err := loadReasons(defaults); err != nil {
+		return err
+	}
+
+	go retryQueue.run()
+	if limiter != nil {
+		go limiter.run()
+	}
+
+	log.Info("Starting fax_notify")
+	if os.Getenv("NOTIFY_SOURCE") == "doneq" {
+		return watchDoneq(filepath.Join(os.Getenv("BASE_HYLAFAX_PATH"), "doneq"))
+	}
+
+	unit := journalUnit()
+	for {
+		cursor := loadCursor()
+		err := followJournal(unit, cursor, startTime(), func(entry journalEntry) error {
+			handleLine(entry.Message)
+			// Persisted after handling, so no notification is lost or sent twice across restarts
+			if err := saveCursor(entry.Cursor); err != nil {
+				log.Errorf("Error saving journal cursor: %s", err)
+			}
+			return nil
+		})
+		log.Errorf("Error following journal of %s: %s", unit, err)
+		time.Sleep(restartDelay)
+	}
+}
+
+// handleLine sends a webhook for a faxq NOTIFY line with one of the notify reasons.
+func handleLine(line string) {
+	if !strings.Contains(line, "NOTIFY: bin/notify") {
+		return
+	}
+	name, why := extractInfo(line)
+
+	log.Info("qfile: " + name + " why: " + why)
+
+	if !wantsAnyReason(why) {
+		return
+	}
+
+	filePath := os.Getenv("BASE_HYLAFAX_PATH") + name
+
+	log.Info("filePath: " + filePath)
+
+	qfileContents, err := readQfile(filePath)
+	if err != nil {
+		log.Errorf("Error reading qfile: %s", err)
+		return
+	}
+	notify(qfileContents, why)
+}
+
+// notify sends the webhook for the job if it is notified for the reason.
+func notify(qfileContents QFileData, why string) {
+	if !shouldNotify(why, qfileContents) {
+		return
+	}
+
+	qfileContents.Why = why
+
+	matched := matchingDestinations(qfileContents)
+	mail := mailer != nil && mailer.wantsReason(why)
+	if len(matched) == 0 && !mail {
+		log.Info("No webhook or email matches the job")
+		return
+	}
+	if limiter != nil && !limiter.allow(qfileContents, why) {
+		return
+	}
+
+	// Convert TIFF to PDF (first page, or all pages)
+	doc := loadDocument(qfileContents)
+
+	if len(matched) > 0 {
+		err := sendWebhook(qfileContents, matched, doc, loadThumbnail(qfileContents))
+		if err != nil {
+			log.Error("Error sending webhook:", err)
+		} else {
+			log.Info("Webhook sent successfully")
+		}
+	}
+	if mail {
+		if err := mailer.send(qfileContents, doc); err != nil {
+			notificationsSent.WithLabelValues("email", "error").Inc()
+			log.Errorf("Error sending email: %s", err)
+		} else {
+			notificationsSent.WithLabelValues("email", "ok").Inc()
+			log.Info("Email sent successfully")
+		}
+	}
+}
+
+func extractInfo(line string) (string, string) {
+	re := regexp.MustCompile(`NOTIFY: bin/notify "([^"]*)" "([^"]*)"`)
+	matches := re.FindStringSubmatch(line)
+	if len(matches) >= 3 {
+		return matches[1], matches[2]
+	}
+	return "", ""
+}
+
+func readQfile(filename string) (QFileData, error) {
+	var data QFileData
+
+	q, err := qfile.OpenQfileRead(filename, qfileOptions...)
+	if err != nil {
+		return data, err
+	}
+	// Releases the lock, HylaFAX blocks on it
+	defer q.Close()
+
+	totPages, _ := q.GetInt("totpages")
+	totTries, _ := q.GetInt("tottries")
+	totDials, _ := q.GetInt("totdials")
+	jobID, _ := q.GetInt("jobid")
+	state, _ := q.GetInt("state")
+	maxDials, _ := q.GetInt("maxdials")
+	maxTries, _ := q.GetInt("maxtries")
+
+	data = QFileData{
+		SrcNum:     q.GetString("owner"),
+		SrcCid:     q.GetString("tsi"),
+		DestNum:    q.GetString("number"),
+		DestCid:    q.GetString("external"),
+		Pages:      totPages,
+		TotalDials: totDials,
+		TotalTries: totTries,
+		Status:     q.GetString("status"),
+		JobID:      jobID,
+		MaxDials:   maxDials,
+		MaxTries:   maxTries,
+		SendAt:     qfileTime(q, "tts"),
+		KillAt:     qfileTime(q, "killtime"),
+		State:      state,
+		tiffPaths:  extractTiffPaths(q),
+	}
+	if retry, err := q.GetDuration("retrytime"); err == nil && retry > 0 {
+		data.RetryTime = retry.String()
+	}
+	if len(data.tiffPaths) > 0 {
+		data.TiffPath = data.tiffPaths[0]
+	}
+
+	return data, nil
+}
+
+// qfileTime returns a time tag of a qfile in RFC 3339, or "" if it is not
+// set (a tts of 0 sends at once).
+func qfileTime(q *qfile.Qfile, tag string) string {
+	t, err := q.GetTime(tag)
+	if err != nil || t.Unix() <= 0 {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// extractTiffPaths returns the full paths of the TIFF documents of a job,
+// or of the documents imaged for transmission if it has none (e.g. jobs
+// submitted as PDF).
+func extractTiffPaths(q *qfile.Qfile) []string {
+	docs, err := q.Documents()
+	if err != nil {
+		log.Warn(err)
+	}
+
+	var tiffs, imaged []string
+	for _, doc := range docs {
+		path := filepath.Join(os.Getenv("BASE_HYLAFAX_PATH"), doc.Path)
+		switch doc.Type {
+		case "tiff":
+			tiffs = append(tiffs, path)
+		case "fax":
+			imaged = append(imaged, path)
+		}
+	}
+	if len(tiffs) == 0 {
+		tiffs = imaged
+	}
+	if len(tiffs) == 0 {
+		log.Warnf("No TIFF document found in %s", q.Filename())
+	}
+	return tiffs
+}
+
+// convertTiffToPdf converts the first page of the first TIFF, or all pages of
+// all of them, to a temporary PDF.
+func convertTiffToPdf(data QFileData, inputPaths []string, allPages bool) (string, error) {
+	if len(inputPaths) == 0 {
+		return "", fmt.Errorf("job %d has no TIFF document", data.JobID)
+	}
+	pages, prefix, inputs := "first page", "first_page_", []string{inputPaths[0] + "[0]"}
+	if allPages {
+		pages, prefix, inputs = "all pages", "full", inputPaths
+	}
+	log.Info("Converting TIFF to PDF (" + pages + "), input paths: " + strings.Join(inputPaths, ", "))
+
+	// Check if the files exist
+	for _, inputPath := range inputPaths {
+		if _, err := os.Stat(inputPath); os.IsNotExist(err) {
+			return "", fmt.Errorf("TIFF file does not exist: %s", inputPath)
+		}
+	}
+
+	tempDir := os.TempDir()
+	finalPdfPath := filepath.Join(tempDir, fmt.Sprintf("%s_%d_%s_%s.pdf", prefix, time.Now().UnixNano(), data.SrcNum, data.DestNum))
+
+	args := []string{
+		"-density", "300",
+		"-compress", "lzw",
+		"-quality", "100",
+		"-background", "white",
+		"-alpha", "remove",
+	}
+	args = append(args, inputs...)
+	args = append(args, "-resize", "2550x3300>", finalPdfPath)
+	cmd := exec.Command("convert", args...)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to convert TIFF to PDF: %v, output: %s", err, string(output))
+	}
+
+	log.Info("Successfully converted TIFF to PDF (" + pages + "), output path: " + finalPdfPath)
+	return finalPdfPath, nil
+}
+
+func WriteQFileDataFields(writer *multipart.Writer, data QFileData) error {
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"src_num", data.SrcNum},
+		{"src_cid", data.SrcCid},
+		{"dest_num", data.DestNum},
+		{"dest_cid", data.DestCid},
+		{"total_pages", strconv.Itoa(data.Pages)},
+		{"total_dials", strconv.Itoa(data.TotalDials)},
+		{"total_tries", strconv.Itoa(data.TotalTries)},
+		{"job_id", strconv.Itoa(data.JobID)},
+		{"status", data.Status},
+		{"why", data.Why},
+		{"tiff_path", data.TiffPath},
+		{"max_dials", strconv.Itoa(data.MaxDials)},
+		{"max_tries", strconv.Itoa(data.MaxTries)},
+		{"send_at", data.SendAt},
+		{"kill_at", data.KillAt},
+		{"retry_time", data.RetryTime},
+	}
+
+	for _, field := range fields {
+		err := writer.WriteField(field.name, field.value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendWebhook posts the job to the matching endpoints, queueing it for
+// endpoints that fail.
+func sendWebhook(data QFileData, matched []*webhookDestination, doc, thumb *webhookDocument) error {
+
+	type encoded struct {
+		contentType string
+		body        []byte
+	}
+	bodies := make(map[string]encoded)
+
+	var errs []error
+	for _, d := range matched {
+		format := d.format()
+		enc, ok := bodies[format]
+		if !ok {
+			contentType, body, err := encodeWebhook(format, data, doc, thumb)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("webhook %s: %w", d.Name, err))
+				continue
+			}
+			enc = encoded{contentType, body}
+			bodies[format] = enc
+		}
+
+		payload := &webhookPayload{
+			ID:          newWebhookID(),
+			Destination: d.Name,
+			URL:         d.URL,
+			ContentType: enc.contentType,
+			Body:        enc.body,
+			Created:     time.Now(),
+		}
+		if err := deliver(payload); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s: %w", d.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deliver posts the webhook, queueing it for retry if that fails temporarily.
+func deliver(payload *webhookPayload) error {
+	err := payload.post()
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	if err != nil && retryable(err) {
+		if qerr := retryQueue.Put(payload, err); qerr != nil {
+			err = fmt.Errorf("%w (error queueing webhook for retry: %s)", err, qerr)
+		} else {
+			result = "queued"
+			err = fmt.Errorf("queued for retry: %w", err)
+		}
+	}
+	notificationsSent.WithLabelValues("webhook", result).Inc()
+	return err
+}
@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Webhook body formats.
+const (
+	formatMultipart = "multipart"
+	formatJSON      = "json"
+)
+
+// webhookDocument is the converted PDF or PNG thumbnail of a job.
+type webhookDocument struct {
+	Name string
+	Data []byte
+}
+
+// defaultMaxPDFSize is the default of WEBHOOK_PDF_MAX_SIZE.
+const defaultMaxPDFSize = 10 << 20
+
+// loadDocument converts the job's TIFF to PDF, or returns nil if that fails.
+// With WEBHOOK_PDF_PAGES=all the whole document is converted, unless the PDF
+// is larger than WEBHOOK_PDF_MAX_SIZE bytes; then only the first page is.
+func loadDocument(data QFileData) *webhookDocument {
+	if os.Getenv("WEBHOOK_PDF_PAGES") == "all" {
+		doc := convertDocument(data, true)
+		if doc == nil || len(doc.Data) <= maxPDFSize() {
+			return doc
+		}
+		log.Warnf("PDF of job %d has %d bytes, more than the limit of %d, attaching the first page only", data.JobID, len(doc.Data), maxPDFSize())
+	}
+	return convertDocument(data, false)
+}
+
+func maxPDFSize() int {
+	if env := os.Getenv("WEBHOOK_PDF_MAX_SIZE"); env != "" {
+		n, err := strconv.Atoi(env)
+		if err == nil {
+			return n
+		}
+		log.Errorf("Invalid WEBHOOK_PDF_MAX_SIZE: %s", err)
+	}
+	return defaultMaxPDFSize
+}
+
+func convertDocument(data QFileData, allPages bool) *webhookDocument {
+	pdfPath, err := convertTiffToPdf(data, data.tiffPaths, allPages)
+	if err != nil {
+		log.Error(err)
+		return nil
+	}
+	defer func(name string) {
+		err := os.Remove(name)
+		if err != nil {
+			log.Error(err)
+		}
+	}(pdfPath)
+
+	pdf, err := os.ReadFile(pdfPath)
+	if err != nil {
+		log.Error(err)
+		return nil
+	}
+	return &webhookDocument{Name: filepath.Base(pdfPath), Data: pdf}
+}
+
+// loadThumbnail renders a PNG preview of the first page if WEBHOOK_THUMBNAIL
+// is true, or returns nil.
+func loadThumbnail(data QFileData) *webhookDocument {
+	if os.Getenv("WEBHOOK_THUMBNAIL") != "true" {
+		return nil
+	}
+	size := os.Getenv("WEBHOOK_THUMBNAIL_SIZE")
+	if size == "" {
+		size = "200x260"
+	}
+	if _, err := os.Stat(data.TiffPath); err != nil {
+		log.Errorf("Error rendering thumbnail: %s", err)
+		return nil
+	}
+
+	cmd := exec.Command("convert",
+		data.TiffPath+"[0]",
+		"-background", "white",
+		"-alpha", "remove",
+		"-thumbnail", size,
+		"png:-")
+	png, err := cmd.Output()
+	if err != nil {
+		log.Errorf("Error rendering thumbnail: %s", err)
+		return nil
+	}
+	name := strings.TrimSuffix(filepath.Base(data.TiffPath), filepath.Ext(data.TiffPath))
+	return &webhookDocument{Name: fmt.Sprintf("thumb_%d_%s.png", time.Now().UnixNano(), name), Data: png}
+}
+
+// encodeWebhook returns the content type and body of the webhook in the format.
+func encodeWebhook(format string, data QFileData, doc, thumb *webhookDocument) (string, []byte, error) {
+	if format == formatJSON {
+		return encodeJSON(data, doc, thumb)
+	}
+	return encodeMultipart(data, doc, thumb)
+}
+
+// encodeMultipart encodes the job as form fields with the PDF as pdf_file
+// and the thumbnail as thumbnail.
+func encodeMultipart(data QFileData, doc, thumb *webhookDocument) (string, []byte, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	if err := WriteQFileDataFields(writer, data); err != nil {
+		return "", nil, err
+	}
+	for _, file := range []struct {
+		field string
+		doc   *webhookDocument
+	}{{"pdf_file", doc}, {"thumbnail", thumb}} {
+		if file.doc == nil {
+			continue
+		}
+		part, err := writer.CreateFormFile(file.field, file.doc.Name)
+		if err != nil {
+			return "", nil, err
+		}
+		if _, err := part.Write(file.doc.Data); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", nil, err
+	}
+	return writer.FormDataContentType(), body.Bytes(), nil
+}
+
+// jsonWebhook is the JSON body of a webhook. The PDF and thumbnail are
+// embedded as base64, or referenced by URL if WEBHOOK_PDF_URL is set.
+type jsonWebhook struct {
+	QFileData
+	PDFFile         string `json:"pdf_file,omitempty"`
+	PDFBase64       []byte `json:"pdf_base64,omitempty"`
+	PDFURL          string `json:"pdf_url,omitempty"`
+	ThumbnailBase64 []byte `json:"thumbnail_base64,omitempty"`
+	ThumbnailURL    string `json:"thumbnail_url,omitempty"`
+}
+
+func encodeJSON(data QFileData, doc, thumb *webhookDocument) (string, []byte, error) {
+	payload := jsonWebhook{QFileData: data}
+	base := os.Getenv("WEBHOOK_PDF_URL")
+	if doc != nil {
+		payload.PDFFile = doc.Name
+		if base != "" {
+			url, err := publishDocument(base, doc)
+			if err != nil {
+				return "", nil, err
+			}
+			payload.PDFURL = url
+		} else {
+			payload.PDFBase64 = doc.Data
+		}
+	}
+	if thumb != nil {
+		if base != "" {
+			url, err := publishDocument(base, thumb)
+			if err != nil {
+				return "", nil, err
+			}
+			payload.ThumbnailURL = url
+		} else {
+			payload.ThumbnailBase64 = thumb.Data
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", nil, err
+	}
+	return "application/json", body, nil
+}
+
+// publishDocument stores the PDF or thumbnail in WEBHOOK_PDF_DIR, which is served at the
+// base URL, and returns its URL.
+func publishDocument(base string, doc *webhookDocument) (string, error) {
+	dir := os.Getenv("WEBHOOK_PDF_DIR")
+	if dir == "" {
+		return "", fmt.Errorf("WEBHOOK_PDF_URL requires WEBHOOK_PDF_DIR")
+	}
+	if err := os.WriteFile(filepath.Join(dir, doc.Name), doc.Data, 0644); err != nil {
+		return "", fmt.Errorf("error storing %s: %w", doc.Name, err)
+	}
+	return strings.TrimSuffix(base, "/") + "/" + doc.Name, nil
+}
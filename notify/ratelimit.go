@@ -0,0 +1,150 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultDedupWindow is the default of NOTIFY_DEDUP_WINDOW.
+const defaultDedupWindow = 10 * time.Minute
+
+// notifyLimiter suppresses notifications repeating for the same job and
+// reason within NOTIFY_DEDUP_WINDOW, and notifications beyond
+// NOTIFY_RATE_LIMIT per minute. Rate-limited notifications are
+// summarized once the minute is over.
+type notifyLimiter struct {
+	window    time.Duration
+	perMinute int // 0 is unlimited
+
+	mu         sync.Mutex
+	seen       map[string]time.Time // Last notification by job and reason
+	start      time.Time            // Start of the current minute
+	sent       int
+	suppressed int
+}
+
+// limiter is nil if neither deduplication nor rate limiting is enabled.
+var limiter *notifyLimiter
+
+// loadLimiter reads NOTIFY_DEDUP_WINDOW (e.g. "10m", 0 disables) and
+// NOTIFY_RATE_LIMIT.
+func loadLimiter() (*notifyLimiter, error) {
+	l := &notifyLimiter{window: defaultDedupWindow, seen: make(map[string]time.Time), start: time.Now()}
+	if env := os.Getenv("NOTIFY_DEDUP_WINDOW"); env != "" {
+		d, err := time.ParseDuration(env)
+		if env == "0" {
+			d, err = 0, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("NOTIFY_DEDUP_WINDOW: %w", err)
+		}
+		l.window = d
+	}
+	if env := os.Getenv("NOTIFY_RATE_LIMIT"); env != "" {
+		n, err := strconv.Atoi(env)
+		if err != nil {
+			return nil, fmt.Errorf("NOTIFY_RATE_LIMIT: %w", err)
+		}
+		l.perMinute = n
+	}
+	if l.window <= 0 && l.perMinute <= 0 {
+		return nil, nil
+	}
+	return l, nil
+}
+
+// allow registers a notification for the job unless it is suppressed.
+func (l *notifyLimiter) allow(data QFileData, why string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	key := fmt.Sprintf("%d/%s", data.JobID, why)
+	if l.window > 0 {
+		if last, ok := l.seen[key]; ok && now.Sub(last) < l.window {
+			notificationsSuppressed.WithLabelValues("duplicate").Inc()
+			log.Infof("Suppressing duplicate notification for job %d (%s)", data.JobID, why)
+			return false
+		}
+	}
+	if l.perMinute > 0 {
+		if l.sent >= l.perMinute {
+			l.suppressed++
+			notificationsSuppressed.WithLabelValues("rate_limit").Inc()
+			log.Warnf("Rate limit of %d notifications per minute reached, suppressing job %d (%s)", l.perMinute, data.JobID, why)
+			return false
+		}
+		l.sent++
+	}
+	if l.window > 0 {
+		for k, t := range l.seen {
+			if now.Sub(t) >= l.window {
+				delete(l.seen, k)
+			}
+		}
+		l.seen[key] = now
+	}
+	return true
+}
+
+// run starts a new minute every minute, sending a summary of the
+// notifications suppressed in the last one.
+func (l *notifyLimiter) run() {
+	for range time.Tick(time.Minute) {
+		l.mu.Lock()
+		since, suppressed := l.start, l.suppressed
+		l.start, l.sent, l.suppressed = time.Now(), 0, 0
+		l.mu.Unlock()
+
+		if suppressed > 0 {
+			sendSuppressed(suppressed, since, time.Now())
+		}
+	}
+}
+
+// suppressedSummary is posted as JSON to all webhooks after notifications
+// were rate-limited.
+type suppressedSummary struct {
+	Event      string    `json:"event"` // Always "suppressed"
+	Suppressed int       `json:"suppressed"`
+	Since      time.Time `json:"since"`
+	Until      time.Time `json:"until"`
+}
+
+// sendSuppressed notifies all webhooks and the mailer that n notifications
+// were suppressed.
+func sendSuppressed(n int, since, until time.Time) {
+	log.Warnf("%d notifications suppressed since %s", n, since.Format(timeLayout))
+
+	body, err := json.Marshal(suppressedSummary{Event: "suppressed", Suppressed: n, Since: since, Until: until})
+	if err != nil {
+		log.Errorf("Error marshaling summary: %s", err)
+		return
+	}
+	for _, d := range destinations {
+		payload := &webhookPayload{
+			ID:          newWebhookID(),
+			Destination: d.Name,
+			URL:         d.URL,
+			ContentType: "application/json",
+			Body:        body,
+			Created:     time.Now(),
+		}
+		if err := deliver(payload); err != nil {
+			log.Errorf("Error sending summary to webhook %s: %s", d.Name, err)
+		}
+	}
+	if mailer != nil {
+		text := fmt.Sprintf("%d fax notifications were suppressed between %s and %s, the limit is %d per minute (NOTIFY_RATE_LIMIT).\n",
+			n, since.Format(timeLayout), until.Format(timeLayout), limiter.perMinute)
+		if err := mailer.mail(fmt.Sprintf("%d fax notifications suppressed", n), text, nil); err != nil {
+			log.Errorf("Error sending summary email: %s", err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Reasons notifying by default for each NOTIFY_SOURCE.
+var (
+	defaultJournalReasons = []string{"rejected", "removed", "killed", "requeued"}
+	defaultDoneqReasons   = []string{"failed"}
+)
+
+// progressReasons are notified regardless of the number of dials, they do
+// not report a failed job.
+var progressReasons = map[string]bool{"done": true, "blocked": true}
+
+// notifyReasons holds the reasons webhooks are sent for, NOTIFY_REASONS.
+var notifyReasons map[string]bool
+
+// minDials is the number of dials a failed job needs before it is notified,
+// NOTIFY_MIN_DIALS (default: retryCount).
+var minDials = retryCount
+
+// loadReasons reads NOTIFY_REASONS and NOTIFY_MIN_DIALS, with the defaults
+// for the given source.
+func loadReasons(defaults []string) error {
+	reasons := defaults
+	if env := os.Getenv("NOTIFY_REASONS"); env != "" {
+		reasons = strings.Split(env, ",")
+	}
+	notifyReasons = make(map[string]bool, len(reasons))
+	for _, why := range reasons {
+		if why = strings.TrimSpace(why); why != "" {
+			notifyReasons[why] = true
+		}
+	}
+
+	if env := os.Getenv("NOTIFY_MIN_DIALS"); env != "" {
+		n, err := strconv.Atoi(env)
+		if err != nil {
+			return fmt.Errorf("invalid NOTIFY_MIN_DIALS: %w", err)
+		}
+		minDials = n
+	}
+	return nil
+}
+
+// shouldNotify reports whether webhooks are sent for the job finishing or
+// progressing for the reason; the endpoints filter them further.
+func shouldNotify(why string, qfileContents QFileData) bool {
+	if !wantsAnyReason(why) {
+		return false
+	}
+	return progressReasons[why] || qfileContents.TotalDials >= minDials
+}
@@ -0,0 +1,62 @@
+//go:build sdjournal
+
+package notify
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	log "github.com/sirupsen/logrus"
+)
+
+// followJournal follows the journal of the unit through libsystemd, starting
+// after cursor (or at since if cursor is empty), and calls handle for every
+// entry in order. If libsystemd can't be loaded, journalctl is used instead.
+func followJournal(unit, cursor string, since time.Time, handle func(journalEntry) error) error {
+	j, err := sdjournal.NewJournal()
+	if err != nil {
+		log.Warnf("Error opening journal through libsystemd, falling back to journalctl: %s", err)
+		return followJournalctl(unit, cursor, since, handle)
+	}
+	defer j.Close()
+
+	if err := j.AddMatch(sdjournal.SD_JOURNAL_FIELD_SYSTEMD_UNIT + "=" + unit); err != nil {
+		return fmt.Errorf("error matching unit: %w", err)
+	}
+	if cursor != "" {
+		if err := j.SeekCursor(cursor); err != nil {
+			return fmt.Errorf("error seeking to cursor: %w", err)
+		}
+		// Skip the entry at the cursor, it has been handled already
+		if _, err := j.Next(); err != nil {
+			return err
+		}
+		if err := j.TestCursor(cursor); err != nil {
+			// The entry was rotated away, continue at the next one
+			if _, err := j.Previous(); err != nil {
+				return err
+			}
+		}
+	} else if err := j.SeekRealtimeUsec(uint64(since.UnixMicro())); err != nil {
+		return fmt.Errorf("error seeking journal: %w", err)
+	}
+
+	for {
+		n, err := j.Next()
+		if err != nil {
+			return fmt.Errorf("error reading journal: %w", err)
+		}
+		if n == 0 {
+			j.Wait(sdjournal.IndefiniteWait)
+			continue
+		}
+		entry, err := j.GetEntry()
+		if err != nil {
+			return fmt.Errorf("error reading journal entry: %w", err)
+		}
+		if err := handle(journalEntry{Cursor: entry.Cursor, Message: entry.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE]}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of signed webhooks. The signature covers "<timestamp>.<id>.<body>",
+// so receivers can reject stale timestamps and IDs they have seen before.
+const (
+	headerTimestamp = "X-Timestamp"
+	headerID        = "X-Webhook-ID"
+	headerSignature = "X-Signature"
+)
+
+// newWebhookID returns a random ID identifying a notification across retries.
+func newWebhookID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// sign adds the signature headers to the request, timestamped now.
+func sign(req *http.Request, secret, id string, body []byte) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "." + id + "."))
+	mac.Write(body)
+
+	req.Header.Set(headerTimestamp, ts)
+	req.Header.Set(headerID, id)
+	req.Header.Set(headerSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,196 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Backoff between retries of queued webhooks.
+const (
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = time.Hour
+	retryInterval  = 10 * time.Second
+)
+
+// webhookPayload is a prepared webhook request, kept on disk until it is delivered.
+type webhookPayload struct {
+	ID          string    `json:"id"`                    // Sent as X-Webhook-ID on every attempt
+	Destination string    `json:"destination,omitempty"` // Name of the endpoint (default: default)
+	URL         string    `json:"url"`                   // URL of the endpoint when the payload was queued
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"` // Multipart form including the converted PDF
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	Created     time.Time `json:"created"`
+}
+
+// webhookStatusError is returned for webhook responses other than 200 OK.
+type webhookStatusError struct {
+	StatusCode int
+}
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("webhook request failed with status code: %d", e.StatusCode)
+}
+
+// retryable reports whether a failed webhook may succeed later: network
+// errors, rate limiting and server errors.
+func retryable(err error) bool {
+	if errors.Is(err, errUnknownDestination) {
+		// Retrying won't bring a removed endpoint back
+		return false
+	}
+	var statusErr *webhookStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+// errUnknownDestination is returned for queued payloads whose endpoint has been removed.
+var errUnknownDestination = errors.New("unknown webhook destination")
+
+// post sends the payload with the basic auth credentials of its endpoint.
+func (p *webhookPayload) post() error {
+	d := destination(p.Destination)
+	if d == nil {
+		return errUnknownDestination
+	}
+	// The endpoint's current URL, it may have moved since the payload was queued
+	req, err := http.NewRequest("POST", d.URL, bytes.NewReader(p.Body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(d.Username, d.Password)
+	req.Header.Set("Content-Type", p.ContentType)
+	if d.Secret != "" {
+		sign(req, d.Secret, p.ID, p.Body)
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return &webhookStatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// webhookQueue is an on-disk queue of webhooks waiting to be retried, one
+// JSON file per payload. Payloads the endpoint rejects are moved to failed/.
+type webhookQueue struct {
+	dir string
+}
+
+// openWebhookQueue opens (and creates if needed) the queue directory,
+// WEBHOOK_QUEUE_DIR (default: webhookq).
+func openWebhookQueue() (*webhookQueue, error) {
+	dir := os.Getenv("WEBHOOK_QUEUE_DIR")
+	if dir == "" {
+		dir = "webhookq"
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "failed"), 0755); err != nil {
+		return nil, fmt.Errorf("error creating webhook queue directory: %w", err)
+	}
+	return &webhookQueue{dir: dir}, nil
+}
+
+// Put queues a failed payload for its first retry.
+func (q *webhookQueue) Put(p *webhookPayload, err error) error {
+	p.Attempts = 1
+	p.LastError = err.Error()
+	p.NextAttempt = time.Now().Add(retryBaseDelay)
+	return q.write(filepath.Join(q.dir, fmt.Sprintf("%d-%s.json", p.Created.UnixNano(), p.Destination)), p)
+}
+
+func (q *webhookQueue) write(name string, p *webhookPayload) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("error marshaling webhook: %w", err)
+	}
+	tmp := filepath.Join(q.dir, "."+filepath.Base(name)+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// run retries due payloads in the order they were queued, forever.
+func (q *webhookQueue) run() {
+	for {
+		names, err := filepath.Glob(filepath.Join(q.dir, "*.json"))
+		if err != nil {
+			log.Errorf("Error listing webhook queue: %s", err)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			q.retry(name)
+		}
+		time.Sleep(retryInterval)
+	}
+}
+
+func (q *webhookQueue) retry(name string) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		log.Errorf("Error reading queued webhook: %s", err)
+		return
+	}
+	p := &webhookPayload{}
+	if err := json.Unmarshal(data, p); err != nil {
+		log.Errorf("Error parsing queued webhook %s: %s", filepath.Base(name), err)
+		return
+	}
+	if time.Now().Before(p.NextAttempt) {
+		return
+	}
+
+	err = p.post()
+	switch {
+	case err == nil:
+		log.Infof("Queued webhook %s sent successfully after %d attempts", filepath.Base(name), p.Attempts+1)
+		if err := os.Remove(name); err != nil {
+			log.Errorf("Error removing queued webhook: %s", err)
+		}
+	case !retryable(err):
+		log.Errorf("Webhook %s rejected, moving it to failed/: %s", filepath.Base(name), err)
+		if err := os.Rename(name, filepath.Join(q.dir, "failed", filepath.Base(name))); err != nil {
+			log.Errorf("Error moving queued webhook: %s", err)
+		}
+	default:
+		p.Attempts++
+		p.LastError = err.Error()
+		p.NextAttempt = time.Now().Add(retryDelay(p.Attempts))
+		log.Warnf("Retry %d of webhook %s failed, next attempt at %s: %s", p.Attempts, filepath.Base(name), p.NextAttempt.Format(timeLayout), err)
+		if err := q.write(name, p); err != nil {
+			log.Errorf("Error updating queued webhook: %s", err)
+		}
+	}
+}
+
+// retryDelay doubles the delay with every attempt, up to retryMaxDelay.
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// webhookTLS returns the TLS config of WEBHOOK_CA_FILE, WEBHOOK_CERT_FILE
+// and WEBHOOK_KEY_FILE, or nil if none is set.
+func webhookTLS() (*tls.Config, error) {
+	caFile, certFile, keyFile := os.Getenv("WEBHOOK_CA_FILE"), os.Getenv("WEBHOOK_CERT_FILE"), os.Getenv("WEBHOOK_KEY_FILE")
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading WEBHOOK_CA_FILE: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in WEBHOOK_CA_FILE %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("WEBHOOK_CERT_FILE and WEBHOOK_KEY_FILE must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading webhook client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// withTLS returns a copy of client using cfg for TLS connections.
+func withTLS(client *http.Client, cfg *tls.Config) *http.Client {
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	transport.TLSClientConfig = cfg
+	return &http.Client{Transport: transport, Timeout: client.Timeout}
+}
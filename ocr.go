@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// OCR extracts the text of received faxes with tesseract. Faxes are
+// recognized in the background, so a slow recognition doesn't hold up the
+// xferfaxlog records following it.
+type OCR struct {
+	Lang     string        // tesseract language, e.g. "eng" or "eng+fra"
+	Timeout  time.Duration // Maximum time recognizing a page may take
+	SpoolDir string        // Directory the filenames of records are relative to
+
+	ctx     context.Context
+	slots   chan struct{}
+	done    chan ocrJob
+	mu      sync.Mutex
+	pending map[string]bool // Lines queued or being recognized
+}
+
+// ocrJob is a received fax waiting for or done with recognition.
+type ocrJob struct {
+	line  string
+	entry XFRecord
+}
+
+// Start runs up to workers recognitions at once until ctx is done.
+func (o *OCR) Start(ctx context.Context, workers int) {
+	o.ctx = ctx
+	o.slots = make(chan struct{}, workers)
+	o.done = make(chan ocrJob)
+	o.pending = make(map[string]bool)
+}
+
+// recognizes reports whether the record is a received fax to recognize.
+func (o *OCR) recognizes(entry XFRecord) bool {
+	return o != nil && entry.Direction == XflRECV && entry.Reason == "OK"
+}
+
+// queued reports whether the line is queued or being recognized. Its
+// record is not processed until then, so it is seen by every scan.
+func (o *OCR) queued(line string) bool {
+	if o == nil {
+		return false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.pending[line]
+}
+
+// Submit queues the fax of a record for recognition.
+func (o *OCR) Submit(line string, entry XFRecord) {
+	o.mu.Lock()
+	o.pending[line] = true
+	o.mu.Unlock()
+
+	go func() {
+		select {
+		case o.slots <- struct{}{}:
+		case <-o.ctx.Done():
+			return
+		}
+		text, err := o.FirstPage(o.ctx, filepath.Join(o.SpoolDir, entry.Filename))
+		<-o.slots
+		if err != nil {
+			log.Errorf("OCR of %s failed: %s", entry.Filename, err)
+		}
+		entry.Text = text
+		select {
+		case o.done <- ocrJob{line: line, entry: entry}:
+		case <-o.ctx.Done():
+		}
+	}()
+}
+
+// Done returns the recognized records. It is nil without OCR.
+func (o *OCR) Done() <-chan ocrJob {
+	if o == nil {
+		return nil
+	}
+	return o.done
+}
+
+// finish forgets a line once it has been processed.
+func (o *OCR) finish(line string) {
+	o.mu.Lock()
+	delete(o.pending, line)
+	o.mu.Unlock()
+}
+
+// FirstPage returns the text on the first page of the TIFF.
+func (o *OCR) FirstPage(ctx context.Context, path string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	pagePath := filepath.Join(os.TempDir(), fmt.Sprintf("ocr_%d.tif", time.Now().UnixNano()))
+	defer os.Remove(pagePath)
+
+	cmd := exec.CommandContext(ctx, "tiffcp", path+",0", pagePath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to extract first page: %v, output: %s", err, string(output))
+	}
+
+	cmd = exec.CommandContext(ctx, "tesseract", pagePath, "stdout", "-l", o.Lang)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("tesseract failed: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
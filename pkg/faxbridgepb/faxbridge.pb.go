@@ -0,0 +1,942 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.31.0
+// 	protoc        (unknown)
+// source: faxbridge/v1/faxbridge.proto
+
+package faxbridgepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// FaxRecord is an xferfaxlog record, or a JOB record of outbound job progress.
+type FaxRecord struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Ts       *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=ts,proto3" json:"ts,omitempty"`
+	Commid   string                 `protobuf:"bytes,2,opt,name=commid,proto3" json:"commid,omitempty"`
+	Modem    string                 `protobuf:"bytes,3,opt,name=modem,proto3" json:"modem,omitempty"`
+	Jobid    string                 `protobuf:"bytes,4,opt,name=jobid,proto3" json:"jobid,omitempty"`
+	Jobtag   string                 `protobuf:"bytes,5,opt,name=jobtag,proto3" json:"jobtag,omitempty"`
+	Filename string                 `protobuf:"bytes,6,opt,name=filename,proto3" json:"filename,omitempty"`
+	Sender   string                 `protobuf:"bytes,7,opt,name=sender,proto3" json:"sender,omitempty"`
+	Destnum  string                 `protobuf:"bytes,8,opt,name=destnum,proto3" json:"destnum,omitempty"`
+	RemoteId string                 `protobuf:"bytes,9,opt,name=remote_id,json=remoteId,proto3" json:"remote_id,omitempty"`
+	Params   string                 `protobuf:"bytes,10,opt,name=params,proto3" json:"params,omitempty"`
+	Pages    uint32                 `protobuf:"varint,11,opt,name=pages,proto3" json:"pages,omitempty"`
+	Jobtime  string                 `protobuf:"bytes,12,opt,name=jobtime,proto3" json:"jobtime,omitempty"`
+	Conntime string                 `protobuf:"bytes,13,opt,name=conntime,proto3" json:"conntime,omitempty"`
+	Reason   string                 `protobuf:"bytes,14,opt,name=reason,proto3" json:"reason,omitempty"`
+	Cidname  string                 `protobuf:"bytes,15,opt,name=cidname,proto3" json:"cidname,omitempty"`
+	Cidnum   string                 `protobuf:"bytes,16,opt,name=cidnum,proto3" json:"cidnum,omitempty"`
+	Owner    string                 `protobuf:"bytes,17,opt,name=owner,proto3" json:"owner,omitempty"`
+	Dcs      string                 `protobuf:"bytes,18,opt,name=dcs,proto3" json:"dcs,omitempty"`
+	// RECV, SEND or JOB
+	Direction string `protobuf:"bytes,19,opt,name=direction,proto3" json:"direction,omitempty"`
+	// OCR text of the first page of received faxes
+	Text       string `protobuf:"bytes,20,opt,name=text,proto3" json:"text,omitempty"`
+	ReasonCode string `protobuf:"bytes,21,opt,name=reason_code,json=reasonCode,proto3" json:"reason_code,omitempty"`
+	ReasonType string `protobuf:"bytes,22,opt,name=reason_type,json=reasonType,proto3" json:"reason_type,omitempty"`
+	// Job state of JOB records, e.g. active or done
+	State    string `protobuf:"bytes,23,opt,name=state,proto3" json:"state,omitempty"`
+	Ndials   int32  `protobuf:"varint,24,opt,name=ndials,proto3" json:"ndials,omitempty"`
+	Tottries int32  `protobuf:"varint,25,opt,name=tottries,proto3" json:"tottries,omitempty"`
+}
+
+func (x *FaxRecord) Reset() {
+	*x = FaxRecord{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_faxbridge_v1_faxbridge_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FaxRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FaxRecord) ProtoMessage() {}
+
+func (x *FaxRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_faxbridge_v1_faxbridge_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FaxRecord.ProtoReflect.Descriptor instead.
+func (*FaxRecord) Descriptor() ([]byte, []int) {
+	return file_faxbridge_v1_faxbridge_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FaxRecord) GetTs() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Ts
+	}
+	return nil
+}
+
+func (x *FaxRecord) GetCommid() string {
+	if x != nil {
+		return x.Commid
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetModem() string {
+	if x != nil {
+		return x.Modem
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetJobid() string {
+	if x != nil {
+		return x.Jobid
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetJobtag() string {
+	if x != nil {
+		return x.Jobtag
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetSender() string {
+	if x != nil {
+		return x.Sender
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetDestnum() string {
+	if x != nil {
+		return x.Destnum
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetRemoteId() string {
+	if x != nil {
+		return x.RemoteId
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetParams() string {
+	if x != nil {
+		return x.Params
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetPages() uint32 {
+	if x != nil {
+		return x.Pages
+	}
+	return 0
+}
+
+func (x *FaxRecord) GetJobtime() string {
+	if x != nil {
+		return x.Jobtime
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetConntime() string {
+	if x != nil {
+		return x.Conntime
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetCidname() string {
+	if x != nil {
+		return x.Cidname
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetCidnum() string {
+	if x != nil {
+		return x.Cidnum
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetDcs() string {
+	if x != nil {
+		return x.Dcs
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetDirection() string {
+	if x != nil {
+		return x.Direction
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetReasonCode() string {
+	if x != nil {
+		return x.ReasonCode
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetReasonType() string {
+	if x != nil {
+		return x.ReasonType
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *FaxRecord) GetNdials() int32 {
+	if x != nil {
+		return x.Ndials
+	}
+	return 0
+}
+
+func (x *FaxRecord) GetTottries() int32 {
+	if x != nil {
+		return x.Tottries
+	}
+	return 0
+}
+
+// FaxEvent is an event about the outcome of a relay, e.g. fax_received or relay_failed.
+type FaxEvent struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type     string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Time     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	Commid   string                 `protobuf:"bytes,3,opt,name=commid,proto3" json:"commid,omitempty"`
+	Cidnum   string                 `protobuf:"bytes,4,opt,name=cidnum,proto3" json:"cidnum,omitempty"`
+	Cidname  string                 `protobuf:"bytes,5,opt,name=cidname,proto3" json:"cidname,omitempty"`
+	Destnum  string                 `protobuf:"bytes,6,opt,name=destnum,proto3" json:"destnum,omitempty"`
+	Attempts int32                  `protobuf:"varint,7,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	Error    string                 `protobuf:"bytes,8,opt,name=error,proto3" json:"error,omitempty"`
+	// sendfax output of the last attempt
+	Output string `protobuf:"bytes,9,opt,name=output,proto3" json:"output,omitempty"`
+	// HylaFAX job of the relayed fax
+	Jobid      string     `protobuf:"bytes,10,opt,name=jobid,proto3" json:"jobid,omitempty"`
+	Reason     string     `protobuf:"bytes,11,opt,name=reason,proto3" json:"reason,omitempty"`
+	ReasonCode string     `protobuf:"bytes,12,opt,name=reason_code,json=reasonCode,proto3" json:"reason_code,omitempty"`
+	ReasonType string     `protobuf:"bytes,13,opt,name=reason_type,json=reasonType,proto3" json:"reason_type,omitempty"`
+	Record     *FaxRecord `protobuf:"bytes,14,opt,name=record,proto3" json:"record,omitempty"`
+}
+
+func (x *FaxEvent) Reset() {
+	*x = FaxEvent{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_faxbridge_v1_faxbridge_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FaxEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FaxEvent) ProtoMessage() {}
+
+func (x *FaxEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_faxbridge_v1_faxbridge_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FaxEvent.ProtoReflect.Descriptor instead.
+func (*FaxEvent) Descriptor() ([]byte, []int) {
+	return file_faxbridge_v1_faxbridge_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *FaxEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *FaxEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *FaxEvent) GetCommid() string {
+	if x != nil {
+		return x.Commid
+	}
+	return ""
+}
+
+func (x *FaxEvent) GetCidnum() string {
+	if x != nil {
+		return x.Cidnum
+	}
+	return ""
+}
+
+func (x *FaxEvent) GetCidname() string {
+	if x != nil {
+		return x.Cidname
+	}
+	return ""
+}
+
+func (x *FaxEvent) GetDestnum() string {
+	if x != nil {
+		return x.Destnum
+	}
+	return ""
+}
+
+func (x *FaxEvent) GetAttempts() int32 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+func (x *FaxEvent) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *FaxEvent) GetOutput() string {
+	if x != nil {
+		return x.Output
+	}
+	return ""
+}
+
+func (x *FaxEvent) GetJobid() string {
+	if x != nil {
+		return x.Jobid
+	}
+	return ""
+}
+
+func (x *FaxEvent) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *FaxEvent) GetReasonCode() string {
+	if x != nil {
+		return x.ReasonCode
+	}
+	return ""
+}
+
+func (x *FaxEvent) GetReasonType() string {
+	if x != nil {
+		return x.ReasonType
+	}
+	return ""
+}
+
+func (x *FaxEvent) GetRecord() *FaxRecord {
+	if x != nil {
+		return x.Record
+	}
+	return nil
+}
+
+type WatchFaxEventsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Event types to stream; all if empty
+	Types []string `protobuf:"bytes,1,rep,name=types,proto3" json:"types,omitempty"`
+}
+
+func (x *WatchFaxEventsRequest) Reset() {
+	*x = WatchFaxEventsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_faxbridge_v1_faxbridge_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *WatchFaxEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchFaxEventsRequest) ProtoMessage() {}
+
+func (x *WatchFaxEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_faxbridge_v1_faxbridge_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchFaxEventsRequest.ProtoReflect.Descriptor instead.
+func (*WatchFaxEventsRequest) Descriptor() ([]byte, []int) {
+	return file_faxbridge_v1_faxbridge_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *WatchFaxEventsRequest) GetTypes() []string {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+type ListFaxesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// RECV, SEND or JOB; all if empty
+	Direction string `protobuf:"bytes,1,opt,name=direction,proto3" json:"direction,omitempty"`
+	// Destination or caller ID number
+	Number string                 `protobuf:"bytes,2,opt,name=number,proto3" json:"number,omitempty"`
+	Since  *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=since,proto3" json:"since,omitempty"`
+	// Excluded
+	Until *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=until,proto3" json:"until,omitempty"`
+	// 1-based, default 1
+	Page int32 `protobuf:"varint,5,opt,name=page,proto3" json:"page,omitempty"`
+	// Default 50, at most 500
+	PerPage int32 `protobuf:"varint,6,opt,name=per_page,json=perPage,proto3" json:"per_page,omitempty"`
+}
+
+func (x *ListFaxesRequest) Reset() {
+	*x = ListFaxesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_faxbridge_v1_faxbridge_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListFaxesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFaxesRequest) ProtoMessage() {}
+
+func (x *ListFaxesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_faxbridge_v1_faxbridge_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFaxesRequest.ProtoReflect.Descriptor instead.
+func (*ListFaxesRequest) Descriptor() ([]byte, []int) {
+	return file_faxbridge_v1_faxbridge_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListFaxesRequest) GetDirection() string {
+	if x != nil {
+		return x.Direction
+	}
+	return ""
+}
+
+func (x *ListFaxesRequest) GetNumber() string {
+	if x != nil {
+		return x.Number
+	}
+	return ""
+}
+
+func (x *ListFaxesRequest) GetSince() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Since
+	}
+	return nil
+}
+
+func (x *ListFaxesRequest) GetUntil() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Until
+	}
+	return nil
+}
+
+func (x *ListFaxesRequest) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *ListFaxesRequest) GetPerPage() int32 {
+	if x != nil {
+		return x.PerPage
+	}
+	return 0
+}
+
+type ListFaxesResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Faxes   []*FaxRecord `protobuf:"bytes,1,rep,name=faxes,proto3" json:"faxes,omitempty"`
+	Page    int32        `protobuf:"varint,2,opt,name=page,proto3" json:"page,omitempty"`
+	PerPage int32        `protobuf:"varint,3,opt,name=per_page,json=perPage,proto3" json:"per_page,omitempty"`
+	Total   int32        `protobuf:"varint,4,opt,name=total,proto3" json:"total,omitempty"`
+}
+
+func (x *ListFaxesResponse) Reset() {
+	*x = ListFaxesResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_faxbridge_v1_faxbridge_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListFaxesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFaxesResponse) ProtoMessage() {}
+
+func (x *ListFaxesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_faxbridge_v1_faxbridge_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFaxesResponse.ProtoReflect.Descriptor instead.
+func (*ListFaxesResponse) Descriptor() ([]byte, []int) {
+	return file_faxbridge_v1_faxbridge_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListFaxesResponse) GetFaxes() []*FaxRecord {
+	if x != nil {
+		return x.Faxes
+	}
+	return nil
+}
+
+func (x *ListFaxesResponse) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *ListFaxesResponse) GetPerPage() int32 {
+	if x != nil {
+		return x.PerPage
+	}
+	return 0
+}
+
+func (x *ListFaxesResponse) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+type GetFaxRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Commid string `protobuf:"bytes,1,opt,name=commid,proto3" json:"commid,omitempty"`
+}
+
+func (x *GetFaxRequest) Reset() {
+	*x = GetFaxRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_faxbridge_v1_faxbridge_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetFaxRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetFaxRequest) ProtoMessage() {}
+
+func (x *GetFaxRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_faxbridge_v1_faxbridge_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetFaxRequest.ProtoReflect.Descriptor instead.
+func (*GetFaxRequest) Descriptor() ([]byte, []int) {
+	return file_faxbridge_v1_faxbridge_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetFaxRequest) GetCommid() string {
+	if x != nil {
+		return x.Commid
+	}
+	return ""
+}
+
+var File_faxbridge_v1_faxbridge_proto protoreflect.FileDescriptor
+
+var file_faxbridge_v1_faxbridge_proto_rawDesc = []byte{
+	0x0a, 0x1c, 0x66, 0x61, 0x78, 0x62, 0x72, 0x69, 0x64, 0x67, 0x65, 0x2f, 0x76, 0x31, 0x2f, 0x66,
+	0x61, 0x78, 0x62, 0x72, 0x69, 0x64, 0x67, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0c,
+	0x66, 0x61, 0x78, 0x62, 0x72, 0x69, 0x64, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x1a, 0x1f, 0x67, 0x6f,
+	0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69,
+	0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x92, 0x05,
+	0x0a, 0x09, 0x46, 0x61, 0x78, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x2a, 0x0a, 0x02, 0x74,
+	0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x52, 0x02, 0x74, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6d, 0x6d, 0x69,
+	0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x63, 0x6f, 0x6d, 0x6d, 0x69, 0x64, 0x12,
+	0x14, 0x0a, 0x05, 0x6d, 0x6f, 0x64, 0x65, 0x6d, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
+	0x6d, 0x6f, 0x64, 0x65, 0x6d, 0x12, 0x14, 0x0a, 0x05, 0x6a, 0x6f, 0x62, 0x69, 0x64, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6a, 0x6f, 0x62, 0x69, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x6a,
+	0x6f, 0x62, 0x74, 0x61, 0x67, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6a, 0x6f, 0x62,
+	0x74, 0x61, 0x67, 0x12, 0x1a, 0x0a, 0x08, 0x66, 0x69, 0x6c, 0x65, 0x6e, 0x61, 0x6d, 0x65, 0x18,
+	0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x66, 0x69, 0x6c, 0x65, 0x6e, 0x61, 0x6d, 0x65, 0x12,
+	0x16, 0x0a, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x64, 0x65, 0x73, 0x74, 0x6e,
+	0x75, 0x6d, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x64, 0x65, 0x73, 0x74, 0x6e, 0x75,
+	0x6d, 0x12, 0x1b, 0x0a, 0x09, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x09,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x49, 0x64, 0x12, 0x16,
+	0x0a, 0x06, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x73, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x70, 0x61, 0x72, 0x61, 0x6d, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x70, 0x61, 0x67, 0x65, 0x73, 0x18,
+	0x0b, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x70, 0x61, 0x67, 0x65, 0x73, 0x12, 0x18, 0x0a, 0x07,
+	0x6a, 0x6f, 0x62, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6a,
+	0x6f, 0x62, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x6f, 0x6e, 0x6e, 0x74, 0x69,
+	0x6d, 0x65, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x6f, 0x6e, 0x6e, 0x74, 0x69,
+	0x6d, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x0e, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x69,
+	0x64, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x69, 0x64,
+	0x6e, 0x61, 0x6d, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x69, 0x64, 0x6e, 0x75, 0x6d, 0x18, 0x10,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x63, 0x69, 0x64, 0x6e, 0x75, 0x6d, 0x12, 0x14, 0x0a, 0x05,
+	0x6f, 0x77, 0x6e, 0x65, 0x72, 0x18, 0x11, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6f, 0x77, 0x6e,
+	0x65, 0x72, 0x12, 0x10, 0x0a, 0x03, 0x64, 0x63, 0x73, 0x18, 0x12, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x03, 0x64, 0x63, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f,
+	0x6e, 0x18, 0x13, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x69,
+	0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x65, 0x78, 0x74, 0x18, 0x14, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x74, 0x65, 0x78, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e,
+	0x5f, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x15, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x72, 0x65, 0x61,
+	0x73, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x65, 0x61, 0x73, 0x6f,
+	0x6e, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x16, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x72, 0x65,
+	0x61, 0x73, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x74,
+	0x65, 0x18, 0x17, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x12, 0x16,
+	0x0a, 0x06, 0x6e, 0x64, 0x69, 0x61, 0x6c, 0x73, 0x18, 0x18, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06,
+	0x6e, 0x64, 0x69, 0x61, 0x6c, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x74, 0x6f, 0x74, 0x74, 0x72, 0x69,
+	0x65, 0x73, 0x18, 0x19, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x74, 0x6f, 0x74, 0x74, 0x72, 0x69,
+	0x65, 0x73, 0x22, 0x9d, 0x03, 0x0a, 0x08, 0x46, 0x61, 0x78, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12,
+	0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74,
+	0x79, 0x70, 0x65, 0x12, 0x2e, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x04, 0x74,
+	0x69, 0x6d, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6d, 0x6d, 0x69, 0x64, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x63, 0x6f, 0x6d, 0x6d, 0x69, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x63,
+	0x69, 0x64, 0x6e, 0x75, 0x6d, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x63, 0x69, 0x64,
+	0x6e, 0x75, 0x6d, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x69, 0x64, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x69, 0x64, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x18, 0x0a,
+	0x07, 0x64, 0x65, 0x73, 0x74, 0x6e, 0x75, 0x6d, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07,
+	0x64, 0x65, 0x73, 0x74, 0x6e, 0x75, 0x6d, 0x12, 0x1a, 0x0a, 0x08, 0x61, 0x74, 0x74, 0x65, 0x6d,
+	0x70, 0x74, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x61, 0x74, 0x74, 0x65, 0x6d,
+	0x70, 0x74, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x08, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x6f, 0x75, 0x74,
+	0x70, 0x75, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6f, 0x75, 0x74, 0x70, 0x75,
+	0x74, 0x12, 0x14, 0x0a, 0x05, 0x6a, 0x6f, 0x62, 0x69, 0x64, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x6a, 0x6f, 0x62, 0x69, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f,
+	0x6e, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12,
+	0x1f, 0x0a, 0x0b, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x5f, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x0c,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65,
+	0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18,
+	0x0d, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x54, 0x79, 0x70,
+	0x65, 0x12, 0x2f, 0x0a, 0x06, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x18, 0x0e, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x17, 0x2e, 0x66, 0x61, 0x78, 0x62, 0x72, 0x69, 0x64, 0x67, 0x65, 0x2e, 0x76, 0x31,
+	0x2e, 0x46, 0x61, 0x78, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x06, 0x72, 0x65, 0x63, 0x6f,
+	0x72, 0x64, 0x22, 0x2d, 0x0a, 0x15, 0x57, 0x61, 0x74, 0x63, 0x68, 0x46, 0x61, 0x78, 0x45, 0x76,
+	0x65, 0x6e, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x74,
+	0x79, 0x70, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x05, 0x74, 0x79, 0x70, 0x65,
+	0x73, 0x22, 0xdb, 0x01, 0x0a, 0x10, 0x4c, 0x69, 0x73, 0x74, 0x46, 0x61, 0x78, 0x65, 0x73, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1c, 0x0a, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74,
+	0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63,
+	0x74, 0x69, 0x6f, 0x6e, 0x12, 0x16, 0x0a, 0x06, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x30, 0x0a, 0x05,
+	0x73, 0x69, 0x6e, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f,
+	0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69,
+	0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x05, 0x73, 0x69, 0x6e, 0x63, 0x65, 0x12, 0x30,
+	0x0a, 0x05, 0x75, 0x6e, 0x74, 0x69, 0x6c, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e,
+	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e,
+	0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x05, 0x75, 0x6e, 0x74, 0x69, 0x6c,
+	0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x67, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04,
+	0x70, 0x61, 0x67, 0x65, 0x12, 0x19, 0x0a, 0x08, 0x70, 0x65, 0x72, 0x5f, 0x70, 0x61, 0x67, 0x65,
+	0x18, 0x06, 0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x70, 0x65, 0x72, 0x50, 0x61, 0x67, 0x65, 0x22,
+	0x87, 0x01, 0x0a, 0x11, 0x4c, 0x69, 0x73, 0x74, 0x46, 0x61, 0x78, 0x65, 0x73, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2d, 0x0a, 0x05, 0x66, 0x61, 0x78, 0x65, 0x73, 0x18, 0x01,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x66, 0x61, 0x78, 0x62, 0x72, 0x69, 0x64, 0x67, 0x65,
+	0x2e, 0x76, 0x31, 0x2e, 0x46, 0x61, 0x78, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x05, 0x66,
+	0x61, 0x78, 0x65, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x04, 0x70, 0x61, 0x67, 0x65, 0x12, 0x19, 0x0a, 0x08, 0x70, 0x65, 0x72, 0x5f,
+	0x70, 0x61, 0x67, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x70, 0x65, 0x72, 0x50,
+	0x61, 0x67, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x05, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x22, 0x27, 0x0a, 0x0d, 0x47, 0x65, 0x74,
+	0x46, 0x61, 0x78, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f,
+	0x6d, 0x6d, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x63, 0x6f, 0x6d, 0x6d,
+	0x69, 0x64, 0x32, 0xea, 0x01, 0x0a, 0x09, 0x46, 0x61, 0x78, 0x42, 0x72, 0x69, 0x64, 0x67, 0x65,
+	0x12, 0x4f, 0x0a, 0x0e, 0x57, 0x61, 0x74, 0x63, 0x68, 0x46, 0x61, 0x78, 0x45, 0x76, 0x65, 0x6e,
+	0x74, 0x73, 0x12, 0x23, 0x2e, 0x66, 0x61, 0x78, 0x62, 0x72, 0x69, 0x64, 0x67, 0x65, 0x2e, 0x76,
+	0x31, 0x2e, 0x57, 0x61, 0x74, 0x63, 0x68, 0x46, 0x61, 0x78, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x73,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x66, 0x61, 0x78, 0x62, 0x72, 0x69,
+	0x64, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x46, 0x61, 0x78, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x30,
+	0x01, 0x12, 0x4c, 0x0a, 0x09, 0x4c, 0x69, 0x73, 0x74, 0x46, 0x61, 0x78, 0x65, 0x73, 0x12, 0x1e,
+	0x2e, 0x66, 0x61, 0x78, 0x62, 0x72, 0x69, 0x64, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x4c, 0x69,
+	0x73, 0x74, 0x46, 0x61, 0x78, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1f,
+	0x2e, 0x66, 0x61, 0x78, 0x62, 0x72, 0x69, 0x64, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x4c, 0x69,
+	0x73, 0x74, 0x46, 0x61, 0x78, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x3e, 0x0a, 0x06, 0x47, 0x65, 0x74, 0x46, 0x61, 0x78, 0x12, 0x1b, 0x2e, 0x66, 0x61, 0x78, 0x62,
+	0x72, 0x69, 0x64, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74, 0x46, 0x61, 0x78, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x17, 0x2e, 0x66, 0x61, 0x78, 0x62, 0x72, 0x69, 0x64,
+	0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x46, 0x61, 0x78, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x42,
+	0x34, 0x5a, 0x32, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x73, 0x61,
+	0x67, 0x6f, 0x73, 0x74, 0x69, 0x6e, 0x2f, 0x67, 0x6f, 0x66, 0x61, 0x78, 0x69, 0x70, 0x2d, 0x62,
+	0x72, 0x69, 0x64, 0x67, 0x65, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x66, 0x61, 0x78, 0x62, 0x72, 0x69,
+	0x64, 0x67, 0x65, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_faxbridge_v1_faxbridge_proto_rawDescOnce sync.Once
+	file_faxbridge_v1_faxbridge_proto_rawDescData = file_faxbridge_v1_faxbridge_proto_rawDesc
+)
+
+func file_faxbridge_v1_faxbridge_proto_rawDescGZIP() []byte {
+	file_faxbridge_v1_faxbridge_proto_rawDescOnce.Do(func() {
+		file_faxbridge_v1_faxbridge_proto_rawDescData = protoimpl.X.CompressGZIP(file_faxbridge_v1_faxbridge_proto_rawDescData)
+	})
+	return file_faxbridge_v1_faxbridge_proto_rawDescData
+}
+
+var file_faxbridge_v1_faxbridge_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_faxbridge_v1_faxbridge_proto_goTypes = []interface{}{
+	(*FaxRecord)(nil),             // 0: faxbridge.v1.FaxRecord
+	(*FaxEvent)(nil),              // 1: faxbridge.v1.FaxEvent
+	(*WatchFaxEventsRequest)(nil), // 2: faxbridge.v1.WatchFaxEventsRequest
+	(*ListFaxesRequest)(nil),      // 3: faxbridge.v1.ListFaxesRequest
+	(*ListFaxesResponse)(nil),     // 4: faxbridge.v1.ListFaxesResponse
+	(*GetFaxRequest)(nil),         // 5: faxbridge.v1.GetFaxRequest
+	(*timestamppb.Timestamp)(nil), // 6: google.protobuf.Timestamp
+}
+var file_faxbridge_v1_faxbridge_proto_depIdxs = []int32{
+	6, // 0: faxbridge.v1.FaxRecord.ts:type_name -> google.protobuf.Timestamp
+	6, // 1: faxbridge.v1.FaxEvent.time:type_name -> google.protobuf.Timestamp
+	0, // 2: faxbridge.v1.FaxEvent.record:type_name -> faxbridge.v1.FaxRecord
+	6, // 3: faxbridge.v1.ListFaxesRequest.since:type_name -> google.protobuf.Timestamp
+	6, // 4: faxbridge.v1.ListFaxesRequest.until:type_name -> google.protobuf.Timestamp
+	0, // 5: faxbridge.v1.ListFaxesResponse.faxes:type_name -> faxbridge.v1.FaxRecord
+	2, // 6: faxbridge.v1.FaxBridge.WatchFaxEvents:input_type -> faxbridge.v1.WatchFaxEventsRequest
+	3, // 7: faxbridge.v1.FaxBridge.ListFaxes:input_type -> faxbridge.v1.ListFaxesRequest
+	5, // 8: faxbridge.v1.FaxBridge.GetFax:input_type -> faxbridge.v1.GetFaxRequest
+	1, // 9: faxbridge.v1.FaxBridge.WatchFaxEvents:output_type -> faxbridge.v1.FaxEvent
+	4, // 10: faxbridge.v1.FaxBridge.ListFaxes:output_type -> faxbridge.v1.ListFaxesResponse
+	0, // 11: faxbridge.v1.FaxBridge.GetFax:output_type -> faxbridge.v1.FaxRecord
+	9, // [9:12] is the sub-list for method output_type
+	6, // [6:9] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_faxbridge_v1_faxbridge_proto_init() }
+func file_faxbridge_v1_faxbridge_proto_init() {
+	if File_faxbridge_v1_faxbridge_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_faxbridge_v1_faxbridge_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FaxRecord); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_faxbridge_v1_faxbridge_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FaxEvent); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_faxbridge_v1_faxbridge_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*WatchFaxEventsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_faxbridge_v1_faxbridge_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListFaxesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_faxbridge_v1_faxbridge_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListFaxesResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_faxbridge_v1_faxbridge_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetFaxRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_faxbridge_v1_faxbridge_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_faxbridge_v1_faxbridge_proto_goTypes,
+		DependencyIndexes: file_faxbridge_v1_faxbridge_proto_depIdxs,
+		MessageInfos:      file_faxbridge_v1_faxbridge_proto_msgTypes,
+	}.Build()
+	File_faxbridge_v1_faxbridge_proto = out.File
+	file_faxbridge_v1_faxbridge_proto_rawDesc = nil
+	file_faxbridge_v1_faxbridge_proto_goTypes = nil
+	file_faxbridge_v1_faxbridge_proto_depIdxs = nil
+}
@@ -0,0 +1,217 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: faxbridge/v1/faxbridge.proto
+
+package faxbridgepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	FaxBridge_WatchFaxEvents_FullMethodName = "/faxbridge.v1.FaxBridge/WatchFaxEvents"
+	FaxBridge_ListFaxes_FullMethodName      = "/faxbridge.v1.FaxBridge/ListFaxes"
+	FaxBridge_GetFax_FullMethodName         = "/faxbridge.v1.FaxBridge/GetFax"
+)
+
+// FaxBridgeClient is the client API for FaxBridge service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FaxBridgeClient interface {
+	// WatchFaxEvents streams the events the bridge emits from now on.
+	WatchFaxEvents(ctx context.Context, in *WatchFaxEventsRequest, opts ...grpc.CallOption) (FaxBridge_WatchFaxEventsClient, error)
+	// ListFaxes returns stored records, newest first.
+	ListFaxes(ctx context.Context, in *ListFaxesRequest, opts ...grpc.CallOption) (*ListFaxesResponse, error)
+	// GetFax returns the stored record of a commid.
+	GetFax(ctx context.Context, in *GetFaxRequest, opts ...grpc.CallOption) (*FaxRecord, error)
+}
+
+type faxBridgeClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFaxBridgeClient(cc grpc.ClientConnInterface) FaxBridgeClient {
+	return &faxBridgeClient{cc}
+}
+
+func (c *faxBridgeClient) WatchFaxEvents(ctx context.Context, in *WatchFaxEventsRequest, opts ...grpc.CallOption) (FaxBridge_WatchFaxEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FaxBridge_ServiceDesc.Streams[0], FaxBridge_WatchFaxEvents_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &faxBridgeWatchFaxEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type FaxBridge_WatchFaxEventsClient interface {
+	Recv() (*FaxEvent, error)
+	grpc.ClientStream
+}
+
+type faxBridgeWatchFaxEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *faxBridgeWatchFaxEventsClient) Recv() (*FaxEvent, error) {
+	m := new(FaxEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *faxBridgeClient) ListFaxes(ctx context.Context, in *ListFaxesRequest, opts ...grpc.CallOption) (*ListFaxesResponse, error) {
+	out := new(ListFaxesResponse)
+	err := c.cc.Invoke(ctx, FaxBridge_ListFaxes_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *faxBridgeClient) GetFax(ctx context.Context, in *GetFaxRequest, opts ...grpc.CallOption) (*FaxRecord, error) {
+	out := new(FaxRecord)
+	err := c.cc.Invoke(ctx, FaxBridge_GetFax_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FaxBridgeServer is the server API for FaxBridge service.
+// All implementations must embed UnimplementedFaxBridgeServer
+// for forward compatibility
+type FaxBridgeServer interface {
+	// WatchFaxEvents streams the events the bridge emits from now on.
+	WatchFaxEvents(*WatchFaxEventsRequest, FaxBridge_WatchFaxEventsServer) error
+	// ListFaxes returns stored records, newest first.
+	ListFaxes(context.Context, *ListFaxesRequest) (*ListFaxesResponse, error)
+	// GetFax returns the stored record of a commid.
+	GetFax(context.Context, *GetFaxRequest) (*FaxRecord, error)
+	mustEmbedUnimplementedFaxBridgeServer()
+}
+
+// UnimplementedFaxBridgeServer must be embedded to have forward compatible implementations.
+type UnimplementedFaxBridgeServer struct {
+}
+
+func (UnimplementedFaxBridgeServer) WatchFaxEvents(*WatchFaxEventsRequest, FaxBridge_WatchFaxEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchFaxEvents not implemented")
+}
+func (UnimplementedFaxBridgeServer) ListFaxes(context.Context, *ListFaxesRequest) (*ListFaxesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFaxes not implemented")
+}
+func (UnimplementedFaxBridgeServer) GetFax(context.Context, *GetFaxRequest) (*FaxRecord, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFax not implemented")
+}
+func (UnimplementedFaxBridgeServer) mustEmbedUnimplementedFaxBridgeServer() {}
+
+// UnsafeFaxBridgeServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FaxBridgeServer will
+// result in compilation errors.
+type UnsafeFaxBridgeServer interface {
+	mustEmbedUnimplementedFaxBridgeServer()
+}
+
+func RegisterFaxBridgeServer(s grpc.ServiceRegistrar, srv FaxBridgeServer) {
+	s.RegisterService(&FaxBridge_ServiceDesc, srv)
+}
+
+func _FaxBridge_WatchFaxEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchFaxEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FaxBridgeServer).WatchFaxEvents(m, &faxBridgeWatchFaxEventsServer{stream})
+}
+
+type FaxBridge_WatchFaxEventsServer interface {
+	Send(*FaxEvent) error
+	grpc.ServerStream
+}
+
+type faxBridgeWatchFaxEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *faxBridgeWatchFaxEventsServer) Send(m *FaxEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _FaxBridge_ListFaxes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFaxesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FaxBridgeServer).ListFaxes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FaxBridge_ListFaxes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FaxBridgeServer).ListFaxes(ctx, req.(*ListFaxesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FaxBridge_GetFax_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetFaxRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FaxBridgeServer).GetFax(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FaxBridge_GetFax_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FaxBridgeServer).GetFax(ctx, req.(*GetFaxRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// FaxBridge_ServiceDesc is the grpc.ServiceDesc for FaxBridge service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FaxBridge_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "faxbridge.v1.FaxBridge",
+	HandlerType: (*FaxBridgeServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListFaxes",
+			Handler:    _FaxBridge_ListFaxes_Handler,
+		},
+		{
+			MethodName: "GetFax",
+			Handler:    _FaxBridge_GetFax_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchFaxEvents",
+			Handler:       _FaxBridge_WatchFaxEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "faxbridge/v1/faxbridge.proto",
+}
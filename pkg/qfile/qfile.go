@@ -0,0 +1,410 @@
+// Package qfile reads and writes HylaFAX queue files, locking them with
+// flock like HylaFAX does.
+package qfile
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// NewQfileMode is the default access mode for created queue files
+	NewQfileMode = 0660
+)
+
+type param struct {
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+// A Qfiler handles parameters to communicate with HylaFAX
+type Qfiler interface {
+	Write() error
+	WriteAtomic() error
+	GetAll(tag string) []string
+	GetString(tag string) string
+	GetInt(tag string) (int, error)
+	GetFloat(tag string) (float64, error)
+	GetBool(tag string) (bool, error)
+	GetTime(tag string) (time.Time, error)
+	GetDuration(tag string) (time.Duration, error)
+	Documents() ([]Document, error)
+	Set(tag, value string)
+	Add(tag, value string)
+}
+
+// A Document is a document entry of a queue file, like
+// "!tiff:0::docq/doc5.tif" (tag:dirnum:addr:path).
+type Document struct {
+	Type   string `json:"type"`   // Tag without the leading !, e.g. tiff, pdf, postscript or fax
+	Dirnum int    `json:"dirnum"` // TIFF directory (page) to start sending at
+	Addr   string `json:"addr,omitempty"`
+	Path   string `json:"path"` // Relative to the spooler directory
+}
+
+// documentTypes are the tags of document entries, with or without a
+// leading !. fax entries are documents imaged for transmission.
+var documentTypes = map[string]bool{
+	"tiff":       true,
+	"pdf":        true,
+	"postscript": true,
+	"pcl":        true,
+	"data":       true,
+	"fax":        true,
+}
+
+// Qfile is a HylaFAX queue file
+type Qfile struct {
+	filename string
+	qfh      *os.File
+	params   []param
+	readOnly bool
+}
+
+// ErrNotFound is returned by the typed getters if the tag is not set.
+var ErrNotFound = errors.New("tag not found")
+
+// ErrReadOnly is returned when writing a queue file opened with
+// OpenQfileRead.
+var ErrReadOnly = errors.New("queue file is opened read-only")
+
+// ErrLocked is returned by OpenQfile and OpenQfileRead with NonBlocking if the queue file is
+// locked by someone else.
+var ErrLocked = errors.New("queue file is locked")
+
+// An Option changes how OpenQfile and OpenQfileRead open a queue file.
+type Option func(*openOptions)
+
+type openOptions struct {
+	noLock      bool
+	nonBlocking bool
+}
+
+// NoLock opens the queue file without locking it. A concurrent writer may
+// then be read half done, so only use it where nothing else writes it.
+func NoLock() Option {
+	return func(o *openOptions) { o.noLock = true }
+}
+
+// NonBlocking fails with ErrLocked instead of waiting for the lock.
+func NonBlocking() Option {
+	return func(o *openOptions) { o.nonBlocking = true }
+}
+
+// OpenQfile opens and parses a HylaFAX queue file. It is locked until it is
+// closed. Comments are not kept when it is written.
+func OpenQfile(filename string, opts ...Option) (*Qfile, error) {
+	return openQfile(filename, os.O_RDWR, syscall.LOCK_EX, opts)
+}
+
+// OpenQfileRead opens and parses a HylaFAX queue file read-only, holding a
+// shared lock until it is closed. faxq can't change it meanwhile, but other
+// readers don't have to wait. It can't be written.
+func OpenQfileRead(filename string, opts ...Option) (*Qfile, error) {
+	q, err := openQfile(filename, os.O_RDONLY, syscall.LOCK_SH, opts)
+	if err != nil {
+		return nil, err
+	}
+	q.readOnly = true
+	return q, nil
+}
+
+func openQfile(filename string, flag, lock int, opts []Option) (*Qfile, error) {
+	var o openOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Open queue file
+	qfh, err := os.OpenFile(filename, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Qfile{
+		filename: filename,
+		qfh:      qfh,
+	}
+
+	// Lock queue file using flock (like Hylafax)
+	if !o.noLock {
+		how := lock
+		if o.nonBlocking {
+			how |= syscall.LOCK_NB
+		}
+		if err := syscall.Flock(int(qfh.Fd()), how); err != nil {
+			qfh.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				return nil, fmt.Errorf("%s: %w", filename, ErrLocked)
+			}
+			return nil, err
+		}
+	}
+
+	// Read tags
+	scanner := bufio.NewScanner(qfh)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if trimmed := strings.TrimSpace(text); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			// Comments and blank lines are skipped like HylaFAX does
+			continue
+		}
+		parts := strings.SplitN(text, ":", 2)
+		if len(parts) != 2 {
+			qfh.Close()
+			return nil, fmt.Errorf("%s: Error parsing line: %s", filename, text)
+		}
+		q.params = append(q.params, param{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])})
+	}
+
+	if err = scanner.Err(); err != nil {
+		qfh.Close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Filename returns the path the queue file was opened with.
+func (q *Qfile) Filename() string {
+	return q.filename
+}
+
+// Close closes an open queue file
+func (q *Qfile) Close() error {
+	return q.qfh.Close()
+}
+
+// Write re-writes an opened queue file
+func (q *Qfile) Write() error {
+	if q.readOnly {
+		return ErrReadOnly
+	}
+	if _, err := q.qfh.Seek(0, 0); err != nil {
+		return err
+	}
+
+	var bytes int64
+	for _, param := range q.params {
+		n, err := fmt.Fprintf(q.qfh, "%s:%s\n", param.Tag, param.Value)
+		if err != nil {
+			return err
+		}
+		bytes += int64(n)
+	}
+
+	if err := q.qfh.Truncate(bytes); err != nil {
+		return err
+	}
+
+	if err := q.qfh.Sync(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WriteAtomic re-writes an opened queue file by writing a temporary file
+// next to it and renaming it into place, so a crash can't leave a partly
+// written queue file behind. The new file keeps the owner and mode of the
+// old one and is locked before it replaces it.
+func (q *Qfile) WriteAtomic() error {
+	if q.readOnly {
+		return ErrReadOnly
+	}
+	fi, err := q.qfh.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(q.filename), "."+filepath.Base(q.filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	keep := false
+	defer func() {
+		if !keep {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		if err := tmp.Chown(int(st.Uid), int(st.Gid)); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Chmod(fi.Mode().Perm()); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	for _, param := range q.params {
+		if _, err := fmt.Fprintf(w, "%s:%s\n", param.Tag, param.Value); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+
+	// Lock before renaming, so nobody can lock the new file in between
+	if err := syscall.Flock(int(tmp.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), q.filename); err != nil {
+		return err
+	}
+	keep = true
+	if dir, err := os.Open(filepath.Dir(q.filename)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	// Closing the old file releases its lock
+	old := q.qfh
+	q.qfh = tmp
+	return old.Close()
+}
+
+// MarshalJSON returns the parameters in file order, as a list of objects
+// with tag and value.
+func (q *Qfile) MarshalJSON() ([]byte, error) {
+	if q.params == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(q.params)
+}
+
+// GetAll returns a slice containing all values for
+// given tag.
+func (q *Qfile) GetAll(tag string) []string {
+	var result []string
+	for _, param := range q.params {
+		if param.Tag == tag {
+			result = append(result, param.Value)
+		}
+	}
+	return result
+}
+
+// GetString returns the value of the first parameter with given tag as string.
+func (q *Qfile) GetString(tag string) string {
+	for _, param := range q.params {
+		if param.Tag == tag {
+			return param.Value
+		}
+	}
+	return ""
+}
+
+// GetInt looks up the value of the first parameter with given tag
+// and returns the parsed value as int.
+func (q *Qfile) GetInt(tag string) (int, error) {
+	if str := q.GetString(tag); str != "" {
+		return strconv.Atoi(str)
+	}
+	return 0, ErrNotFound
+}
+
+// GetFloat returns the value of the first parameter with given tag
+// parsed as float, like chopthreshold.
+func (q *Qfile) GetFloat(tag string) (float64, error) {
+	if str := q.GetString(tag); str != "" {
+		return strconv.ParseFloat(str, 64)
+	}
+	return 0, ErrNotFound
+}
+
+// GetBool returns the value of the first parameter with given tag
+// parsed as bool, like useccover (HylaFAX writes 0 or 1).
+func (q *Qfile) GetBool(tag string) (bool, error) {
+	if str := q.GetString(tag); str != "" {
+		return strconv.ParseBool(str)
+	}
+	return false, ErrNotFound
+}
+
+// GetTime returns the value of the first parameter with given tag
+// parsed as Unix time, like tts or killtime.
+func (q *Qfile) GetTime(tag string) (time.Time, error) {
+	if str := q.GetString(tag); str != "" {
+		sec, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(sec, 0), nil
+	}
+	return time.Time{}, ErrNotFound
+}
+
+// GetDuration returns the value of the first parameter with given tag
+// parsed as seconds, like retrytime.
+func (q *Qfile) GetDuration(tag string) (time.Duration, error) {
+	if str := q.GetString(tag); str != "" {
+		sec, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(sec) * time.Second, nil
+	}
+	return 0, ErrNotFound
+}
+
+// Documents returns the document entries in file order.
+func (q *Qfile) Documents() ([]Document, error) {
+	var docs []Document
+	for _, param := range q.params {
+		docType := strings.TrimPrefix(param.Tag, "!")
+		if !documentTypes[docType] {
+			continue
+		}
+		parts := strings.SplitN(param.Value, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%s: invalid document %s:%s", q.filename, param.Tag, param.Value)
+		}
+		dirnum, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid dirnum of document %s:%s", q.filename, param.Tag, param.Value)
+		}
+		docs = append(docs, Document{
+			Type:   docType,
+			Dirnum: dirnum,
+			Addr:   parts[1],
+			Path:   strings.TrimSpace(strings.TrimSuffix(parts[2], "\"")),
+		})
+	}
+	return docs, nil
+}
+
+// Set replaces the value of the first found param
+// with given value.
+// If the param does not exist, it is appended.
+func (q *Qfile) Set(tag string, value string) {
+	for i, param := range q.params {
+		if param.Tag == tag {
+			q.params[i].Value = value
+			return
+		}
+	}
+
+	// If we haven't been able to update it, add it instead.
+	q.Add(tag, value)
+}
+
+// Add adds a param with given tag and value. If the
+// tag already exists, a second one is added.
+func (q *Qfile) Add(tag string, value string) {
+	q.params = append(q.params, param{tag, value})
+}
@@ -0,0 +1,270 @@
+package qfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testQfile = `# written by faxq
+state:6
+number:+15551234567
+external:5551234567
+
+tts:1700000000
+retrytime:300
+chopthreshold:3.5
+useccover:1
+status:Busy signal detected
+status:No carrier detected
+!postscript:0::docq/doc4.ps
+fax:2:abc:docq/doc4.ps;41
+tiff:0::docq/doc5.tif"
+`
+
+func writeTestQfile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "q5")
+	if err := os.WriteFile(path, []byte(content), NewQfileMode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func openTestQfile(t *testing.T, content string, opts ...Option) *Qfile {
+	t.Helper()
+	q, err := OpenQfile(writeTestQfile(t, content), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestParse(t *testing.T) {
+	q := openTestQfile(t, testQfile)
+
+	if got := q.GetString("number"); got != "+15551234567" {
+		t.Errorf("number = %q, want +15551234567", got)
+	}
+	if got := q.GetString("missing"); got != "" {
+		t.Errorf("missing = %q, want empty", got)
+	}
+	if got := q.GetString("# written by faxq"); got != "" {
+		t.Errorf("comment was parsed as a tag: %q", got)
+	}
+	// Repeated tags keep all values, GetString returns the first
+	want := []string{"Busy signal detected", "No carrier detected"}
+	if got := q.GetAll("status"); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAll(status) = %q, want %q", got, want)
+	}
+	if got := q.GetString("status"); got != want[0] {
+		t.Errorf("status = %q, want %q", got, want[0])
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	path := writeTestQfile(t, "state:6\nnot a tag\n")
+	if _, err := OpenQfile(path); err == nil {
+		t.Fatal("expected an error for a line without a colon")
+	}
+}
+
+func TestDocuments(t *testing.T) {
+	q := openTestQfile(t, testQfile)
+
+	docs, err := q.Documents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Document{
+		{Type: "postscript", Dirnum: 0, Path: "docq/doc4.ps"},
+		{Type: "fax", Dirnum: 2, Addr: "abc", Path: "docq/doc4.ps;41"},
+		{Type: "tiff", Dirnum: 0, Path: "docq/doc5.tif"},
+	}
+	if !reflect.DeepEqual(docs, want) {
+		t.Errorf("Documents() = %+v, want %+v", docs, want)
+	}
+
+	q = openTestQfile(t, "tiff:x::docq/doc5.tif\n")
+	if _, err := q.Documents(); err == nil {
+		t.Error("expected an error for an invalid dirnum")
+	}
+	q = openTestQfile(t, "tiff:docq/doc5.tif\n")
+	if _, err := q.Documents(); err == nil {
+		t.Error("expected an error for a document without addr")
+	}
+}
+
+func TestTypedGetters(t *testing.T) {
+	q := openTestQfile(t, testQfile+"badint:x\n")
+
+	if v, err := q.GetInt("state"); err != nil || v != 6 {
+		t.Errorf("GetInt(state) = %d, %v", v, err)
+	}
+	if v, err := q.GetFloat("chopthreshold"); err != nil || v != 3.5 {
+		t.Errorf("GetFloat(chopthreshold) = %g, %v", v, err)
+	}
+	if v, err := q.GetBool("useccover"); err != nil || !v {
+		t.Errorf("GetBool(useccover) = %t, %v", v, err)
+	}
+	if v, err := q.GetTime("tts"); err != nil || !v.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("GetTime(tts) = %s, %v", v, err)
+	}
+	if v, err := q.GetDuration("retrytime"); err != nil || v != 5*time.Minute {
+		t.Errorf("GetDuration(retrytime) = %s, %v", v, err)
+	}
+
+	if _, err := q.GetInt("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetInt(missing) error = %v, want ErrNotFound", err)
+	}
+	if _, err := q.GetTime("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetTime(missing) error = %v, want ErrNotFound", err)
+	}
+	if _, err := q.GetInt("badint"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("GetInt(badint) error = %v, want a parse error", err)
+	}
+}
+
+func TestSetAdd(t *testing.T) {
+	q := openTestQfile(t, testQfile)
+
+	q.Set("status", "Done")
+	want := []string{"Done", "No carrier detected"}
+	if got := q.GetAll("status"); !reflect.DeepEqual(got, want) {
+		t.Errorf("after Set, GetAll(status) = %q, want %q", got, want)
+	}
+	q.Set("new", "1")
+	if got := q.GetString("new"); got != "1" {
+		t.Errorf("Set of a missing tag: new = %q, want 1", got)
+	}
+	q.Add("new", "2")
+	if got := q.GetAll("new"); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("after Add, GetAll(new) = %q", got)
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	for name, write := range map[string]func(*Qfile) error{
+		"Write":       (*Qfile).Write,
+		"WriteAtomic": (*Qfile).WriteAtomic,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := writeTestQfile(t, testQfile)
+			before, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := OpenQfile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer q.Close()
+			// Shrinking the file checks that Write truncates it
+			q.params = q.params[:2]
+			q.Set("state", "7")
+			q.Add("status", "ok")
+			if err := write(q); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "state:7\nnumber:+15551234567\nstatus:ok\n"; string(data) != want {
+				t.Errorf("written file = %q, want %q", data, want)
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode() != before.Mode() {
+				t.Errorf("mode = %s, want %s", fi.Mode(), before.Mode())
+			}
+
+			// The file stays locked and writable after WriteAtomic
+			// replaced it
+			if _, err := OpenQfile(path, NonBlocking()); !errors.Is(err, ErrLocked) {
+				t.Errorf("reopening while held: error = %v, want ErrLocked", err)
+			}
+			q.Set("state", "8")
+			if err := write(q); err != nil {
+				t.Fatal(err)
+			}
+			q.Close()
+			reread, err := OpenQfileRead(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reread.Close()
+			if got := reread.GetString("state"); got != "8" {
+				t.Errorf("state = %q, want 8", got)
+			}
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	q, err := OpenQfileRead(writeTestQfile(t, testQfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	q.Set("state", "7")
+	if err := q.Write(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Write() error = %v, want ErrReadOnly", err)
+	}
+	if err := q.WriteAtomic(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("WriteAtomic() error = %v, want ErrReadOnly", err)
+	}
+}
+
+func TestNonBlocking(t *testing.T) {
+	path := writeTestQfile(t, testQfile)
+	held, err := OpenQfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenQfile(path, NonBlocking()); !errors.Is(err, ErrLocked) {
+		t.Errorf("OpenQfile error = %v, want ErrLocked", err)
+	}
+	if _, err := OpenQfileRead(path, NonBlocking()); !errors.Is(err, ErrLocked) {
+		t.Errorf("OpenQfileRead error = %v, want ErrLocked", err)
+	}
+	q, err := OpenQfile(path, NoLock())
+	if err != nil {
+		t.Fatalf("OpenQfile with NoLock: %s", err)
+	}
+	q.Close()
+
+	held.Close()
+	q, err = OpenQfile(path, NonBlocking())
+	if err != nil {
+		t.Fatalf("OpenQfile after the lock was released: %s", err)
+	}
+	q.Close()
+}
+
+func TestSharedLock(t *testing.T) {
+	path := writeTestQfile(t, testQfile)
+	r1, err := OpenQfileRead(path, NonBlocking())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r1.Close()
+
+	r2, err := OpenQfileRead(path, NonBlocking())
+	if err != nil {
+		t.Fatalf("second reader: %s", err)
+	}
+	r2.Close()
+	if _, err := OpenQfile(path, NonBlocking()); !errors.Is(err, ErrLocked) {
+		t.Errorf("writer while read: error = %v, want ErrLocked", err)
+	}
+}
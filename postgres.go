@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+func init() {
+	RegisterSink("postgres", newPostgresSink)
+}
+
+var sqlIdentifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)?$`)
+
+// postgresSchema creates the records table; %s is the table name.
+const postgresSchema = `CREATE TABLE IF NOT EXISTS %s (
+	commid      text PRIMARY KEY,
+	ts          timestamptz NOT NULL,
+	direction   text NOT NULL,
+	modem       text NOT NULL DEFAULT '',
+	jobid       text NOT NULL DEFAULT '',
+	jobtag      text NOT NULL DEFAULT '',
+	filename    text NOT NULL DEFAULT '',
+	sender      text NOT NULL DEFAULT '',
+	destnum     text NOT NULL DEFAULT '',
+	remote_id   text NOT NULL DEFAULT '',
+	params      text NOT NULL DEFAULT '',
+	pages       integer NOT NULL DEFAULT 0,
+	jobtime     text NOT NULL DEFAULT '',
+	conntime    text NOT NULL DEFAULT '',
+	reason      text NOT NULL DEFAULT '',
+	cidname     text NOT NULL DEFAULT '',
+	cidnum      text NOT NULL DEFAULT '',
+	owner       text NOT NULL DEFAULT '',
+	dcs         text NOT NULL DEFAULT '',
+	record      jsonb NOT NULL,
+	inserted_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS %[2]s_ts_idx ON %[1]s (ts);
+CREATE INDEX IF NOT EXISTS %[2]s_destnum_idx ON %[1]s (destnum);
+CREATE INDEX IF NOT EXISTS %[2]s_cidnum_idx ON %[1]s (cidnum);`
+
+// PostgresSink stores records in a PostgreSQL table, creating it if needed.
+// Records are inserted in batches; a record with a commid already stored
+// replaces the stored one.
+type PostgresSink struct {
+	DSN   string `json:"dsn"`   // e.g. postgres://bridge:secret@db/fax?sslmode=require
+	Table string `json:"table"` // Default: fax_records
+	BatchOptions
+
+	db *sql.DB
+	*recordBatcher
+}
+
+func newPostgresSink(raw json.RawMessage, env SinkEnv) (Sink, error) {
+	s := &PostgresSink{Table: "fax_records"}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	if s.DSN == "" {
+		return nil, fmt.Errorf("dsn is required")
+	}
+	if !sqlIdentifier.MatchString(s.Table) {
+		return nil, fmt.Errorf("invalid table name %q", s.Table)
+	}
+
+	db, err := sql.Open("postgres", s.DSN)
+	if err != nil {
+		return nil, err
+	}
+	s.db = db
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s.recordBatcher = startBatcher(env.Name, s.BatchOptions, s.insert)
+	return s, nil
+}
+
+// Close flushes the buffered records and closes the database.
+func (s *PostgresSink) Close() error {
+	s.recordBatcher.Close()
+	return s.db.Close()
+}
+
+// migrate creates the table and its indexes.
+func (s *PostgresSink) migrate() error {
+	index := strings.ReplaceAll(s.Table, ".", "_")
+	if _, err := s.db.Exec(fmt.Sprintf(postgresSchema, s.Table, index)); err != nil {
+		return fmt.Errorf("error creating table %s: %w", s.Table, err)
+	}
+	return nil
+}
+
+// insert upserts a batch of records in one statement.
+func (s *PostgresSink) insert(ctx context.Context, records []XFRecord) error {
+	keyed := make([]XFRecord, len(records))
+	for i, r := range records {
+		r.Commid = recordKey(r)
+		keyed[i] = r
+	}
+	records = latestByCommid(keyed)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES ", s.Table, strings.Join(recordColumns, ", "))
+	args := make([]any, 0, len(records)*len(recordColumns))
+	for i, r := range records {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for j := range recordColumns {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", len(args)+j+1)
+		}
+		b.WriteString(")")
+		args = append(args, recordValues(r)...)
+	}
+
+	b.WriteString(" ON CONFLICT (commid) DO UPDATE SET ")
+	for i, c := range recordColumns[1:] {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s = EXCLUDED.%s", c, c)
+	}
+
+	if _, err := s.db.ExecContext(ctx, b.String(), args...); err != nil {
+		return fmt.Errorf("error inserting records: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// startPprof serves the pprof profiles on their own listener, so they can
+// be bound to localhost apart from the metrics port.
+func startPprof(lis net.Listener, access *Access, tlsConfig *tls.Config) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	go func() {
+		log.Infof("Serving pprof on %s", lis.Addr())
+		log.Fatal(serve(lis, access.Handler(mux), tlsConfig))
+	}()
+}
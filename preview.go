@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// renderPreview renders the first page of the TIFF as PNG, fitting into
+// 400x520 pixels, for chat notifications.
+func renderPreview(path string) ([]byte, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("convert",
+		path+"[0]",
+		"-background", "white",
+		"-alpha", "remove",
+		"-thumbnail", "400x520",
+		"png:-")
+	png, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render preview: %w", err)
+	}
+	return png, nil
+}
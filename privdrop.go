@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RunAs is the user and groups the bridge switches to once its ports are
+// bound, e.g. HylaFAX's uucp user, which can read the spool.
+type RunAs struct {
+	Name   string
+	UID    int
+	GID    int
+	Groups []int // Supplementary groups
+}
+
+// lookupRunAs resolves a user and optional group, given by name or ID. The
+// group defaults to the user's primary group.
+func lookupRunAs(name, group string) (*RunAs, error) {
+	u, err := user.Lookup(name)
+	if _, ok := err.(user.UnknownUserError); ok {
+		u, err = user.LookupId(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := &RunAs{Name: u.Username}
+	if r.UID, err = strconv.Atoi(u.Uid); err != nil {
+		return nil, fmt.Errorf("%s: non-numeric uid %s", name, u.Uid)
+	}
+	gid := u.Gid
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if _, ok := err.(user.UnknownGroupError); ok {
+			g, err = user.LookupGroupId(group)
+		}
+		if err != nil {
+			return nil, err
+		}
+		gid = g.Gid
+	}
+	if r.GID, err = strconv.Atoi(gid); err != nil {
+		return nil, fmt.Errorf("%s: non-numeric gid %s", group, gid)
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return nil, fmt.Errorf("error looking up the groups of %s: %w", name, err)
+	}
+	for _, id := range ids {
+		if n, err := strconv.Atoi(id); err == nil {
+			r.Groups = append(r.Groups, n)
+		}
+	}
+	return r, nil
+}
+
+// chown hands the files under the paths to the user, so state written by
+// earlier runs as root stays writable. Empty and missing paths are skipped.
+func (r *RunAs) chown(paths ...string) error {
+	for _, root := range paths {
+		if root == "" {
+			continue
+		}
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == root {
+					return nil
+				}
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) == r.UID && int(st.Gid) == r.GID {
+				return nil
+			}
+			return os.Lchown(path, r.UID, r.GID)
+		})
+		if err != nil {
+			return fmt.Errorf("error handing %s to %s: %w", root, r.Name, err)
+		}
+	}
+	return nil
+}
+
+// drop switches all threads to the user and its groups for good.
+func (r *RunAs) drop() error {
+	if os.Getuid() == r.UID && os.Getgid() == r.GID {
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("must be started as root to run as %s", r.Name)
+	}
+	if err := syscall.Setgroups(append([]int{r.GID}, r.Groups...)); err != nil {
+		return fmt.Errorf("error setting groups: %w", err)
+	}
+	if err := syscall.Setgid(r.GID); err != nil {
+		return fmt.Errorf("error setting gid: %w", err)
+	}
+	if err := syscall.Setuid(r.UID); err != nil {
+		return fmt.Errorf("error setting uid: %w", err)
+	}
+	if syscall.Setuid(0) == nil {
+		return fmt.Errorf("root privileges could be regained")
+	}
+	log.Infof("Running as %s (uid %d, gid %d)", r.Name, r.UID, r.GID)
+	return nil
+}
+
+// parseUmask parses an octal umask like 027.
+func parseUmask(s string) (int, error) {
+	mask, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mask > 0777 {
+		return 0, fmt.Errorf("invalid umask %q, expected octal like 027", s)
+	}
+	return int(mask), nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// SendfaxProfile is a named set of sendfax job options.
+type SendfaxProfile struct {
+	Resolution string   `json:"resolution,omitempty"` // low, fine or superfine
+	MaxDials   int      `json:"max_dials,omitempty"`  // sendfax -T
+	MaxTries   int      `json:"max_tries,omitempty"`  // sendfax -t
+	KillTime   string   `json:"kill_time,omitempty"`  // sendfax -k, e.g. "now + 2 days"
+	Notify     string   `json:"notify,omitempty"`     // Notification address (sendfax -f)
+	NotifyOn   string   `json:"notify_on,omitempty"`  // done, requeue or none
+	Priority   string   `json:"priority,omitempty"`   // sendfax -P, e.g. high, normal, low or 0-255
+	Options    []string `json:"options,omitempty"`    // Extra arguments passed to sendfax
+}
+
+var resolutionFlags = map[string]string{
+	"low":       "-l",
+	"fine":      "-m",
+	"superfine": "-G",
+}
+
+var notifyFlags = map[string]string{
+	"done":    "-D",
+	"requeue": "-R",
+	"none":    "-N",
+}
+
+// validate checks the profile for unknown option values.
+func (p *SendfaxProfile) validate() error {
+	if _, ok := resolutionFlags[p.Resolution]; p.Resolution != "" && !ok {
+		return fmt.Errorf("invalid resolution: %s", p.Resolution)
+	}
+	if _, ok := notifyFlags[p.NotifyOn]; p.NotifyOn != "" && !ok {
+		return fmt.Errorf("invalid notify_on: %s", p.NotifyOn)
+	}
+	return nil
+}
+
+// sendfaxArgs returns the sendfax arguments for the profile. Unset dial, try
+// and kill time limits fall back to the bridge defaults.
+func (p *SendfaxProfile) sendfaxArgs() []string {
+	killTime := "now + 2 days"
+	maxDials, maxTries := faxRetryCount, faxRetryCount
+	if p.KillTime != "" {
+		killTime = p.KillTime
+	}
+	if p.MaxDials > 0 {
+		maxDials = strconv.Itoa(p.MaxDials)
+	}
+	if p.MaxTries > 0 {
+		maxTries = strconv.Itoa(p.MaxTries)
+	}
+
+	args := []string{
+		"-k", killTime,
+		"-T", maxDials,
+		"-t", maxTries,
+	}
+	if p.Resolution != "" {
+		args = append(args, resolutionFlags[p.Resolution])
+	}
+	if p.Notify != "" {
+		args = append(args, "-f", p.Notify)
+	}
+	if p.NotifyOn != "" {
+		args = append(args, notifyFlags[p.NotifyOn])
+	}
+	if p.Priority != "" {
+		args = append(args, "-P", p.Priority)
+	}
+	return append(args, p.Options...)
+}
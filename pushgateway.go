@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	log "github.com/sirupsen/logrus"
+)
+
+// startPushgateway pushes all metrics to a Pushgateway every interval, for
+// hosts that cannot be scraped directly.
+func startPushgateway(url, job, user, pass string, interval time.Duration) {
+	instance, err := os.Hostname()
+	if err != nil {
+		instance = "faxrelay"
+	}
+	pusher := push.New(url, job).
+		Gatherer(prometheus.DefaultGatherer).
+		Grouping("instance", instance).
+		Client(httpClient)
+	if user != "" {
+		pusher = pusher.BasicAuth(user, pass)
+	}
+
+	go func() {
+		for {
+			if err := pusher.Push(); err != nil {
+				log.Errorf("Error pushing metrics to Pushgateway: %s", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
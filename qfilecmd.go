@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sagostin/gofaxip-bridge/pkg/qfile"
+)
+
+const qfileUsage = `Usage: %[1]s qfile dump <qfile>
+       %[1]s qfile get <qfile> <tag>
+       %[1]s qfile set <qfile> <tag>=<value>...
+
+dump prints all tags as JSON, get prints every value of a tag and set
+replaces the first value of each tag (adding it if needed). The qfile is
+locked like faxq does while it is read or written.
+`
+
+// runQfile runs the qfile command.
+func runQfile(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintf(os.Stderr, qfileUsage, os.Args[0])
+		os.Exit(2)
+	}
+	if err := qfileCommand(args[0], args[1], args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", args[1], err)
+		os.Exit(1)
+	}
+}
+
+func qfileCommand(command, filename string, args []string) error {
+	var sets [][2]string
+	switch {
+	case command == "dump" && len(args) == 0:
+	case command == "get" && len(args) == 1:
+	case command == "set" && len(args) > 0:
+		for _, arg := range args {
+			tag, value, ok := strings.Cut(arg, "=")
+			if !ok || tag == "" {
+				return fmt.Errorf("invalid assignment %q, expected tag=value", arg)
+			}
+			sets = append(sets, [2]string{tag, value})
+		}
+	default:
+		fmt.Fprintf(os.Stderr, qfileUsage, os.Args[0])
+		os.Exit(2)
+	}
+
+	open := qfile.OpenQfileRead
+	if command == "set" {
+		open = qfile.OpenQfile
+	}
+	q, err := open(filename)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	switch command {
+	case "dump":
+		out, err := json.MarshalIndent(q, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	case "get":
+		values := q.GetAll(args[0])
+		if len(values) == 0 {
+			return fmt.Errorf("tag %s not found", args[0])
+		}
+		for _, v := range values {
+			fmt.Println(v)
+		}
+	case "set":
+		for _, set := range sets {
+			q.Set(set[0], set[1])
+		}
+		if err := q.WriteAtomic(); err != nil {
+			return fmt.Errorf("error writing qfile: %w", err)
+		}
+	}
+	return nil
+}
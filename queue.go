@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RelayJob is a pending relay of a received fax.
+type RelayJob struct {
+	Entry       XFRecord  `json:"entry"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastOutput  string    `json:"last_output,omitempty"`
+	Delivered   []string  `json:"delivered,omitempty"` // Backends the fax has been delivered through
+	Created     time.Time `json:"created"`
+	Path        string    `json:"path,omitempty"` // TIFF outside of the spool, for re-relays of archived faxes
+}
+
+// path returns the TIFF of the job.
+func (j *RelayJob) path(spoolDir string) string {
+	if j.Path != "" {
+		return j.Path
+	}
+	return filepath.Join(spoolDir, j.Entry.Filename)
+}
+
+// delivered reports whether the fax has been delivered through the backend.
+func (j *RelayJob) delivered(backend string) bool {
+	for _, b := range j.Delivered {
+		if b == backend {
+			return true
+		}
+	}
+	return false
+}
+
+// RelayQueue is an on-disk queue of relay jobs, stored as one JSON file per commid.
+type RelayQueue struct {
+	dir string
+}
+
+// OpenRelayQueue opens (and creates if needed) a relay queue directory.
+func OpenRelayQueue(dir string) (*RelayQueue, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "failed"), 0755); err != nil {
+		return nil, fmt.Errorf("error creating relay queue directory: %w", err)
+	}
+	return &RelayQueue{dir: dir}, nil
+}
+
+func (q *RelayQueue) jobPath(commid string) string {
+	return filepath.Join(q.dir, filepath.Base(commid)+".json")
+}
+
+// Has reports whether a job for the given commid is queued.
+func (q *RelayQueue) Has(commid string) bool {
+	_, err := os.Stat(q.jobPath(commid))
+	return err == nil
+}
+
+// Put stores a job, replacing any previous version of it.
+func (q *RelayQueue) Put(job *RelayJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("error marshaling relay job: %w", err)
+	}
+	return writeFileAtomic(q.jobPath(job.Entry.Commid), data, 0644)
+}
+
+// Remove deletes a job from the queue.
+func (q *RelayQueue) Remove(commid string) error {
+	err := os.Remove(q.jobPath(commid))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Fail moves a job into the failed/ subdirectory so it is kept for inspection.
+func (q *RelayQueue) Fail(job *RelayJob) error {
+	if err := q.Put(job); err != nil {
+		return err
+	}
+	name := filepath.Base(q.jobPath(job.Entry.Commid))
+	return os.Rename(q.jobPath(job.Entry.Commid), filepath.Join(q.dir, "failed", name))
+}
+
+func (q *RelayQueue) failedPath(commid string) string {
+	return filepath.Join(q.dir, "failed", filepath.Base(q.jobPath(commid)))
+}
+
+// Job returns the queued job of a commid, or nil if there is none.
+func (q *RelayQueue) Job(commid string) (*RelayJob, error) {
+	return readRelayJob(q.jobPath(commid))
+}
+
+// FailedJob returns the job of a commid in failed/, or nil if there is none.
+func (q *RelayQueue) FailedJob(commid string) (*RelayJob, error) {
+	return readRelayJob(q.failedPath(commid))
+}
+
+func readRelayJob(path string) (*RelayJob, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	job := &RelayJob{}
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, fmt.Errorf("%s: error parsing relay job: %w", path, err)
+	}
+	return job, nil
+}
+
+// RemoveFailed deletes a job from failed/.
+func (q *RelayQueue) RemoveFailed(commid string) error {
+	err := os.Remove(q.failedPath(commid))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Load returns all pending jobs in the queue.
+func (q *RelayQueue) Load() ([]*RelayJob, error) {
+	return loadJobs(q.dir)
+}
+
+// Failed returns all jobs in failed/.
+func (q *RelayQueue) Failed() ([]*RelayJob, error) {
+	return loadJobs(filepath.Join(q.dir, "failed"))
+}
+
+func loadJobs(dir string) ([]*RelayJob, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*RelayJob
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		job := &RelayJob{}
+		if err := json.Unmarshal(data, job); err != nil {
+			return nil, fmt.Errorf("%s: error parsing relay job: %w", f.Name(), err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Len returns the number of pending jobs.
+func (q *RelayQueue) Len() (int, error) {
+	return countJobs(q.dir)
+}
+
+// FailedLen returns the number of jobs in failed/.
+func (q *RelayQueue) FailedLen() (int, error) {
+	return countJobs(filepath.Join(q.dir, "failed"))
+}
+
+func countJobs(dir string) (int, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".json") && !strings.HasPrefix(f.Name(), ".") {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to filename and renames it into place.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimit caps how many relays may start per minute and be handed to the
+// backends at once. The esl backend holds its slot for the whole call, but
+// sendfax and hylafax return once the job is submitted, so for them
+// Concurrent only limits concurrent submissions; HylaFAX schedules the
+// transmissions itself. Zero values mean unlimited.
+type RateLimit struct {
+	PerMinute  int `json:"per_minute,omitempty"`
+	Concurrent int `json:"concurrent,omitempty"`
+}
+
+// RateLimits holds the global and per destination number relay limits.
+type RateLimits struct {
+	Global         RateLimit `json:"global"`
+	PerDestination RateLimit `json:"per_destination"`
+}
+
+// concurrencyRetry is how long a job waits when a concurrency limit is reached.
+const concurrencyRetry = 5 * time.Second
+
+// rateLimiter keeps track of relay starts and relays in progress.
+type rateLimiter struct {
+	mu     sync.Mutex
+	starts map[string][]time.Time // Start times within the last minute, by destination
+	active map[string]int         // Relays in progress, by destination
+}
+
+// globalKey holds the totals over all destinations.
+const globalKey = ""
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		starts: make(map[string][]time.Time),
+		active: make(map[string]int),
+	}
+}
+
+// acquire registers the start of a relay to destnum. If a limit is reached
+// nothing is registered, and the time at which to try again is returned.
+func (l *rateLimiter) acquire(destnum string, limits RateLimits) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+	retry := now
+	for _, c := range []struct {
+		key   string
+		limit RateLimit
+	}{
+		{globalKey, limits.Global},
+		{destnum, limits.PerDestination},
+	} {
+		starts := l.starts[c.key]
+		if c.limit.PerMinute > 0 && len(starts) >= c.limit.PerMinute {
+			if t := starts[0].Add(time.Minute); t.After(retry) {
+				retry = t
+			}
+		}
+		if c.limit.Concurrent > 0 && l.active[c.key] >= c.limit.Concurrent {
+			if t := now.Add(concurrencyRetry); t.After(retry) {
+				retry = t
+			}
+		}
+	}
+	if retry.After(now) {
+		return retry, false
+	}
+
+	for _, key := range []string{globalKey, destnum} {
+		l.starts[key] = append(l.starts[key], now)
+		l.active[key]++
+	}
+	return now, true
+}
+
+// prune drops start times older than a minute, and destinations without
+// any.
+func (l *rateLimiter) prune(now time.Time) {
+	for key, starts := range l.starts {
+		for len(starts) > 0 && now.Sub(starts[0]) >= time.Minute {
+			starts = starts[1:]
+		}
+		if len(starts) == 0 {
+			delete(l.starts, key)
+		} else {
+			l.starts[key] = starts
+		}
+	}
+}
+
+// release registers the end of a relay to destnum.
+func (l *rateLimiter) release(destnum string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range []string{globalKey, destnum} {
+		if l.active[key]--; l.active[key] <= 0 {
+			delete(l.active, key)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Rating prices faxes by the longest prefix of their destination number.
+type Rating struct {
+	Currency string `json:"currency,omitempty"` // e.g. USD, reported with costs
+	Rates    []Rate `json:"rates"`
+}
+
+// Rate is the price of faxes to numbers starting with a prefix.
+type Rate struct {
+	Name      string   `json:"name,omitempty"`      // Default: the prefix
+	Prefix    string   `json:"prefix"`              // Destination prefix, empty for all numbers
+	Direction string   `json:"direction,omitempty"` // RECV or SEND (default: both)
+	Setup     float64  `json:"setup,omitempty"`     // Per connected fax
+	PerPage   float64  `json:"per_page,omitempty"`
+	PerMinute float64  `json:"per_minute,omitempty"`
+	Increment Duration `json:"increment,omitempty"` // Connection time is rated rounded up to this (default: 1m)
+}
+
+// Cost is the price of a fax.
+type Cost struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency,omitempty"`
+	Rate     string  `json:"rate"`
+}
+
+// compile validates the rates and fills in defaults.
+func (r *Rating) compile() error {
+	for i := range r.Rates {
+		rate := &r.Rates[i]
+		if rate.Direction != "" && rate.Direction != string(XflRECV) && rate.Direction != string(XflSEND) {
+			return fmt.Errorf("rating: %s: direction must be RECV or SEND", rate.Prefix)
+		}
+		if rate.Name == "" {
+			rate.Name = rate.Prefix
+		}
+		if rate.Increment.Duration <= 0 {
+			rate.Increment.Duration = time.Minute
+		}
+	}
+	return nil
+}
+
+// match returns the rate of a fax, preferring longer prefixes and rates
+// of its direction.
+func (r *Rating) match(record XFRecord) *Rate {
+	var best *Rate
+	for i := range r.Rates {
+		rate := &r.Rates[i]
+		if !strings.HasPrefix(record.Destnum, rate.Prefix) ||
+			(rate.Direction != "" && rate.Direction != string(record.Direction)) {
+			continue
+		}
+		if best == nil || len(rate.Prefix) > len(best.Prefix) ||
+			(len(rate.Prefix) == len(best.Prefix) && best.Direction == "") {
+			best = rate
+		}
+	}
+	return best
+}
+
+// Cost rates a received or sent fax, or returns nil if no rate matches.
+// Faxes that never connected cost nothing.
+func (r *Rating) Cost(record XFRecord) *Cost {
+	if r == nil || (record.Direction != XflRECV && record.Direction != XflSEND) {
+		return nil
+	}
+	rate := r.match(record)
+	if rate == nil {
+		return nil
+	}
+	cost := &Cost{Currency: r.Currency, Rate: rate.Name}
+	if seconds := hmsSeconds(record.Conntime); seconds > 0 {
+		increment := rate.Increment.Seconds()
+		minutes := math.Ceil(seconds/increment) * increment / 60
+		amount := rate.Setup + float64(record.Pages)*rate.PerPage + minutes*rate.PerMinute
+		cost.Amount = math.Round(amount*1e6) / 1e6
+	}
+	return cost
+}
+
+// configuredRating returns the rating of the current config, if any.
+func configuredRating() *Rating {
+	if relayer == nil {
+		return nil
+	}
+	return relayer.Config().Rating
+}
@@ -0,0 +1,82 @@
+package main
+
+import "strings"
+
+// Reason types, whether HylaFAX or the relay may succeed on a later attempt.
+const (
+	ReasonRetryable = "retryable"
+	ReasonPermanent = "permanent"
+)
+
+// reasonCodes maps substrings of free-text xferfaxlog reasons to stable
+// codes, in order. Classes are the low-cardinality groups used in metrics.
+var reasonCodes = []struct {
+	match, code, class string
+	permanent          bool
+}{
+	{"busy", "BUSY", "busy", false},
+	{"no answer", "NO_ANSWER", "no_answer", false},
+	{"no carrier", "NO_CARRIER", "no_carrier", false},
+	{"no local dialtone", "NO_DIALTONE", "no_dialtone", false},
+	{"kill time expired", "KILLTIME_EXPIRED", "timeout", true},
+	{"timeout", "TIMEOUT", "timeout", false},
+	{"timed out", "TIMEOUT", "timeout", false},
+	{"hangup", "HANGUP", "hangup", false},
+	{"hung up", "HANGUP", "hangup", false},
+	{"disconnect", "HANGUP", "hangup", false},
+	{"rtn", "PAGE_RETRAIN", "negotiation", false},
+	{"dcs", "NEGOTIATION", "negotiation", false},
+	{"training", "TRAINING_FAILED", "negotiation", false},
+	{"ecm", "ECM_ERROR", "negotiation", false},
+	{"no response to eop", "PROTOCOL", "protocol", false},
+	{"t.30", "PROTOCOL", "protocol", false},
+	{"t.38", "PROTOCOL", "protocol", false},
+	{"no t.4 receiver", "NOT_A_FAX", "rejected", true},
+	{"receiving capability", "NOT_A_FAX", "rejected", true},
+	{"rejected", "REJECTED", "rejected", true},
+	{"blocked", "BLOCKED", "rejected", true},
+	{"invalid dialing", "INVALID_NUMBER", "other", true},
+	{"invalid number", "INVALID_NUMBER", "other", true},
+	{"aborted by request", "ABORTED", "other", true},
+	{"killed", "ABORTED", "other", true},
+	{"document conversion", "DOCUMENT_ERROR", "other", true},
+	{"can not open document", "DOCUMENT_ERROR", "other", true},
+	{"modem", "MODEM_ERROR", "other", false},
+}
+
+// ReasonStatus is the machine-readable classification of a free-text reason.
+type ReasonStatus struct {
+	Code string // e.g. BUSY or NO_CARRIER, OK for successful records, UNKNOWN if unmapped
+	Type string // ReasonRetryable or ReasonPermanent, empty for successful records
+}
+
+// classifyReason maps a free-text reason to its status and metrics class.
+// Unknown failures are classified as retryable.
+func classifyReason(reason string) (ReasonStatus, string) {
+	if reasonOK(reason) {
+		return ReasonStatus{Code: "OK"}, "ok"
+	}
+	r := strings.ToLower(reason)
+	for _, c := range reasonCodes {
+		if strings.Contains(r, c.match) {
+			typ := ReasonRetryable
+			if c.permanent {
+				typ = ReasonPermanent
+			}
+			return ReasonStatus{Code: c.code, Type: typ}, c.class
+		}
+	}
+	return ReasonStatus{Code: "UNKNOWN", Type: ReasonRetryable}, "other"
+}
+
+// reasonClass maps a free-text reason to a low-cardinality class for metrics.
+func reasonClass(reason string) string {
+	_, class := classifyReason(reason)
+	return class
+}
+
+// classify sets the reason code and type of the record.
+func (r *XFRecord) classify() {
+	status, _ := classifyReason(r.Reason)
+	r.ReasonCode, r.ReasonType = status.Code, status.Type
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// recordColumns are the columns database sinks store records in, in the
+// order of recordValues.
+var recordColumns = []string{
+	"commid", "ts", "direction", "modem", "jobid", "jobtag", "filename", "sender", "destnum", "remote_id",
+	"params", "pages", "jobtime", "conntime", "reason", "cidname", "cidnum", "owner", "dcs", "record",
+}
+
+// recordValues returns the column values of a record.
+func recordValues(r XFRecord) []any {
+	raw, _ := json.Marshal(r)
+	return []any{
+		r.Commid, r.Ts, string(r.Direction), r.Modem, r.Jobid, r.Jobtag, r.Filename, r.Sender, r.Destnum, r.RemoteID,
+		r.Params, int64(r.Pages), r.Jobtime, r.Conntime, r.Reason, r.Cidname, r.Cidnum, r.Owner, r.Dcs, string(raw),
+	}
+}
+
+// recordKey returns the key records are stored under: their commid, or for
+// records without one, like some failed SEND lines, their direction, jobid
+// and time, so they don't replace each other.
+func recordKey(r XFRecord) string {
+	if r.Commid == "" {
+		return fmt.Sprintf("%s-%s-%d", strings.ToLower(string(r.Direction)), r.Jobid, r.Ts.Unix())
+	}
+	return r.Commid
+}
+
+// latestByCommid drops all but the last record of each commid, keeping order.
+func latestByCommid(records []XFRecord) []XFRecord {
+	last := make(map[string]int, len(records))
+	for i, r := range records {
+		last[r.Commid] = i
+	}
+	out := make([]XFRecord, 0, len(last))
+	for i, r := range records {
+		if last[r.Commid] == i {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// hmsSeconds converts xferfaxlog durations like 0:01:05 to seconds.
+func hmsSeconds(v string) float64 {
+	var seconds float64
+	for _, part := range strings.Split(v, ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds
+}
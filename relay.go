@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryPolicy controls how failed relays are retried.
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts including the first one
+	BaseDelay   time.Duration // Delay before the first retry
+	MaxDelay    time.Duration // Upper bound for the computed delay
+	Jitter      float64       // Random +/- fraction applied to each delay (0.0 - 1.0)
+}
+
+// Delay returns the backoff delay to wait after the given failed attempt (1-based).
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			delay = p.MaxDelay
+			break
+		}
+	}
+
+	if p.Jitter > 0 {
+		spread := float64(delay) * p.Jitter
+		delay += time.Duration(spread * (2*rand.Float64() - 1))
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
+
+// Relayer relays received faxes through its backends and retries failed attempts.
+// Pending relays are kept in a RelayQueue so they survive restarts, and
+// attempts are carried out by a bounded pool of workers.
+type Relayer struct {
+	spoolDir string
+	policy   RetryPolicy
+	queue    *RelayQueue
+	archiver *Archiver
+	loops    *LoopGuard
+	dups     *DuplicateFilter
+	tracker  *DeliveryTracker
+	config   atomic.Pointer[Config]
+
+	// QuarantineDir receives TIFFs failing validation; validation is
+	// disabled if it is empty.
+	QuarantineDir string
+	// Store records relay attempts and events if set.
+	Store *Store
+
+	backends map[string]RelayBackend
+	limiter  *rateLimiter
+	jobs     chan *RelayJob
+
+	stopMu   sync.Mutex
+	stopping bool
+	running  sync.WaitGroup // Attempts in progress
+	ctx      context.Context
+	cancel   context.CancelFunc // Cancels the running attempts
+}
+
+// NewRelayer creates a new relayer for faxes in the given spool directory.
+func NewRelayer(spoolDir string, policy RetryPolicy, queue *RelayQueue, archiver *Archiver, loops *LoopGuard, dups *DuplicateFilter, tracker *DeliveryTracker, config *Config) *Relayer {
+	r := &Relayer{
+		spoolDir: spoolDir,
+		policy:   policy,
+		queue:    queue,
+		archiver: archiver,
+		loops:    loops,
+		dups:     dups,
+		tracker:  tracker,
+		backends: map[string]RelayBackend{
+			BackendSendfax: &SendfaxBackend{Tag: loops.Tag(), Tracker: tracker},
+			BackendEmail:   &EmailBackend{},
+			BackendESL:     &ESLBackend{},
+			BackendHylaFAX: &HylaFAXBackend{Tag: loops.Tag()},
+		},
+		limiter: newRateLimiter(),
+		jobs:    make(chan *RelayJob, 64),
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.config.Store(config)
+	return r
+}
+
+// Config returns the config in use.
+func (r *Relayer) Config() *Config {
+	return r.config.Load()
+}
+
+// SetConfig replaces the config. Attempts already running finish with the
+// previous one.
+func (r *Relayer) SetConfig(config *Config) {
+	r.config.Store(config)
+}
+
+// Start launches the given number of relay workers.
+func (r *Relayer) Start(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go r.worker()
+	}
+}
+
+func (r *Relayer) worker() {
+	for job := range r.jobs {
+		if !r.begin() {
+			continue
+		}
+		r.attempt(job)
+		r.running.Done()
+	}
+}
+
+// begin counts an attempt as running unless the relayer is stopping.
+func (r *Relayer) begin() bool {
+	r.stopMu.Lock()
+	defer r.stopMu.Unlock()
+	if r.stopping {
+		return false
+	}
+	r.running.Add(1)
+	return true
+}
+
+// Stop keeps new attempts from starting and waits for the running ones
+// until ctx is done, then cancels them. Jobs not attempted stay in the
+// queue and are resumed on the next start.
+func (r *Relayer) Stop(ctx context.Context) error {
+	r.stopMu.Lock()
+	r.stopping = true
+	r.stopMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		return ctx.Err()
+	}
+}
+
+// Resume schedules all jobs left in the queue by a previous run.
+func (r *Relayer) Resume() error {
+	jobs, err := r.queue.Load()
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		log.Infof("Resuming queued relay of %s (%d attempts so far)", job.Entry.Commid, job.Attempts)
+		r.schedule(job)
+	}
+	return nil
+}
+
+// Relay queues the fax for relaying and hands it to the workers. It does not
+// wait for the relay to happen. Destination and caller ID numbers are
+// rewritten according to the config before the job is queued.
+func (r *Relayer) Relay(entry XFRecord) {
+	r.notify(newEvent(EventReceived, &RelayJob{Entry: entry}))
+	cfg := r.config.Load()
+	if !cfg.Filter.Allows(entry.Destnum) {
+		log.Infof("Not relaying %s: DID %s is filtered", entry.Commid, entry.Destnum)
+		return
+	}
+	if r.queue.Has(entry.Commid) {
+		log.Infof("Relay of %s is already queued", entry.Commid)
+		return
+	}
+	path := filepath.Join(r.spoolDir, entry.Filename)
+	if r.QuarantineDir != "" {
+		if err := validateTiff(entry, path); err != nil {
+			job := &RelayJob{Entry: entry, Created: time.Now(), LastError: err.Error()}
+			event := newEvent(EventQuarantined, job)
+			log.WithFields(event.Fields()).Errorf("Not relaying invalid fax: %s", err)
+			r.notify(event)
+			if err := quarantineFax(r.QuarantineDir, entry, path, err.Error()); err != nil {
+				log.Errorf("Error quarantining fax %s: %s", entry.Commid, err)
+			}
+			return
+		}
+	}
+	if loop, reason := r.loops.Check(entry); loop {
+		job := &RelayJob{Entry: entry, Created: time.Now()}
+		event := newEvent(EventLoopSuppressed, job)
+		event.Error = reason
+		log.WithFields(event.Fields()).Warnf("Not relaying fax that originates from our own relay: %s", reason)
+		r.notify(event)
+		if err := r.archiver.Store(job, path, cfg); err != nil {
+			log.Errorf("Error archiving looping fax %s: %s", entry.Commid, err)
+		}
+		return
+	}
+	if original, dup, err := r.dups.Check(entry, path); err != nil {
+		log.Errorf("Error checking %s for duplicates: %s", entry.Commid, err)
+	} else if dup {
+		job := &RelayJob{Entry: entry, Created: time.Now()}
+		event := newEvent(EventDuplicateSuppressed, job)
+		event.Error = "duplicate of " + original
+		log.WithFields(event.Fields()).Warnf("Not relaying duplicate of %s", original)
+		r.notify(event)
+		if err := r.archiver.Store(job, path, cfg); err != nil {
+			log.Errorf("Error archiving duplicate fax %s: %s", entry.Commid, err)
+		}
+		return
+	}
+	destnum, cidnum := entry.Destnum, entry.Cidnum
+	cfg.Rewrite.Apply(&entry)
+	if entry.Destnum != destnum || entry.Cidnum != cidnum {
+		log.Infof("Rewrote relay of %s: destnum %s -> %s, cidnum %s -> %s",
+			entry.Commid, destnum, entry.Destnum, cidnum, entry.Cidnum)
+	}
+	// A looping relay comes back with the numbers it was sent with
+	r.loops.Remember(entry)
+
+	now := time.Now()
+	job := &RelayJob{
+		Entry:       entry,
+		NextAttempt: now,
+		Created:     now,
+	}
+	if err := r.queue.Put(job); err != nil {
+		log.Errorf("Error queueing relay of %s: %s", entry.Commid, err)
+	}
+
+	r.schedule(job)
+}
+
+// schedule hands a job to the workers once its next attempt is due.
+func (r *Relayer) schedule(job *RelayJob) {
+	time.AfterFunc(time.Until(job.NextAttempt), func() {
+		r.jobs <- job
+	})
+}
+
+// deferred reschedules the job for the next opening of its route's schedule
+// if it is outside of it, and reports whether it did so.
+func (r *Relayer) deferred(job *RelayJob) bool {
+	cfg := r.config.Load()
+	schedule := cfg.schedule(cfg.Routes.Match(job.Entry))
+	if schedule == nil {
+		return false
+	}
+
+	now := time.Now()
+	next := schedule.Next(now)
+	if !next.After(now) {
+		return false
+	}
+
+	log.Infof("Relay of %s is outside of its schedule, deferred until %s", job.Entry.Commid, next.Format(time.RFC3339))
+	r.postpone(job, next)
+	return true
+}
+
+// postpone reschedules the job for the given time without counting an attempt.
+func (r *Relayer) postpone(job *RelayJob, next time.Time) {
+	job.NextAttempt = next
+	if err := r.queue.Put(job); err != nil {
+		log.Errorf("Error updating relay job %s: %s", job.Entry.Commid, err)
+	}
+	r.schedule(job)
+}
+
+// deliver hands the fax to every backend of its route it has not been
+// delivered through yet, and returns the combined output and first error.
+func (r *Relayer) deliver(ctx context.Context, job *RelayJob, path string, cfg *Config) (string, error) {
+	route := cfg.Routes.Match(job.Entry)
+
+	if cfg.coversheet(route) {
+		covered, err := cfg.Coversheet.Prepend(ctx, job.Entry, path)
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(covered)
+		path = covered
+	}
+
+	var outputs []string
+	var firstErr error
+	for _, name := range cfg.backends(route) {
+		if job.delivered(name) {
+			continue
+		}
+		output, err := r.backends[name].Deliver(ctx, job, path, route, cfg)
+		if output != "" {
+			outputs = append(outputs, name+": "+strings.TrimSpace(output))
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", name, err)
+			}
+			continue
+		}
+		job.Delivered = append(job.Delivered, name)
+	}
+	return strings.Join(outputs, "\n"), firstErr
+}
+
+// attempt relays the fax once. On failure the job is rescheduled with backoff,
+// and once all attempts are exhausted a final failure event is emitted.
+func (r *Relayer) attempt(job *RelayJob) {
+	if r.deferred(job) {
+		return
+	}
+
+	cfg := r.config.Load()
+	destnum := job.Entry.Destnum
+	if retry, ok := r.limiter.acquire(destnum, cfg.RateLimit); !ok {
+		log.Infof("Relay of %s to %s is rate limited, waiting until %s", job.Entry.Commid, destnum, retry.Format(time.RFC3339))
+		r.postpone(job, retry)
+		return
+	}
+
+	ctx, cancel := withTimeout(r.ctx, relayTimeout)
+	defer cancel()
+	path := job.path(r.spoolDir)
+	env := hookEnv{stage: "pre_relay", path: path, attempt: job.Attempts + 1}
+	output, err := "", runHooks(ctx, cfg.Hooks.PreRelay, job.Entry, env)
+	if err == nil {
+		modems.relayStarted(job.Entry.Modem)
+		output, err = r.deliver(ctx, job, path, cfg)
+		modems.relayDone(job.Entry.Modem)
+	}
+	r.limiter.release(destnum)
+	job.Attempts++
+	job.LastOutput = output
+
+	if r.Store != nil {
+		if err := r.Store.RecordAttempt(job, err); err != nil {
+			log.Errorf("Error recording relay attempt of %s: %s", job.Entry.Commid, err)
+		}
+	}
+
+	env.stage, env.err = "post_relay", err
+	// Post-relay hooks run even if the attempt timed out
+	if err := runHooks(r.ctx, cfg.Hooks.PostRelay, job.Entry, env); err != nil {
+		log.Errorf("Error running hooks for %s: %s", job.Entry.Commid, err)
+	}
+
+	if err == nil {
+		faxesRelayed.WithLabelValues(string(job.Entry.Direction), job.Entry.Modem).Inc()
+
+		// The backends are done with the received TIFF (sendfax has copied it
+		// into its own queue), so it can be archived. Failing to do so must not
+		// trigger another relay. Re-relayed archived TIFFs stay where they are.
+		if job.Path == "" {
+			if err := r.archiver.Store(job, path, cfg); err != nil {
+				log.Errorf("Error archiving relayed fax %s: %s", job.Entry.Commid, err)
+			}
+		}
+		if err := r.queue.Remove(job.Entry.Commid); err != nil {
+			log.Errorf("Error removing relay job %s: %s", job.Entry.Commid, err)
+		}
+		return
+	}
+	job.LastError = err.Error()
+
+	if job.Attempts >= r.policy.MaxAttempts {
+		r.emitFinalFailure(job, err)
+		if err := r.queue.Fail(job); err != nil {
+			log.Errorf("Error moving relay job %s to failed: %s", job.Entry.Commid, err)
+		}
+		return
+	}
+
+	delay := r.policy.Delay(job.Attempts)
+	job.NextAttempt = time.Now().Add(delay)
+	if err := r.queue.Put(job); err != nil {
+		log.Errorf("Error updating relay job %s: %s", job.Entry.Commid, err)
+	}
+
+	log.Warnf("Relay of %s failed (attempt %d/%d), retrying in %s: %s",
+		job.Entry.Commid, job.Attempts, r.policy.MaxAttempts, delay, err)
+	r.schedule(job)
+}
+
+// Confirm matches a SEND record against the tracked relays and emits a
+// delivery_confirmed or delivery_failed event if it belongs to one.
+func (r *Relayer) Confirm(send XFRecord) {
+	d, ok, err := r.tracker.Match(send, r.loops.Tag())
+	if err != nil {
+		log.Errorf("Error updating delivery tracking: %s", err)
+	}
+	if !ok {
+		return
+	}
+
+	eventType := EventDeliveryConfirmed
+	if !reasonOK(send.Reason) {
+		eventType = EventDeliveryFailed
+	}
+	event := newEvent(eventType, &RelayJob{Entry: d.Entry})
+	event.Jobid = send.Jobid
+	event.Reason, event.ReasonCode, event.ReasonType = send.Reason, send.ReasonCode, send.ReasonType
+	log.WithFields(event.Fields()).Infof("Relayed fax %s: job %s reason %q", strings.ReplaceAll(eventType, "_", " "), send.Jobid, send.Reason)
+	r.notify(event)
+}
+
+// notify stores the event and hands it to the notifiers.
+func (r *Relayer) notify(event Event) {
+	if event.path == "" && event.Record.Filename != "" {
+		event.path = filepath.Join(r.spoolDir, event.Record.Filename)
+	}
+	if event.Cost == nil {
+		event.Cost = r.config.Load().Rating.Cost(event.Record)
+	}
+	if r.Store != nil {
+		if err := r.Store.RecordEvent(event); err != nil {
+			log.Errorf("Error recording %s event of %s: %s", event.Type, event.Commid, err)
+		}
+	}
+	r.config.Load().Notify.notifiers().Notify(event)
+	eventBus.publish(event)
+}
+
+// emitFinalFailure reports a relay that has exhausted all of its attempts.
+func (r *Relayer) emitFinalFailure(job *RelayJob, err error) {
+	event := newEvent(EventRelayFailed, job)
+	faxesFailed.WithLabelValues(string(job.Entry.Direction), job.Entry.Modem, "relay_failed").Inc()
+	log.WithFields(event.Fields()).Errorf("Relay permanently failed: %s", err)
+	r.notify(event)
+}
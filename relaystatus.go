@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Relay statuses of a received fax.
+const (
+	RelayPending        = "pending"         // Queued, possibly retrying
+	RelayFailed         = "failed"          // Exhausted all attempts
+	RelayRelayed        = "relayed"         // Handed to the backends
+	RelayDelivered      = "delivered"       // Confirmed by the SEND record of the relayed fax
+	RelayDeliveryFailed = "delivery_failed" // The relayed fax was not delivered
+	RelayQuarantined    = "quarantined"
+	RelayDuplicate      = "duplicate"
+	RelayLoop           = "loop"
+)
+
+// RelayStatus is where the relay of a received fax stands.
+type RelayStatus struct {
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Time        time.Time  `json:"time"`                   // Of the last attempt or event
+	NextAttempt *time.Time `json:"next_attempt,omitempty"` // Of pending relays
+}
+
+// eventStatuses maps the events deciding the relay status to it.
+var eventStatuses = map[string]string{
+	EventRelayFailed:         RelayFailed,
+	EventDuplicateSuppressed: RelayDuplicate,
+	EventLoopSuppressed:      RelayLoop,
+	EventQuarantined:         RelayQuarantined,
+	EventDeliveryConfirmed:   RelayDelivered,
+	EventDeliveryFailed:      RelayDeliveryFailed,
+}
+
+// RelayStatuses returns the stored relay status of the commids that have
+// one, from their last relay attempt or event, whichever is later.
+func (s *Store) RelayStatuses(ctx context.Context, commids []string) (map[string]RelayStatus, error) {
+	statuses := make(map[string]RelayStatus)
+	if len(commids) == 0 {
+		return statuses, nil
+	}
+	in := strings.TrimSuffix(strings.Repeat("?, ", len(commids)), ", ")
+	args := make([]any, len(commids))
+	for i, commid := range commids {
+		args[i] = commid
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT commid, attempt, time, success, error FROM relay_attempts
+		WHERE id IN (SELECT MAX(id) FROM relay_attempts WHERE commid IN (%s) GROUP BY commid)`, in), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying relay attempts: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var commid string
+		var success bool
+		var st RelayStatus
+		if err := rows.Scan(&commid, &st.Attempts, &st.Time, &success, &st.Error); err != nil {
+			return nil, fmt.Errorf("error reading relay attempt: %w", err)
+		}
+		st.Status = RelayRelayed
+		if !success {
+			st.Status = RelayPending
+		}
+		statuses[commid] = st
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading relay attempts: %w", err)
+	}
+
+	types := make([]string, 0, len(eventStatuses))
+	for t := range eventStatuses {
+		types = append(types, "'"+t+"'")
+	}
+	rows, err = s.db.QueryContext(ctx, fmt.Sprintf(`SELECT commid, type, time, event FROM events
+		WHERE id IN (SELECT MAX(id) FROM events WHERE commid IN (%s) AND type IN (%s) GROUP BY commid)`,
+		in, strings.Join(types, ", ")), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying events: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var commid, eventType, data string
+		var t time.Time
+		if err := rows.Scan(&commid, &eventType, &t, &data); err != nil {
+			return nil, fmt.Errorf("error reading event: %w", err)
+		}
+		st, ok := statuses[commid]
+		if ok && st.Time.After(t) {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil, fmt.Errorf("error parsing event: %w", err)
+		}
+		st.Status, st.Time = eventStatuses[eventType], t
+		if st.Error = event.Error; st.Error == "" {
+			st.Error = event.Reason
+		}
+		statuses[commid] = st
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading events: %w", err)
+	}
+	return statuses, nil
+}
+
+// RelayStatuses returns the relay status of the commids that have one,
+// preferring the relay queue over the store.
+func (r *Relayer) RelayStatuses(ctx context.Context, commids []string) (map[string]RelayStatus, error) {
+	statuses := make(map[string]RelayStatus)
+	if r.Store != nil {
+		var err error
+		if statuses, err = r.Store.RelayStatuses(ctx, commids); err != nil {
+			return nil, err
+		}
+	}
+	for _, commid := range commids {
+		job, err := r.queue.Job(commid)
+		if err != nil {
+			return nil, fmt.Errorf("error reading relay job: %w", err)
+		}
+		status := RelayPending
+		if job == nil {
+			if job, err = r.queue.FailedJob(commid); err != nil {
+				return nil, fmt.Errorf("error reading failed relay: %w", err)
+			}
+			status = RelayFailed
+		}
+		if job == nil {
+			continue
+		}
+		st := RelayStatus{Status: status, Attempts: job.Attempts, Error: job.LastError, Time: statuses[commid].Time}
+		if status == RelayPending {
+			st.NextAttempt = &job.NextAttempt
+		}
+		statuses[commid] = st
+	}
+	return statuses, nil
+}
+
+// tiffPath returns the TIFF of a record, archived or in the spool.
+func (r *Relayer) tiffPath(entry XFRecord) (string, error) {
+	archived, err := r.archiver.Find(entry.Commid)
+	if err != nil {
+		return "", fmt.Errorf("error searching archive: %w", err)
+	}
+	if archived != "" {
+		return archived, nil
+	}
+	if entry.Filename == "" {
+		return "", errTiffNotFound
+	}
+	path := filepath.Join(r.spoolDir, entry.Filename)
+	if _, err := os.Stat(path); err != nil {
+		return "", errTiffNotFound
+	}
+	return path, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// configDebounce is how long the config file must be left alone after a
+// change before it is reloaded, as editors write it in several steps.
+const configDebounce = time.Second
+
+// watchConfig signals the returned channel on SIGHUP and when the config
+// file changes.
+func watchConfig(path string) <-chan struct{} {
+	reload := make(chan struct{}, 1)
+	trigger := func() {
+		select {
+		case reload <- struct{}{}:
+		default:
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Info("Received SIGHUP, reloading config")
+			trigger()
+		}
+	}()
+
+	// The directory is watched, as editors and config management replace
+	// the file instead of writing it
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Errorf("Error watching config, reloading on SIGHUP only: %s", err)
+		return reload
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		log.Errorf("Error watching config, reloading on SIGHUP only: %s", err)
+		watcher.Close()
+		return reload
+	}
+	go func() {
+		name := filepath.Clean(path)
+		var debounce <-chan time.Time
+		for {
+			select {
+			case event := <-watcher.Events:
+				if filepath.Clean(event.Name) == name && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					debounce = time.After(configDebounce)
+				}
+			case err := <-watcher.Errors:
+				log.Errorf("Config watcher error: %s", err)
+			case <-debounce:
+				log.Infof("%s changed, reloading config", path)
+				trigger()
+			}
+		}
+	}()
+	return reload
+}
+
+// reloadConfig loads the config file again and applies it. Routing, filters,
+// rewriting, notifications and the sinks section take effect for the next
+// records and relay attempts; queued relays, duplicate and delivery tracking
+// are kept. If the new config is invalid, the running one stays in use.
+func reloadConfig(path, logDir string) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		configReloads.WithLabelValues("error").Inc()
+		log.Errorf("Not reloading config: %s", err)
+		return
+	}
+
+	current := *sinks.Load()
+	reloaded, unused, err := current.Reload(cfg.Sinks, logDir)
+	if err != nil {
+		configReloads.WithLabelValues("error").Inc()
+		log.Errorf("Not reloading config: %s", err)
+		return
+	}
+	sinks.Store(&reloaded)
+	relayer.SetConfig(cfg)
+	unused.Close()
+
+	configReloads.WithLabelValues("ok").Inc()
+	log.Infof("Reloaded config from %s", path)
+}
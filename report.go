@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Report periods.
+const (
+	ReportDaily  = "daily"
+	ReportWeekly = "weekly"
+)
+
+// Report is a traffic report generated for every day or week.
+type Report struct {
+	Name     string       `json:"name"`
+	Period   string       `json:"period"`             // daily or weekly
+	At       string       `json:"at,omitempty"`       // Time of day the report is generated, as HH:MM (default: 00:00)
+	Weekday  string       `json:"weekday,omitempty"`  // First day of weekly reports, e.g. mon (default: mon)
+	Timezone string       `json:"timezone,omitempty"` // IANA time zone of the periods (default: local time)
+	Email    *ReportEmail `json:"email,omitempty"`    // Mails the report if set
+
+	at      time.Duration
+	weekday time.Weekday
+	loc     *time.Location
+}
+
+// ReportEmail mails reports as CSV attachment.
+type ReportEmail struct {
+	Server   string   `json:"server"` // SMTP server as host:port
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+}
+
+// compile validates the report and parses its times.
+func (r *Report) compile() error {
+	if r.Name == "" || strings.ContainsAny(r.Name, `/\`) {
+		return fmt.Errorf("reports: a name without slashes is required")
+	}
+	if r.Period != ReportDaily && r.Period != ReportWeekly {
+		return fmt.Errorf("reports: %s: period must be daily or weekly", r.Name)
+	}
+	var err error
+	r.at = 0
+	if r.At != "" {
+		if r.at, err = parseClock(r.At); err != nil {
+			return fmt.Errorf("reports: %s: %w", r.Name, err)
+		}
+	}
+	r.weekday = time.Monday
+	if r.Weekday != "" {
+		day, ok := weekdays[strings.ToLower(r.Weekday)]
+		if !ok {
+			return fmt.Errorf("reports: %s: invalid weekday: %s", r.Name, r.Weekday)
+		}
+		r.weekday = day
+	}
+	r.loc = time.Local
+	if r.Timezone != "" {
+		if r.loc, err = time.LoadLocation(r.Timezone); err != nil {
+			return fmt.Errorf("reports: %s: %w", r.Name, err)
+		}
+	}
+	if e := r.Email; e != nil && (e.Server == "" || e.From == "" || len(e.To) == 0) {
+		return fmt.Errorf("reports: %s: email needs server, from and to", r.Name)
+	}
+	return nil
+}
+
+// lastPeriod returns the latest period whose report is due at now.
+func (r *Report) lastPeriod(now time.Time) (start, end time.Time) {
+	now = now.In(r.loc)
+	end = midnight(now)
+	days := 1
+	if r.Period == ReportWeekly {
+		days = 7
+		end = end.AddDate(0, 0, -int((now.Weekday()-r.weekday+7)%7))
+	}
+	if now.Before(end.Add(r.at)) {
+		end = end.AddDate(0, 0, -days)
+	}
+	return end.AddDate(0, 0, -days), end
+}
+
+// TrafficStats summarizes the faxes of a period.
+type TrafficStats struct {
+	Since    time.Time  `json:"since"`
+	Until    time.Time  `json:"until"`
+	Currency string     `json:"currency,omitempty"` // Of the costs, if rated
+	Total    DIDStats   `json:"total"`
+	DIDs     []DIDStats `json:"dids"`
+}
+
+// DIDStats counts the faxes to a DID.
+type DIDStats struct {
+	DID            string         `json:"did"`
+	Received       int            `json:"received"`
+	Sent           int            `json:"sent"`
+	PagesReceived  uint           `json:"pages_received"`
+	PagesSent      uint           `json:"pages_sent"`
+	FailedReceived int            `json:"failed_received"`
+	FailedSent     int            `json:"failed_sent"`
+	Failures       map[string]int `json:"failures,omitempty"` // By reason code
+	Cost           float64        `json:"cost"`               // Rated cost of the faxes
+}
+
+func (s *DIDStats) add(r XFRecord, cost *Cost) {
+	if cost != nil {
+		s.Cost = math.Round((s.Cost+cost.Amount)*1e6) / 1e6
+	}
+	failed := r.ReasonCode != "" && r.ReasonCode != "OK"
+	switch r.Direction {
+	case XflRECV:
+		s.Received++
+		s.PagesReceived += r.Pages
+		if failed {
+			s.FailedReceived++
+		}
+	case XflSEND:
+		s.Sent++
+		s.PagesSent += r.Pages
+		if failed {
+			s.FailedSent++
+		}
+	}
+	if failed {
+		if s.Failures == nil {
+			s.Failures = make(map[string]int)
+		}
+		s.Failures[r.ReasonCode]++
+	}
+}
+
+// trafficStats summarizes the received and sent records of source from
+// since until until, by destination DID, with their costs if rating is set.
+func trafficStats(ctx context.Context, source recordSource, since, until time.Time, rating *Rating) (*TrafficStats, error) {
+	stats := &TrafficStats{Since: since, Until: until, Total: DIDStats{DID: "total"}, DIDs: []DIDStats{}}
+	if rating != nil {
+		stats.Currency = rating.Currency
+	}
+	dids := make(map[string]*DIDStats)
+	for _, direction := range []XFDirection{XflRECV, XflSEND} {
+		q := RecordQuery{Direction: direction, Since: since, Until: until, Page: 1, PerPage: maxPerPage}
+		for {
+			page, err := source.QueryRecords(ctx, q)
+			if err != nil {
+				return nil, err
+			}
+			for _, raw := range page.Records {
+				var r XFRecord
+				if err := json.Unmarshal(raw, &r); err != nil {
+					return nil, fmt.Errorf("error parsing record: %w", err)
+				}
+				s, ok := dids[r.Destnum]
+				if !ok {
+					s = &DIDStats{DID: r.Destnum}
+					dids[r.Destnum] = s
+				}
+				cost := rating.Cost(r)
+				s.add(r, cost)
+				stats.Total.add(r, cost)
+			}
+			if q.Page*q.PerPage >= page.Total {
+				break
+			}
+			q.Page++
+		}
+	}
+	for _, s := range dids {
+		stats.DIDs = append(stats.DIDs, *s)
+	}
+	sort.Slice(stats.DIDs, func(i, j int) bool { return stats.DIDs[i].DID < stats.DIDs[j].DID })
+	return stats, nil
+}
+
+// WriteCSV writes a row per DID and a total row. Failures are listed as
+// CODE:count pairs separated by semicolons.
+func (s *TrafficStats) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"did", "received", "sent", "pages_received", "pages_sent", "failed_received", "failed_sent", "failures", "cost"})
+	rows := append(append([]DIDStats{}, s.DIDs...), s.Total)
+	for _, d := range rows {
+		codes := make([]string, 0, len(d.Failures))
+		for code := range d.Failures {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for i, code := range codes {
+			codes[i] = code + ":" + strconv.Itoa(d.Failures[code])
+		}
+		cw.Write([]string{d.DID, strconv.Itoa(d.Received), strconv.Itoa(d.Sent),
+			strconv.FormatUint(uint64(d.PagesReceived), 10), strconv.FormatUint(uint64(d.PagesSent), 10),
+			strconv.Itoa(d.FailedReceived), strconv.Itoa(d.FailedSent), strings.Join(codes, ";"),
+			strconv.FormatFloat(d.Cost, 'f', -1, 64)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// reportInterval is how often the reporter checks for due reports.
+const reportInterval = time.Minute
+
+// Reporter writes the reports of the config to a directory once their
+// period is over, and mails them. A report whose file exists is not
+// generated again, so reports missed while the bridge was down are
+// caught up on.
+type Reporter struct {
+	Dir string
+}
+
+// Start generates due reports until the bridge exits. The first check
+// waits an interval, so the xferfaxlog backlog is processed by then.
+func (rp *Reporter) Start() {
+	go func() {
+		for {
+			time.Sleep(reportInterval)
+			for _, report := range relayer.Config().Reports {
+				rp.generate(report, time.Now())
+			}
+		}
+	}()
+}
+
+func (rp *Reporter) generate(report *Report, now time.Time) {
+	start, end := report.lastPeriod(now)
+	path := filepath.Join(rp.Dir, fmt.Sprintf("%s-%s.csv", report.Name, start.Format("2006-01-02")))
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+	logger := log.WithFields(log.Fields{"report": report.Name, "since": start, "until": end})
+
+	stats, err := trafficStats(context.Background(), store, start, end, configuredRating())
+	if err != nil {
+		logger.Errorf("Error generating report: %s", err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := stats.WriteCSV(&buf); err != nil {
+		logger.Errorf("Error generating report: %s", err)
+		return
+	}
+	if err := os.MkdirAll(rp.Dir, 0755); err != nil {
+		logger.Errorf("Error creating report directory: %s", err)
+		return
+	}
+	if err := writeFileAtomic(path, buf.Bytes(), 0644); err != nil {
+		logger.Errorf("Error writing report: %s", err)
+		return
+	}
+	logger.Infof("Wrote report %s", path)
+
+	if report.Email != nil {
+		ctx, cancel := withTimeout(context.Background(), pushTimeout)
+		defer cancel()
+		if err := report.mail(ctx, stats, filepath.Base(path), buf.Bytes()); err != nil {
+			logger.Errorf("Error mailing report: %s", err)
+		}
+	}
+}
+
+// mail sends the report with a summary to the recipients.
+func (r *Report) mail(ctx context.Context, stats *TrafficStats, name string, data []byte) error {
+	e := r.Email
+	last := stats.Until.AddDate(0, 0, -1).Format("2006-01-02")
+	period := stats.Since.Format("2006-01-02")
+	if last != period {
+		period += " to " + last
+	}
+	t := stats.Total
+	subject := fmt.Sprintf("Fax traffic report %s: %s", r.Name, period)
+	body := fmt.Sprintf("Fax traffic of %s:\n\nReceived: %d faxes, %d pages, %d failed\nSent: %d faxes, %d pages, %d failed\nDIDs: %d\n",
+		period, t.Received, t.PagesReceived, t.FailedReceived, t.Sent, t.PagesSent, t.FailedSent, len(stats.DIDs))
+	if t.Cost > 0 {
+		body += strings.TrimSpace(fmt.Sprintf("Cost: %s %s", strconv.FormatFloat(t.Cost, 'f', -1, 64), stats.Currency)) + "\n"
+	}
+	body += "\nThe faxes per DID are attached as CSV.\n"
+	msg, err := buildMail(e.From, e.To, subject, body, name, "text/csv", data)
+	if err != nil {
+		return err
+	}
+	return sendMail(ctx, e.Server, smtpAuth(e.Server, e.Username, e.Password), e.From, e.To, msg)
+}
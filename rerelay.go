@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Errors of Rerelay.
+var (
+	errRelayQueued  = errors.New("relay is already queued")
+	errFaxNotFound  = errors.New("no received fax with this commid")
+	errTiffNotFound = errors.New("TIFF is neither archived nor in the spool")
+)
+
+// Rerelay relays a received fax again, e.g. after its destination was down
+// or misconfigured. A permanently failed relay is retried through the
+// backends it was not delivered through; other faxes are relayed through
+// all backends from the archive or the spool. The DID filter, loop and
+// duplicate checks are skipped.
+func (r *Relayer) Rerelay(ctx context.Context, commid string) (*RelayJob, error) {
+	if r.queue.Has(commid) {
+		return nil, errRelayQueued
+	}
+
+	now := time.Now()
+	job, err := r.queue.FailedJob(commid)
+	if err != nil {
+		return nil, fmt.Errorf("error reading failed relay: %w", err)
+	}
+	if job == nil {
+		if job, err = r.archivedJob(ctx, commid); err != nil {
+			return nil, err
+		}
+	}
+	job.Attempts = 0
+	job.LastError, job.LastOutput = "", ""
+	job.NextAttempt = now
+
+	if err := r.queue.Put(job); err != nil {
+		return nil, fmt.Errorf("error queueing relay: %w", err)
+	}
+	if err := r.queue.RemoveFailed(commid); err != nil {
+		log.Errorf("Error removing failed relay job %s: %s", commid, err)
+	}
+	log.WithFields(log.Fields{"commid": commid, "path": job.path(r.spoolDir)}).Info("Relaying fax again")
+	r.schedule(job)
+	return job, nil
+}
+
+// archivedJob creates a relay job for the stored record of a commid.
+func (r *Relayer) archivedJob(ctx context.Context, commid string) (*RelayJob, error) {
+	if r.Store == nil {
+		return nil, errFaxNotFound
+	}
+	page, err := r.Store.QueryRecords(ctx, RecordQuery{Commid: commid, Direction: XflRECV, Page: 1, PerPage: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Records) == 0 {
+		return nil, errFaxNotFound
+	}
+	var entry XFRecord
+	if err := json.Unmarshal(page.Records[0], &entry); err != nil {
+		return nil, fmt.Errorf("error parsing stored record: %w", err)
+	}
+	r.config.Load().Rewrite.Apply(&entry)
+
+	job := &RelayJob{Entry: entry, Created: time.Now()}
+	path, err := r.tiffPath(entry)
+	if err != nil {
+		return nil, err
+	}
+	if path != job.path(r.spoolDir) {
+		job.Path = path
+	}
+	return job, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Retention configures how long the janitor keeps what the bridge leaves
+// behind. Zero durations keep things forever.
+type Retention struct {
+	Documents  Duration `json:"documents,omitempty"`  // Archived TIFFs (default: archiveRetention)
+	Metadata   Duration `json:"metadata,omitempty"`   // JSON sidecars of archived faxes (default: as documents)
+	Records    Duration `json:"records,omitempty"`    // Records, relay attempts and events in the database
+	Spool      Duration `json:"spool,omitempty"`      // Received TIFFs left in the spool without a pending or failed relay
+	Quarantine Duration `json:"quarantine,omitempty"` // Quarantined TIFFs and their sidecars
+	Interval   Duration `json:"interval,omitempty"`   // How often the janitor runs (default: 1h)
+}
+
+// Janitor periodically purges archived faxes, database rows and spool
+// leftovers older than the retention of the config.
+type Janitor struct {
+	Archiver      *Archiver
+	Queue         *RelayQueue
+	Store         *Store
+	SpoolDir      string
+	QuarantineDir string
+	// Documents is the retention of archived TIFFs unless the config sets one.
+	Documents time.Duration
+}
+
+// Start runs the janitor until the bridge exits.
+func (j *Janitor) Start() {
+	go func() {
+		for {
+			ret := relayer.Config().Retention
+			j.run(ret, time.Now())
+			interval := ret.Interval.Duration
+			if interval <= 0 {
+				interval = time.Hour
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// cutoff returns the time before which things kept for d are purged, or
+// the zero time if they are kept forever.
+func cutoff(now time.Time, d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-d)
+}
+
+func (j *Janitor) run(ret Retention, now time.Time) {
+	docs := ret.Documents.Duration
+	if docs == 0 {
+		docs = j.Documents
+	}
+	meta := ret.Metadata.Duration
+	if meta == 0 {
+		meta = docs
+	}
+	purgedDocs, purgedMeta := j.Archiver.purge(cutoff(now, docs), cutoff(now, meta))
+	countPurged("document", purgedDocs)
+	countPurged("metadata", purgedMeta)
+
+	if j.Store != nil && ret.Records.Duration > 0 {
+		res, err := j.Store.Purge(context.Background(), cutoff(now, ret.Records.Duration))
+		if err != nil {
+			log.Errorf("Error purging database: %s", err)
+		}
+		countPurged("record", int(res.Records))
+		countPurged("relay_attempt", int(res.Attempts))
+		countPurged("event", int(res.Events))
+	}
+
+	if ret.Spool.Duration > 0 {
+		countPurged("spool", j.purgeSpool(cutoff(now, ret.Spool.Duration)))
+	}
+	if j.QuarantineDir != "" && ret.Quarantine.Duration > 0 {
+		countPurged("quarantine", purgeFiles(j.QuarantineDir, cutoff(now, ret.Quarantine.Duration), nil))
+	}
+	retentionLastRun.SetToCurrentTime()
+}
+
+// purgeSpool removes received TIFFs last modified before cutoff, keeping
+// those of pending and failed relays. Other files of recvq, like HylaFAX's
+// seqf, are left alone.
+func (j *Janitor) purgeSpool(cutoff time.Time) int {
+	keep := make(map[string]bool)
+	for _, load := range []func() ([]*RelayJob, error){j.Queue.Load, j.Queue.Failed} {
+		jobs, err := load()
+		if err != nil {
+			log.Errorf("Error loading relay queue, not purging the spool: %s", err)
+			return 0
+		}
+		for _, job := range jobs {
+			keep[job.path(j.SpoolDir)] = true
+		}
+	}
+	return purgeFiles(filepath.Join(j.SpoolDir, "recvq"), cutoff, func(path string) bool {
+		return keep[path] || filepath.Ext(path) != ".tif"
+	})
+}
+
+// purgeFiles removes the files directly in dir last modified before cutoff,
+// except for hidden ones and those keep reports, and returns how many it
+// removed.
+func purgeFiles(dir string, cutoff time.Time, keep func(path string) bool) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("Error reading %s: %s", dir, err)
+		}
+		return 0
+	}
+	n := 0
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || (keep != nil && keep(path)) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Errorf("Error purging %s: %s", path, err)
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func countPurged(kind string, n int) {
+	if n > 0 {
+		retentionPurged.WithLabelValues(kind).Add(float64(n))
+		log.Infof("Purged %d %s item(s) past their retention", n, kind)
+	}
+}
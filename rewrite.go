@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Number formats supported by NumberRewriter.
+const (
+	FormatE164          = "e164"          // +<country code><national number>
+	FormatInternational = "international" // <country code><national number>
+	FormatNational      = "national"      // <trunk prefix><national number>
+)
+
+// noTrunkPrefix disables the trunk prefix of countries that keep the
+// leading 0 in international numbers, like Italy.
+const noTrunkPrefix = "none"
+
+// RewriteRule rewrites a phone number. Match/Replace are applied first, then
+// StripPrefix and AddPrefix.
+type RewriteRule struct {
+	Fields      []string `json:"fields,omitempty"`       // "destnum" and/or "cidnum" (default: both)
+	Match       string   `json:"match,omitempty"`        // Regexp the number has to match for the rule to apply
+	Replace     string   `json:"replace,omitempty"`      // Replacement for Match, may reference groups ($1)
+	StripPrefix string   `json:"strip_prefix,omitempty"` // Prefix removed from the number
+	AddPrefix   string   `json:"add_prefix,omitempty"`   // Prefix added to the number
+
+	re *regexp.Regexp
+}
+
+// NumberRewriter normalizes and rewrites destination and caller ID numbers
+// before they are relayed.
+type NumberRewriter struct {
+	CountryCode         string        `json:"country_code,omitempty"`         // e.g. "1" for NANP
+	NationalLength      int           `json:"national_length,omitempty"`      // Digits in a national number (default: 10)
+	InternationalPrefix string        `json:"international_prefix,omitempty"` // Dialed before foreign numbers (default: 011 for country code 1, otherwise 00)
+	TrunkPrefix         string        `json:"trunk_prefix,omitempty"`         // Dialed before national numbers (default: none for country code 1, otherwise 0)
+	Format              string        `json:"format,omitempty"`               // e164, international, national or empty to keep as is
+	Rules               []RewriteRule `json:"rules,omitempty"`
+}
+
+// compile validates the rewriter and compiles its rule patterns.
+func (n *NumberRewriter) compile() error {
+	switch n.Format {
+	case "", FormatE164, FormatInternational, FormatNational:
+	default:
+		return fmt.Errorf("invalid number format: %s", n.Format)
+	}
+	if n.Format != "" && n.CountryCode == "" {
+		return fmt.Errorf("number format %s requires a country_code", n.Format)
+	}
+	if n.NationalLength == 0 {
+		n.NationalLength = 10
+	}
+	if n.InternationalPrefix == "" {
+		n.InternationalPrefix = "00"
+		if n.CountryCode == "1" {
+			n.InternationalPrefix = "011"
+		}
+	}
+	if n.TrunkPrefix == "" {
+		n.TrunkPrefix = "0"
+		if n.CountryCode == "1" {
+			n.TrunkPrefix = noTrunkPrefix
+		}
+	}
+
+	for i := range n.Rules {
+		rule := &n.Rules[i]
+		for _, field := range rule.Fields {
+			if field != "destnum" && field != "cidnum" {
+				return fmt.Errorf("rewrite rule %d: invalid field: %s", i, field)
+			}
+		}
+		if rule.Match != "" {
+			re, err := regexp.Compile(rule.Match)
+			if err != nil {
+				return fmt.Errorf("rewrite rule %d: %w", i, err)
+			}
+			rule.re = re
+		}
+	}
+	return nil
+}
+
+// Apply rewrites the Destnum and Cidnum of the record.
+func (n *NumberRewriter) Apply(entry *XFRecord) {
+	entry.Destnum = n.Rewrite("destnum", entry.Destnum)
+	entry.Cidnum = n.Rewrite("cidnum", entry.Cidnum)
+}
+
+// Rewrite normalizes the number and then applies all rules for the field.
+func (n *NumberRewriter) Rewrite(field, number string) string {
+	if number == "" {
+		return number
+	}
+
+	number = n.normalize(number)
+	for _, rule := range n.Rules {
+		number = rule.apply(field, number)
+	}
+	return number
+}
+
+// normalize converts the number into the configured format. Numbers with a
+// +, the international prefix or 00 keep their country code; only national
+// numbers get the configured one, without their trunk prefix.
+func (n *NumberRewriter) normalize(number string) string {
+	if n.Format == "" {
+		return number
+	}
+	trunk := n.TrunkPrefix
+	if trunk == noTrunkPrefix {
+		trunk = ""
+	}
+
+	// Keep digits only
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, number)
+
+	var international string
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(number), "+"):
+		international = digits
+	case strings.HasPrefix(digits, n.InternationalPrefix):
+		international = strings.TrimPrefix(digits, n.InternationalPrefix)
+	case strings.HasPrefix(digits, "00"):
+		// The ITU prefix, used by most countries
+		international = strings.TrimPrefix(digits, "00")
+	case trunk != "" && strings.HasPrefix(digits, trunk):
+		international = n.CountryCode + strings.TrimPrefix(digits, trunk)
+	case len(digits) > n.NationalLength && strings.HasPrefix(digits, n.CountryCode):
+		international = digits
+	default:
+		international = n.CountryCode + digits
+	}
+
+	national, domestic := strings.CutPrefix(international, n.CountryCode)
+	switch {
+	case n.Format == FormatE164:
+		return "+" + international
+	case n.Format == FormatInternational:
+		return international
+	case domestic:
+		return trunk + national
+	default:
+		// Foreign numbers can only be dialed with the international prefix
+		return n.InternationalPrefix + international
+	}
+}
+
+func (r *RewriteRule) apply(field, number string) string {
+	if len(r.Fields) > 0 {
+		found := false
+		for _, f := range r.Fields {
+			if f == field {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return number
+		}
+	}
+
+	if r.re != nil {
+		if !r.re.MatchString(number) {
+			return number
+		}
+		if r.Replace != "" {
+			number = r.re.ReplaceAllString(number, r.Replace)
+		}
+	}
+
+	number = strings.TrimPrefix(number, r.StripPrefix)
+	return r.AddPrefix + number
+}
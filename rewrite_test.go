@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name        string
+		countryCode string
+		trunkPrefix string
+		format      string
+		number      string
+		want        string
+	}{
+		{"e164 kept", "1", "", FormatE164, "+15551234567", "+15551234567"},
+		{"e164 foreign kept", "1", "", FormatE164, "+442071234567", "+442071234567"},
+		{"national", "1", "", FormatE164, "5551234567", "+15551234567"},
+		{"national with country code", "1", "", FormatE164, "15551234567", "+15551234567"},
+		{"punctuation", "1", "", FormatE164, "(555) 123-4567", "+15551234567"},
+		{"international prefix 011", "1", "", FormatE164, "011442071234567", "+442071234567"},
+		{"international prefix 00", "1", "", FormatE164, "00442071234567", "+442071234567"},
+		{"00 with country code 44", "44", "", FormatE164, "0015551234567", "+15551234567"},
+		{"trunk prefix", "44", "", FormatE164, "02071234567", "+442071234567"},
+		{"trunk prefix to international", "44", "", FormatInternational, "02071234567", "442071234567"},
+		{"no trunk prefix", "39", noTrunkPrefix, FormatE164, "0612345678", "+390612345678"},
+		{"to national", "1", "", FormatNational, "+15551234567", "5551234567"},
+		{"foreign to national", "1", "", FormatNational, "+442071234567", "011442071234567"},
+		{"to national with trunk prefix", "44", "", FormatNational, "+442071234567", "02071234567"},
+		{"foreign to national with trunk prefix", "44", "", FormatNational, "+15551234567", "0015551234567"},
+		{"national kept", "44", "", FormatNational, "02071234567", "02071234567"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &NumberRewriter{CountryCode: tt.countryCode, TrunkPrefix: tt.trunkPrefix, Format: tt.format}
+			if err := n.compile(); err != nil {
+				t.Fatal(err)
+			}
+			if got := n.Rewrite("destnum", tt.number); got != tt.want {
+				t.Errorf("Rewrite(%q) = %q, want %q", tt.number, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteRules(t *testing.T) {
+	n := &NumberRewriter{
+		CountryCode: "1",
+		Format:      FormatNational,
+		Rules: []RewriteRule{
+			{Fields: []string{"destnum"}, Match: "^011", StripPrefix: "011", AddPrefix: "9011"},
+		},
+	}
+	if err := n.compile(); err != nil {
+		t.Fatal(err)
+	}
+	entry := XFRecord{Destnum: "+442071234567", Cidnum: "+442071234567"}
+	n.Apply(&entry)
+	if entry.Destnum != "9011442071234567" {
+		t.Errorf("destnum = %q, want 9011442071234567", entry.Destnum)
+	}
+	if entry.Cidnum != "011442071234567" {
+		t.Errorf("cidnum = %q, want 011442071234567", entry.Cidnum)
+	}
+}
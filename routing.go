@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+)
+
+// Route steers relays for matching destination numbers to specific relay
+// backends, a modem, HylaFAX host, FreeSWITCH gateway, sendfax profile, or set of extra sendfax options.
+type Route struct {
+	Name       string   `json:"name"`
+	DIDs       []string `json:"dids,omitempty"`       // Exact destination numbers
+	Prefixes   []string `json:"prefixes,omitempty"`   // Destination number prefixes
+	Sources    []string `json:"sources,omitempty"`    // Exact caller ID numbers
+	Keywords   []string `json:"keywords,omitempty"`   // Words in the OCR text of the first page (case-insensitive)
+	Modem      string   `json:"modem,omitempty"`      // Modem to send through (sendfax -h modem@host)
+	Host       string   `json:"host,omitempty"`       // HylaFAX server to submit to (default: localhost)
+	Gateway    string   `json:"gateway,omitempty"`    // FreeSWITCH gateway for the esl backend
+	Profile    string   `json:"profile,omitempty"`    // Name of the sendfax profile to use
+	Backends   []string `json:"backends,omitempty"`   // Relay backends to deliver through (default: config backends)
+	Schedule   string   `json:"schedule,omitempty"`   // Schedule limiting when relays are dispatched
+	Urgent     bool     `json:"urgent,omitempty"`     // Ignore all schedules
+	Coversheet *bool    `json:"coversheet,omitempty"` // Prepend a coversheet (default: coversheet.enabled)
+	Options    []string `json:"options,omitempty"`    // Extra arguments passed to sendfax
+}
+
+// RoutingTable is an ordered list of routes.
+type RoutingTable []Route
+
+// Match returns the route for the record. Exact DID matches take precedence
+// over prefixes and the longest matching prefix wins; among equally specific
+// destinations a route restricted to the caller's number is preferred. A route
+// without any criteria acts as the default. Match returns nil if no route applies.
+func (t RoutingTable) Match(entry XFRecord) *Route {
+	var best *Route
+	bestScore := -1
+
+	for i := range t {
+		route := &t[i]
+		score, ok := route.score(entry)
+		if ok && score > bestScore {
+			best, bestScore = route, score
+		}
+	}
+	return best
+}
+
+// score rates how specifically the route matches the record.
+func (r *Route) score(entry XFRecord) (int, bool) {
+	score := 0
+
+	if len(r.DIDs) > 0 || len(r.Prefixes) > 0 {
+		matched := false
+		for _, did := range r.DIDs {
+			if did == entry.Destnum {
+				score, matched = 2000, true
+				break
+			}
+		}
+		if !matched {
+			for _, prefix := range r.Prefixes {
+				if strings.HasPrefix(entry.Destnum, prefix) && 1000+len(prefix) > score {
+					score, matched = 1000+len(prefix), true
+				}
+			}
+		}
+		if !matched {
+			return 0, false
+		}
+	}
+
+	if len(r.Sources) > 0 {
+		matched := false
+		for _, source := range r.Sources {
+			if source == entry.Cidnum {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return 0, false
+		}
+		score++
+	}
+
+	if len(r.Keywords) > 0 {
+		if !containsKeyword(entry.Text, r.Keywords) {
+			return 0, false
+		}
+		score++
+	}
+
+	return score, true
+}
+
+// sendfaxArgs returns the sendfax arguments selecting this route's modem and host.
+func (r *Route) sendfaxArgs() []string {
+	var args []string
+	if r.Modem != "" || r.Host != "" {
+		host := r.Host
+		if host == "" {
+			host = "localhost"
+		}
+		if r.Modem != "" {
+			host = r.Modem + "@" + host
+		}
+		args = append(args, "-h", host)
+	}
+	return append(args, r.Options...)
+}
+
+// containsKeyword reports whether the text contains any of the keywords, ignoring case.
+func containsKeyword(text string, keywords []string) bool {
+	text = strings.ToLower(text)
+	for _, keyword := range keywords {
+		if strings.Contains(text, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// S3 archive formats.
+const (
+	S3FormatTIFF = "tiff"
+	S3FormatPDF  = "pdf"
+)
+
+// defaultS3Key is the key template used unless the config sets one.
+const defaultS3Key = "{{.Tenant}}/{{.Date}}/{{.Commid}}"
+
+// S3Archive uploads relayed faxes to an S3-compatible bucket, like AWS S3
+// or MinIO. Credentials come from the access key of the config, or else
+// the default AWS chain.
+type S3Archive struct {
+	Bucket          string            `json:"bucket"`
+	Region          string            `json:"region,omitempty"`            // Default: from the AWS config
+	Endpoint        string            `json:"endpoint,omitempty"`          // S3-compatible endpoint, e.g. https://minio.example.com:9000
+	PathStyle       bool              `json:"path_style,omitempty"`        // Address buckets by path, as MinIO requires
+	Profile         string            `json:"profile,omitempty"`           // Shared config profile
+	AccessKeyID     string            `json:"access_key_id,omitempty"`     // Static credentials
+	SecretAccessKey string            `json:"secret_access_key,omitempty"` // Static credentials
+	Key             string            `json:"key,omitempty"`               // Key template without extension (default: {{.Tenant}}/{{.Date}}/{{.Commid}})
+	Tenant          string            `json:"tenant,omitempty"`            // Tenant of faxes whose route has none
+	Tenants         map[string]string `json:"tenants,omitempty"`           // Tenants by route name
+	Formats         []string          `json:"formats,omitempty"`           // tiff and/or pdf (default: tiff)
+	StorageClass    string            `json:"storage_class,omitempty"`     // e.g. STANDARD_IA
+
+	key    *template.Template
+	client *s3.Client
+}
+
+// s3KeyData is what key templates are executed with.
+type s3KeyData struct {
+	Tenant    string
+	Route     string
+	Commid    string
+	Direction string
+	Destnum   string
+	Cidnum    string
+	Modem     string
+	Date      string // 2006/01/02
+	Year      string
+	Month     string
+	Day       string
+}
+
+// compile validates the archive config and creates its client.
+func (a *S3Archive) compile() error {
+	if a.Bucket == "" {
+		return fmt.Errorf("s3_archive: bucket is required")
+	}
+	if a.Key == "" {
+		a.Key = defaultS3Key
+	}
+	tmpl, err := template.New("key").Option("missingkey=error").Parse(a.Key)
+	if err != nil {
+		return fmt.Errorf("s3_archive: invalid key template: %w", err)
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, s3KeyData{}); err != nil {
+		return fmt.Errorf("s3_archive: invalid key template: %w", err)
+	}
+	a.key = tmpl
+	if len(a.Formats) == 0 {
+		a.Formats = []string{S3FormatTIFF}
+	}
+	for _, f := range a.Formats {
+		if f != S3FormatTIFF && f != S3FormatPDF {
+			return fmt.Errorf("s3_archive: unknown format: %s", f)
+		}
+	}
+	if (a.AccessKeyID == "") != (a.SecretAccessKey == "") {
+		return fmt.Errorf("s3_archive: access_key_id and secret_access_key must be set together")
+	}
+
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithHTTPClient(httpClient)}
+	if a.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(a.Region))
+	}
+	if a.Profile != "" {
+		opts = append(opts, awsconfig.WithSharedConfigProfile(a.Profile))
+	}
+	if a.AccessKeyID != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(a.AccessKeyID, a.SecretAccessKey, "")))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return fmt.Errorf("s3_archive: error loading AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1" // MinIO's default, and required by the signer
+	}
+	a.client = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if a.Endpoint != "" {
+			o.BaseEndpoint = aws.String(a.Endpoint)
+		}
+		o.UsePathStyle = a.PathStyle
+	})
+	return nil
+}
+
+// objectKey returns the key of a fax's objects, without extension.
+func (a *S3Archive) objectKey(entry XFRecord, route *Route) (string, error) {
+	ts := entry.Ts
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	data := s3KeyData{
+		Tenant:    a.Tenant,
+		Commid:    entry.Commid,
+		Direction: strings.ToLower(string(entry.Direction)),
+		Destnum:   entry.Destnum,
+		Cidnum:    entry.Cidnum,
+		Modem:     entry.Modem,
+		Date:      ts.Format("2006/01/02"),
+		Year:      ts.Format("2006"),
+		Month:     ts.Format("01"),
+		Day:       ts.Format("02"),
+	}
+	if route != nil {
+		data.Route = route.Name
+		if tenant, ok := a.Tenants[route.Name]; ok {
+			data.Tenant = tenant
+		}
+	}
+	var key bytes.Buffer
+	if err := a.key.Execute(&key, data); err != nil {
+		return "", err
+	}
+	// Empty fields, like an unset tenant, must not leave empty segments
+	clean := strings.TrimPrefix(path.Clean("/"+key.String()), "/")
+	if clean == "" || clean == "." {
+		return "", fmt.Errorf("key template %q is empty for %s", a.Key, entry.Commid)
+	}
+	return clean, nil
+}
+
+// Upload stores the TIFF of a relayed fax, its PDF, and their metadata
+// as JSON in the bucket.
+func (a *S3Archive) Upload(job *RelayJob, tiff string, route *Route) error {
+	key, err := a.objectKey(job.Entry, route)
+	if err != nil {
+		return err
+	}
+	meta := ArchiveMeta{
+		Record:   job.Entry,
+		Source:   tiff,
+		Attempts: job.Attempts,
+		Archived: time.Now(),
+	}
+	for _, format := range a.Formats {
+		file, ext, contentType := tiff, ".tif", "image/tiff"
+		if format == S3FormatPDF {
+			pdf, err := convertTiffToPdf(context.Background(), tiff)
+			if err != nil {
+				return err
+			}
+			defer os.Remove(pdf)
+			file, ext, contentType = pdf, ".pdf", "application/pdf"
+		}
+		if err := a.putFile(key+ext, file, contentType, job.Entry); err != nil {
+			return err
+		}
+		meta.Objects = append(meta.Objects, key+ext)
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := a.put(key+".json", bytes.NewReader(data), "application/json", job.Entry); err != nil {
+		return err
+	}
+	log.Infof("Archived %s to s3://%s/%s", job.Entry.Commid, a.Bucket, key)
+	return nil
+}
+
+func (a *S3Archive) putFile(key, file, contentType string, entry XFRecord) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return a.put(key, f, contentType, entry)
+}
+
+func (a *S3Archive) put(key string, body io.ReadSeeker, contentType string, entry XFRecord) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(a.Bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+		Metadata: map[string]string{
+			"commid":    entry.Commid,
+			"direction": string(entry.Direction),
+		},
+	}
+	if a.StorageClass != "" {
+		input.StorageClass = types.StorageClass(a.StorageClass)
+	}
+	_, err := a.client.PutObject(context.Background(), input)
+	format := strings.TrimPrefix(path.Ext(key), ".")
+	if err != nil {
+		s3ArchiveUploads.WithLabelValues(format, "error").Inc()
+		return fmt.Errorf("error uploading s3://%s/%s: %w", a.Bucket, key, err)
+	}
+	s3ArchiveUploads.WithLabelValues(format, "ok").Inc()
+	return nil
+}
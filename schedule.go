@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a daily time range, e.g. mon-fri 08:00-17:00. A window whose end
+// lies before its start runs overnight into the following day.
+type Window struct {
+	Days  string `json:"days"`  // Weekdays like "mon-fri" or "sat,sun" (default: every day)
+	Start string `json:"start"` // Opening time as HH:MM
+	End   string `json:"end"`   // Closing time as HH:MM
+
+	days       [7]bool
+	start, end time.Duration // Offsets from midnight
+}
+
+// Schedule is a set of windows during which relays are dispatched.
+type Schedule struct {
+	Timezone string   `json:"timezone,omitempty"` // IANA time zone (default: local time)
+	Windows  []Window `json:"windows"`
+
+	loc *time.Location
+}
+
+// compile parses the schedule's time zone and windows.
+func (s *Schedule) compile() error {
+	s.loc = time.Local
+	if s.Timezone != "" {
+		loc, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return err
+		}
+		s.loc = loc
+	}
+	if len(s.Windows) == 0 {
+		return fmt.Errorf("no windows")
+	}
+	for i := range s.Windows {
+		if err := s.Windows[i].compile(); err != nil {
+			return fmt.Errorf("window %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (w *Window) compile() error {
+	var err error
+	if w.start, err = parseClock(w.Start); err != nil {
+		return err
+	}
+	if w.end, err = parseClock(w.End); err != nil {
+		return err
+	}
+
+	if w.Days == "" {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+		return nil
+	}
+	for _, part := range strings.Split(strings.ToLower(w.Days), ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return fmt.Errorf("invalid day: %s", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return fmt.Errorf("invalid day: %s", to)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			w.days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time: %s", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// midnight returns the start of the day of t.
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// Open reports whether t lies within one of the schedule's windows.
+func (s *Schedule) Open(t time.Time) bool {
+	t = t.In(s.loc)
+	offset := t.Sub(midnight(t))
+	yesterday := midnight(t).AddDate(0, 0, -1).Weekday()
+
+	for _, w := range s.Windows {
+		if w.end > w.start {
+			if w.days[t.Weekday()] && offset >= w.start && offset < w.end {
+				return true
+			}
+			continue
+		}
+		// Overnight window
+		if w.days[t.Weekday()] && offset >= w.start {
+			return true
+		}
+		if w.days[yesterday] && offset < w.end {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the earliest time at or after t at which the schedule is open.
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.Open(t) {
+		return t
+	}
+
+	t = t.In(s.loc)
+	var next time.Time
+	for day := 0; day <= 7; day++ {
+		date := midnight(t).AddDate(0, 0, day)
+		for _, w := range s.Windows {
+			if !w.days[date.Weekday()] {
+				continue
+			}
+			start := date.Add(w.start)
+			if start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+		if !next.IsZero() {
+			return next
+		}
+	}
+	return t
+}
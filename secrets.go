@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// secretReference matches ${file:PATH}, ${vault:PATH#KEY} and
+// ${aws-sm:ID[#KEY]} references in config files.
+var secretReference = regexp.MustCompile(`\$\{(file|vault|aws-sm):([^}]+)\}`)
+
+// secretTimeout is how long fetching a secret from Vault or AWS may take.
+const secretTimeout = 30 * time.Second
+
+// expandSecrets replaces secret references with the secrets they point to.
+// Every secret is fetched once per expansion, so keys of the same Vault or
+// AWS secret share a request.
+func expandSecrets(data []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	fetched := make(map[string]map[string]string)
+	var err error
+	data = secretReference.ReplaceAllFunc(data, func(ref []byte) []byte {
+		if err != nil {
+			return ref
+		}
+		m := secretReference.FindSubmatch(ref)
+		kind, name := string(m[1]), string(m[2])
+		var value string
+		if value, err = resolveSecret(ctx, kind, name, fetched); err != nil {
+			err = fmt.Errorf("${%s:%s}: %w", kind, name, err)
+		}
+		return []byte(value)
+	})
+	return data, err
+}
+
+func resolveSecret(ctx context.Context, kind, name string, fetched map[string]map[string]string) (string, error) {
+	if kind == "file" {
+		return readSecretFile(name)
+	}
+	id, key, _ := strings.Cut(name, "#")
+	if kind == "vault" && key == "" {
+		return "", fmt.Errorf("a #key is required")
+	}
+	cacheKey := kind + ":" + id
+	values, ok := fetched[cacheKey]
+	if !ok {
+		var err error
+		if kind == "vault" {
+			values, err = fetchVaultSecret(ctx, id)
+		} else {
+			values, err = fetchAWSSecret(ctx, id)
+		}
+		if err != nil {
+			return "", err
+		}
+		fetched[cacheKey] = values
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("no key %q in secret", key)
+	}
+	return value, nil
+}
+
+// readSecretFile returns the content of a file, without trailing newlines
+// as left by editors and echo.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// fetchVaultSecret reads a secret from the Vault at VAULT_ADDR, with the
+// token in VAULT_TOKEN or ~/.vault-token. Both KV v1 and v2 paths work,
+// the latter including data/, e.g. secret/data/gofaxip.
+func fetchVaultSecret(ctx context.Context, path string) (map[string]string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, fmt.Errorf("VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		home, _ := os.UserHomeDir()
+		var err error
+		if token, err = readSecretFile(filepath.Join(home, ".vault-token")); err != nil {
+			return nil, fmt.Errorf("VAULT_TOKEN is not set: %w", err)
+		}
+	}
+	client := httpClient
+	if ca := os.Getenv("VAULT_CACERT"); ca != "" {
+		tlsConfig, err := TLSOptions{CAFile: ca}.Config()
+		if err != nil {
+			return nil, err
+		}
+		client = newHTTPClient(secretTimeout, tlsConfig)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	body, err := doSecretRequest(client, req)
+	if err != nil {
+		return nil, fmt.Errorf("error reading vault secret: %w", err)
+	}
+	var resp struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("error parsing vault secret: %w", err)
+	}
+	data := resp.Data
+	if _, ok := data["metadata"]; ok && data["data"] != nil {
+		// KV v2 wraps the secret with its metadata
+		data = nil
+		if err := json.Unmarshal(resp.Data["data"], &data); err != nil {
+			return nil, fmt.Errorf("error parsing vault secret: %w", err)
+		}
+	}
+	return secretValues(data), nil
+}
+
+// fetchAWSSecret reads a secret from AWS Secrets Manager with the default
+// AWS credentials and region. The whole secret string is the empty key; if
+// it is a JSON object, its fields are keys too.
+func fetchAWSSecret(ctx context.Context, id string) (map[string]string, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, fmt.Errorf("error loading AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("no AWS region configured")
+	}
+	endpoint := "https://secretsmanager." + cfg.Region + ".amazonaws.com"
+	if cfg.BaseEndpoint != nil {
+		endpoint = *cfg.BaseEndpoint
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving AWS credentials: %w", err)
+	}
+
+	payload, _ := json.Marshal(map[string]string{"SecretId": id})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	hash := sha256.Sum256(payload)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "secretsmanager", cfg.Region, time.Now()); err != nil {
+		return nil, err
+	}
+	body, err := doSecretRequest(httpClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("error reading AWS secret: %w", err)
+	}
+	var resp struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("error parsing AWS secret: %w", err)
+	}
+	if resp.SecretString == nil {
+		return nil, fmt.Errorf("AWS secret %s is binary", id)
+	}
+	values := map[string]string{"": *resp.SecretString}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal([]byte(*resp.SecretString), &fields) == nil {
+		for k, v := range secretValues(fields) {
+			values[k] = v
+		}
+	}
+	return values, nil
+}
+
+// secretValues returns the fields of a secret as strings. Numbers and
+// booleans are kept as written.
+func secretValues(fields map[string]json.RawMessage) map[string]string {
+	values := make(map[string]string, len(fields))
+	for k, raw := range fields {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			values[k] = s
+		} else {
+			values[k] = string(raw)
+		}
+	}
+	return values
+}
+
+func doSecretRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// EventSubmitted is emitted when a fax sent through the API is submitted.
+const EventSubmitted = "fax_submitted"
+
+// maxSendSize limits uploads to the send endpoint.
+const maxSendSize = 32 << 20
+
+var errInvalidSend = errors.New("invalid send request")
+
+// SendRequest is an outbound fax submitted through the API.
+type SendRequest struct {
+	Destnum string
+	Cidnum  string
+	Cidname string
+	Backend string // sendfax or hylafax (default: the first of them in backends)
+	Route   string // Name of the route whose modem, host and profile are used
+	Profile string // Name of a sendfax profile, overriding the route's
+}
+
+// Submission is the outcome of a SendRequest.
+type Submission struct {
+	ID      string `json:"id"` // Commid of the outbound fax in events
+	Backend string `json:"backend"`
+	Jobid   string `json:"jobid,omitempty"` // HylaFAX job
+	Output  string `json:"output,omitempty"`
+}
+
+// Send submits a document through the sendfax or hylafax backend. Faxes
+// sent through the local HylaFAX are tracked like relays, so their SEND
+// records emit delivery_confirmed and delivery_failed events.
+func (r *Relayer) Send(ctx context.Context, req SendRequest, path string) (*Submission, error) {
+	cfg := r.config.Load()
+	backend, err := sendBackend(cfg, req.Backend)
+	if err != nil {
+		return nil, err
+	}
+	var route *Route
+	if req.Route != "" {
+		for i := range cfg.Routes {
+			if cfg.Routes[i].Name == req.Route {
+				route = &cfg.Routes[i]
+				break
+			}
+		}
+		if route == nil {
+			return nil, fmt.Errorf("%w: unknown route %s", errInvalidSend, req.Route)
+		}
+	}
+	if req.Profile != "" {
+		if _, ok := cfg.Profiles[req.Profile]; !ok {
+			return nil, fmt.Errorf("%w: unknown profile %s", errInvalidSend, req.Profile)
+		}
+		custom := Route{Name: req.Profile, Profile: req.Profile}
+		if route != nil {
+			custom = *route
+			custom.Profile = req.Profile
+		}
+		route = &custom
+	}
+
+	id, err := sendID()
+	if err != nil {
+		return nil, err
+	}
+	entry := XFRecord{
+		Ts:      time.Now().UTC(),
+		Commid:  id,
+		Destnum: req.Destnum,
+		Cidnum:  req.Cidnum,
+		Cidname: req.Cidname,
+	}
+	cfg.Rewrite.Apply(&entry)
+
+	ctx, cancel := withTimeout(ctx, relayTimeout)
+	defer cancel()
+	job := &RelayJob{Entry: entry, Created: time.Now(), Path: path}
+	output, err := r.backends[backend].Deliver(ctx, job, path, route, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", backend, err)
+	}
+	job.LastOutput = output
+
+	sub := &Submission{ID: id, Backend: backend, Jobid: parseSendfaxJobID(output), Output: output}
+	event := newEvent(EventSubmitted, job)
+	event.Jobid = sub.Jobid
+	log.WithFields(event.Fields()).Infof("Submitted fax to %s as job %s", entry.Destnum, sub.Jobid)
+	r.notify(event)
+	return sub, nil
+}
+
+// sendBackend picks the backend of a send request.
+func sendBackend(cfg *Config, name string) (string, error) {
+	if name != "" {
+		if name != BackendSendfax && name != BackendHylaFAX {
+			return "", fmt.Errorf("%w: backend must be sendfax or hylafax", errInvalidSend)
+		}
+		if err := cfg.validateBackends([]string{name}); err != nil {
+			return "", fmt.Errorf("%w: %s", errInvalidSend, err)
+		}
+		return name, nil
+	}
+	for _, b := range cfg.Backends {
+		if b == BackendSendfax || b == BackendHylaFAX {
+			return b, nil
+		}
+	}
+	return BackendSendfax, nil
+}
+
+// sendID returns a new commid for an outbound fax.
+func sendID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "api-" + hex.EncodeToString(b), nil
+}
+
+// faxDocument returns the extension of a document HylaFAX can send as is,
+// and whether it must be converted to PDF first.
+func faxDocument(head []byte) (ext string, convert bool, err error) {
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return ".pdf", false, nil
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return ".tif", false, nil
+	}
+	switch http.DetectContentType(head) {
+	case "image/png":
+		return ".png", true, nil
+	case "image/jpeg":
+		return ".jpg", true, nil
+	}
+	return "", false, fmt.Errorf("%w: file must be a PDF, TIFF, PNG or JPEG", errInvalidSend)
+}
+
+// saveDocument writes an uploaded document to a temporary file, converting
+// images to PDF, and returns its path.
+func saveDocument(src io.Reader) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("%w: empty file", errInvalidSend)
+	}
+	head = head[:n]
+	ext, convert, err := faxDocument(head)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.CreateTemp("", "fax_send_*"+ext)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, io.MultiReader(bytes.NewReader(head), src)); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("error saving upload: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if !convert {
+		return f.Name(), nil
+	}
+
+	defer os.Remove(f.Name())
+	pdfPath := filepath.Join(os.TempDir(), fmt.Sprintf("fax_send_%d.pdf", time.Now().UnixNano()))
+	output, err := exec.Command("convert", f.Name(), pdfPath).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to convert image to PDF: %v, output: %s", err, string(output))
+	}
+	return pdfPath, nil
+}
+
+// serveSend handles POST /api/v1/send, a multipart form with the document
+// as file and the fields of a SendRequest.
+func (a *API) serveSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !a.authorized(w, r) {
+		return
+	}
+	if relayer == nil {
+		writeError(w, http.StatusServiceUnavailable, "relaying is not running")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSendSize)
+	if err := r.ParseMultipartForm(maxSendSize); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid form, expected multipart/form-data up to %d MiB: %s", maxSendSize>>20, err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	req := SendRequest{
+		Destnum: r.FormValue("destination"),
+		Cidnum:  r.FormValue("caller_id"),
+		Cidname: r.FormValue("caller_name"),
+		Backend: r.FormValue("backend"),
+		Route:   r.FormValue("route"),
+		Profile: r.FormValue("profile"),
+	}
+	if !isDigits(req.Destnum) {
+		writeError(w, http.StatusBadRequest, "destination must be a number")
+		return
+	}
+	if req.Cidnum != "" && !isDigits(req.Cidnum) {
+		writeError(w, http.StatusBadRequest, "caller_id must be a number")
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "file is required")
+		return
+	}
+	defer file.Close()
+
+	path, err := saveDocument(file)
+	if errors.Is(err, errInvalidSend) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		log.Errorf("Error saving fax to send: %s", err)
+		writeError(w, http.StatusInternalServerError, "error saving document")
+		return
+	}
+	// sendfax and hfaxd have copied the document once submitted
+	defer os.Remove(path)
+
+	sub, err := relayer.Send(r.Context(), req, path)
+	if errors.Is(err, errInvalidSend) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		log.Errorf("Error submitting fax to %s: %s", req.Destnum, err)
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, sub)
+}
+
+// isDigits reports whether s is a non-empty string of digits, optionally
+// with a leading +.
+func isDigits(s string) bool {
+	if len(s) > 0 && s[0] == '+' {
+		s = s[1:]
+	}
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// serverTLSFlags registers the <prefix>TLSCert, <prefix>TLSKey and
+// <prefix>ClientCA flags of a server, and returns a function creating its
+// TLS config once the flags are parsed, or nil if it serves plain text.
+func serverTLSFlags(prefix, server string) func() (*tls.Config, error) {
+	var certFile, keyFile, clientCA string
+	flag.StringVar(&certFile, prefix+"TLSCert", "", "PEM certificate chain to serve the "+server+" over TLS with")
+	flag.StringVar(&keyFile, prefix+"TLSKey", "", "PEM key of "+prefix+"TLSCert")
+	flag.StringVar(&clientCA, prefix+"ClientCA", "", "PEM bundle of CAs client certificates of the "+server+" must be signed by (default: none required)")
+	return func() (*tls.Config, error) {
+		if certFile == "" && keyFile == "" && clientCA == "" {
+			return nil, nil
+		}
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("%sTLSCert and %sTLSKey must be given together", prefix, prefix)
+		}
+		cert := &serverCert{certFile: certFile, keyFile: keyFile}
+		if err := cert.load(); err != nil {
+			return nil, fmt.Errorf("%sTLSCert: %w", prefix, err)
+		}
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: cert.get}
+		if clientCA != "" {
+			pem, err := os.ReadFile(clientCA)
+			if err != nil {
+				return nil, fmt.Errorf("%sClientCA: %w", prefix, err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("%sClientCA: no certificates found in %s", prefix, clientCA)
+			}
+			cfg.ClientCAs = pool
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		return cfg, nil
+	}
+}
+
+// serverCert is a certificate reloaded once its file changes, so renewed
+// certificates are served without a restart.
+type serverCert struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (c *serverCert) load() error {
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.cert, c.modTime = &cert, info.ModTime()
+	return nil
+}
+
+func (c *serverCert) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if info, err := os.Stat(c.certFile); err == nil && !info.ModTime().Equal(c.modTime) {
+		if err := c.load(); err != nil {
+			// The key may not be written yet, so the old pair is kept
+			log.Warnf("Error reloading %s, serving the previous certificate: %s", c.certFile, err)
+		} else {
+			log.Infof("Reloaded certificate %s", c.certFile)
+		}
+	}
+	return c.cert, nil
+}
+
+// listen binds the TCP address of a server, so its port is bound before
+// privileges are dropped.
+func listen(server, addr string) net.Listener {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Failed to listen for %s: %s", server, err)
+	}
+	return lis
+}
+
+// serve serves handler on lis, over TLS if tlsConfig is set.
+func serve(lis net.Listener, handler http.Handler, tlsConfig *tls.Config) error {
+	server := &http.Server{Handler: handler, TLSConfig: tlsConfig}
+	if tlsConfig == nil {
+		return server.Serve(lis)
+	}
+	return server.ServeTLS(lis, "", "")
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// shutdown drains the bridge before it exits: running relay attempts are
+// finished, and then the sinks push or spool their buffered records, each
+// for up to timeout. Queued relays, processed lines and the duplicate and
+// delivery state are persisted as they change.
+func shutdown(timeout time.Duration) {
+	if err := sdNotify("STOPPING=1"); err != nil {
+		log.Errorf("Error signaling shutdown: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := relayer.Stop(ctx); err != nil {
+		log.Warnf("Cancelled relay attempts still running after %s, they are retried on the next start", timeout)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		sinks.Load().Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Info("Shut down")
+	case <-time.After(timeout):
+		log.Warnf("Sinks not flushed after %s, their buffered records are lost", timeout)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A Sink receives every processed xferfaxlog record.
+type Sink interface {
+	Push(ctx context.Context, record XFRecord) error
+}
+
+// SinkEnv is what sink factories get besides their own config.
+type SinkEnv struct {
+	Name   string // Name of the sink, used for defaults like spool paths
+	LogDir string // The -logDir directory
+}
+
+// SinkFactory creates a sink from its JSON config.
+type SinkFactory func(raw json.RawMessage, env SinkEnv) (Sink, error)
+
+var sinkRegistry = map[string]SinkFactory{}
+
+// RegisterSink makes a sink type available to the sinks config section.
+func RegisterSink(kind string, factory SinkFactory) {
+	if _, ok := sinkRegistry[kind]; ok {
+		panic("sink type registered twice: " + kind)
+	}
+	sinkRegistry[kind] = factory
+}
+
+// sinkTypes returns the registered sink types.
+func sinkTypes() []string {
+	types := make([]string, 0, len(sinkRegistry))
+	for kind := range sinkRegistry {
+		types = append(types, kind)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// SinkConfig is one entry of the sinks config section. Besides type and
+// name it holds the options of the sink type.
+type SinkConfig struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"` // Defaults to the type
+
+	raw json.RawMessage
+}
+
+func (c *SinkConfig) UnmarshalJSON(data []byte) error {
+	type plain SinkConfig
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+	c.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+func (c SinkConfig) MarshalJSON() ([]byte, error) {
+	if c.raw != nil {
+		return c.raw, nil
+	}
+	type plain SinkConfig
+	return json.Marshal(plain(c))
+}
+
+func (c *SinkConfig) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Type
+}
+
+// validateSinks checks that all sinks have a known type and a unique name.
+func validateSinks(configs []SinkConfig) error {
+	names := make(map[string]bool)
+	for i := range configs {
+		c := &configs[i]
+		if _, ok := sinkRegistry[c.Type]; !ok {
+			return fmt.Errorf("sink %d: unknown type %q (known: %v)", i, c.Type, sinkTypes())
+		}
+		if names[c.name()] {
+			return fmt.Errorf("sink %s: name used twice", c.name())
+		}
+		names[c.name()] = true
+	}
+	return nil
+}
+
+// namedSink is an opened sink with its name for logging.
+type namedSink struct {
+	name   string
+	config json.RawMessage // Config the sink was opened with, nil for the -loki* sink
+	Sink
+}
+
+// Sinks pushes records to several sinks.
+type Sinks []namedSink
+
+// OpenSinks creates the configured sinks.
+func OpenSinks(configs []SinkConfig, logDir string) (Sinks, error) {
+	var sinks Sinks
+	for i := range configs {
+		sink, err := openSink(&configs[i], logDir)
+		if err != nil {
+			sinks.Close()
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func openSink(c *SinkConfig, logDir string) (namedSink, error) {
+	factory, ok := sinkRegistry[c.Type]
+	if !ok {
+		return namedSink{}, fmt.Errorf("sink %s: unknown type %q", c.name(), c.Type)
+	}
+	raw := c.raw
+	if raw == nil {
+		raw = json.RawMessage("{}")
+	}
+	sink, err := factory(raw, SinkEnv{Name: c.name(), LogDir: logDir})
+	if err != nil {
+		return namedSink{}, fmt.Errorf("sink %s: %w", c.name(), err)
+	}
+	return namedSink{name: c.name(), config: raw, Sink: sink}, nil
+}
+
+// Reload returns the sinks for the new configs. Sinks whose config did not
+// change are kept open, as is the sink of the -loki* flags; the sinks no
+// longer used are returned, to be closed once the new ones are in use.
+func (s Sinks) Reload(configs []SinkConfig, logDir string) (Sinks, Sinks, error) {
+	current := make(map[string]namedSink)
+	for _, sink := range s {
+		if sink.config != nil {
+			current[sink.name] = sink
+		}
+	}
+
+	var reloaded, opened Sinks
+	for i := range configs {
+		c := &configs[i]
+		if old, ok := current[c.name()]; ok && bytes.Equal(old.config, c.raw) {
+			reloaded = append(reloaded, old)
+			delete(current, c.name())
+			continue
+		}
+		sink, err := openSink(c, logDir)
+		if err != nil {
+			opened.Close()
+			return nil, nil, err
+		}
+		reloaded = append(reloaded, sink)
+		opened = append(opened, sink)
+	}
+	for _, sink := range s {
+		if sink.config == nil {
+			reloaded = append(reloaded, sink)
+		}
+	}
+
+	var unused Sinks
+	for _, sink := range current {
+		unused = append(unused, sink)
+	}
+	return reloaded, unused, nil
+}
+
+// Close flushes and closes the sinks that hold connections, files or
+// buffered records.
+func (s Sinks) Close() {
+	for _, sink := range s {
+		if c, ok := sink.Sink.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Errorf("Error closing sink %s: %s", sink.name, err)
+			}
+		}
+	}
+}
+
+// With returns the sinks with another one added.
+func (s Sinks) With(name string, sink Sink) Sinks {
+	return append(s, namedSink{name: name, Sink: sink})
+}
+
+// asyncSink is implemented by sinks that queue records and track their
+// successful pushes themselves.
+type asyncSink interface {
+	async()
+}
+
+// Push pushes the record to all sinks in order and logs failures, so one
+// failing sink does not keep the record from the others. Each sink has up
+// to pushTimeout.
+func (s Sinks) Push(ctx context.Context, record XFRecord) {
+	for _, sink := range s {
+		pushCtx, cancel := withTimeout(ctx, pushTimeout)
+		err := sink.Push(pushCtx, record)
+		cancel()
+		if _, ok := sink.Sink.(asyncSink); !ok {
+			countPush(sink.name, err)
+			if err == nil {
+				sinkLastSuccess.WithLabelValues(sink.name).SetToCurrentTime()
+			} else {
+				sinkDropped.WithLabelValues(sink.name).Inc()
+			}
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"sink":   sink.name,
+				"commid": record.Commid,
+			}).Errorf("Error pushing record to sink %s: %s", sink.name, err)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const slackAPI = "https://slack.com/api/"
+
+// SlackNotifier posts events to Slack as Block Kit messages, through an
+// incoming webhook or the Web API. With a bot token, a preview of the first
+// page can be uploaded into the message's thread.
+type SlackNotifier struct {
+	WebhookURL string      `json:"webhook_url,omitempty"` // Incoming webhook
+	Token      string      `json:"token,omitempty"`       // Bot token (xoxb-...) for chat.postMessage
+	Channel    string      `json:"channel,omitempty"`     // Channel ID or name posted to with the token
+	Thumbnail  bool        `json:"thumbnail,omitempty"`   // Upload a first-page preview (token only)
+	Message    string      `json:"message,omitempty"`     // Go template over the event posted as mrkdwn instead of the default blocks
+	Events     eventFilter `json:"events,omitempty"`
+
+	message *template.Template
+}
+
+// compile checks that one way of posting is configured and parses the
+// message template.
+func (s *SlackNotifier) compile() error {
+	if (s.WebhookURL == "") == (s.Token == "") {
+		return fmt.Errorf("slack: exactly one of webhook_url or token is required")
+	}
+	if s.Token != "" && s.Channel == "" {
+		return fmt.Errorf("slack: token requires channel")
+	}
+	var err error
+	s.message, err = parseNotifyTemplate("slack message", s.Message)
+	return err
+}
+
+// Notify posts the event to Slack.
+func (s *SlackNotifier) Notify(ctx context.Context, event Event) error {
+	if !s.Events.accepts(event.Type) {
+		return nil
+	}
+	err := s.post(ctx, event)
+	countPush("notify_slack", err)
+	if err != nil {
+		sinkDropped.WithLabelValues("notify_slack").Inc()
+	}
+	return err
+}
+
+func (s *SlackNotifier) post(ctx context.Context, event Event) error {
+	msg := map[string]any{
+		"text":   slackEscape(eventSummary(event)),
+		"blocks": slackBlocks(event),
+	}
+	if s.message != nil {
+		text, err := renderEvent(s.message, event)
+		if err != nil {
+			return err
+		}
+		msg["text"] = text
+		msg["blocks"] = []any{map[string]any{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": truncate(text, 3000)}}}
+	}
+	if s.WebhookURL != "" {
+		_, err := s.call(ctx, s.WebhookURL, msg)
+		return err
+	}
+
+	msg["channel"] = s.Channel
+	resp, err := s.call(ctx, slackAPI+"chat.postMessage", msg)
+	if err != nil {
+		return err
+	}
+	if s.Thumbnail && event.path != "" {
+		if err := s.uploadPreview(ctx, event, resp.Channel, resp.TS); err != nil {
+			log.WithFields(event.Fields()).Warnf("Error uploading preview to Slack: %s", err)
+		}
+	}
+	return nil
+}
+
+// eventSummary is the one-line text of chat notifications.
+func eventSummary(event Event) string {
+	summary := fmt.Sprintf("Fax %s: %s to %s", strings.ReplaceAll(event.Type, "_", " "), event.Cidnum, event.Destnum)
+	if event.ReasonCode != "" && event.ReasonCode != "OK" {
+		summary += " (" + event.ReasonCode + ")"
+	}
+	return summary
+}
+
+// eventDetails returns the labeled fields shown in chat notifications.
+func eventDetails(event Event) [][2]string {
+	details := [][2]string{
+		{"CommID", event.Commid},
+		{"Caller", strings.TrimSpace(event.Cidnum + " " + event.Cidname)},
+		{"Destination", event.Destnum},
+	}
+	if event.Record.Pages > 0 {
+		details = append(details, [2]string{"Pages", strconv.Itoa(int(event.Record.Pages))})
+	}
+	if event.Attempts > 0 {
+		details = append(details, [2]string{"Attempts", strconv.Itoa(event.Attempts)})
+	}
+	if event.Jobid != "" {
+		details = append(details, [2]string{"Job", event.Jobid})
+	}
+	if event.Reason != "" {
+		details = append(details, [2]string{"Reason", event.Reason})
+	}
+	if event.Error != "" {
+		details = append(details, [2]string{"Error", event.Error})
+	}
+	return details
+}
+
+// slackEscape escapes the characters Slack treats as control sequences in
+// mrkdwn, so a caller name like <!channel> can't ping anyone.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// truncate shortens s to at most max runes, marking the cut with an
+// ellipsis.
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max-1]) + "…"
+}
+
+func slackBlocks(event Event) []any {
+	var fields []any
+	for _, d := range eventDetails(event) {
+		// Field texts may have 2000 characters, escaping makes them up to 5 times longer
+		fields = append(fields, map[string]string{"type": "mrkdwn", "text": "*" + d[0] + "*\n" + slackEscape(truncate(d[1], 350))})
+	}
+	// Slack allows up to 10 fields per section
+	if len(fields) > 10 {
+		fields = fields[:10]
+	}
+	return []any{
+		// Header text is limited to 150 characters
+		map[string]any{"type": "header", "text": map[string]string{"type": "plain_text", "text": truncate(eventSummary(event), 150)}},
+		map[string]any{"type": "section", "fields": fields},
+		map[string]any{"type": "context", "elements": []any{
+			map[string]string{"type": "mrkdwn", "text": event.Time.Format("2006-01-02 15:04:05 MST")},
+		}},
+	}
+}
+
+// slackResponse holds the fields of Web API responses the notifier uses.
+type slackResponse struct {
+	OK        bool   `json:"ok"`
+	Error     string `json:"error"`
+	Channel   string `json:"channel"`
+	TS        string `json:"ts"`
+	UploadURL string `json:"upload_url"`
+	FileID    string `json:"file_id"`
+}
+
+// call posts JSON to Slack. Web API errors are returned with their code.
+func (s *SlackNotifier) call(ctx context.Context, endpoint string, msg any) (*slackResponse, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling json: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return s.do(req, endpoint != s.WebhookURL)
+}
+
+func (s *SlackNotifier) do(req *http.Request, api bool) (*slackResponse, error) {
+	if api {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error posting to Slack: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &statusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	if !api {
+		return &slackResponse{OK: true}, nil
+	}
+	r := &slackResponse{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("error parsing Slack response: %w", err)
+	}
+	if !r.OK {
+		return nil, fmt.Errorf("slack: %s", r.Error)
+	}
+	return r, nil
+}
+
+// uploadPreview uploads a PNG of the first page into the thread of the message.
+func (s *SlackNotifier) uploadPreview(ctx context.Context, event Event, channel, ts string) error {
+	png, err := renderPreview(event.path)
+	if err != nil {
+		return err
+	}
+	name := "fax_" + event.Commid + ".png"
+
+	form := url.Values{"filename": {name}, "length": {strconv.Itoa(len(png))}}
+	req, err := http.NewRequestWithContext(ctx, "POST", slackAPI+"files.getUploadURLExternal", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	upload, err := s.do(req, true)
+	if err != nil {
+		return err
+	}
+
+	req, err = http.NewRequestWithContext(ctx, "POST", upload.UploadURL, bytes.NewReader(png))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "image/png")
+	if _, err := s.do(req, false); err != nil {
+		return err
+	}
+
+	_, err = s.call(ctx, slackAPI+"files.completeUploadExternal", map[string]any{
+		"files":      []map[string]string{{"id": upload.FileID, "title": "First page"}},
+		"channel_id": channel,
+		"thread_ts":  ts,
+	})
+	return err
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// SMS providers.
+const (
+	SMSProviderTwilio  = "twilio"
+	SMSProviderWebhook = "webhook"
+)
+
+const (
+	defaultSMSMessage = `Fax {{.Type}} {{.Commid}}: {{.Cidnum}} to {{.Destnum}}{{if .Error}}: {{.Error}}{{end}}`
+	maxSMSLength      = 320
+)
+
+// SMSNotifier texts critical events through Twilio or a generic SMS gateway
+// webhook. Recipients can be mapped per route, so only faxes to priority
+// DIDs page someone.
+type SMSNotifier struct {
+	Provider   string              `json:"provider"`              // twilio or webhook
+	AccountSID string              `json:"account_sid,omitempty"` // Twilio account
+	AuthToken  string              `json:"auth_token,omitempty"`  // Twilio auth token
+	URL        string              `json:"url,omitempty"`         // Gateway the webhook provider posts {to, from, message} to
+	Username   string              `json:"username,omitempty"`
+	Password   string              `json:"password,omitempty"`
+	From       string              `json:"from"`
+	To         []string            `json:"to,omitempty"`           // Recipients for events of routes not in Routes
+	Routes     map[string][]string `json:"routes,omitempty"`       // Recipients per route name
+	Message    string              `json:"message,omitempty"`      // Go template over the event
+	MaxPerHour int                 `json:"max_per_hour,omitempty"` // Messages per recipient and hour (0 is unlimited)
+	Events     eventFilter         `json:"events,omitempty"`       // default: relay_failed
+
+	routes  RoutingTable
+	message *template.Template
+}
+
+// smsSent holds the send times within the last hour by recipient. It is kept
+// outside SMSNotifier, so reloading the config doesn't reset the limit.
+var smsSent = struct {
+	mu   sync.Mutex
+	sent map[string][]time.Time
+}{sent: make(map[string][]time.Time)}
+
+// compile validates the notifier against the routing table.
+func (s *SMSNotifier) compile(routes RoutingTable) error {
+	switch s.Provider {
+	case SMSProviderTwilio:
+		if s.AccountSID == "" || s.AuthToken == "" {
+			return fmt.Errorf("sms: twilio requires account_sid and auth_token")
+		}
+	case SMSProviderWebhook:
+		if s.URL == "" {
+			return fmt.Errorf("sms: webhook requires url")
+		}
+	default:
+		return fmt.Errorf("sms: unknown provider: %s", s.Provider)
+	}
+	for name := range s.Routes {
+		found := false
+		for _, route := range routes {
+			found = found || route.Name == name
+		}
+		if !found {
+			return fmt.Errorf("sms: unknown route: %s", name)
+		}
+	}
+	if len(s.Events) == 0 {
+		s.Events = eventFilter{EventRelayFailed}
+	}
+
+	message := s.Message
+	if message == "" {
+		message = defaultSMSMessage
+	}
+	var err error
+	if s.message, err = parseNotifyTemplate("sms message", message); err != nil {
+		return err
+	}
+	s.routes = routes
+	return nil
+}
+
+// recipients returns the numbers texted about the event.
+func (s *SMSNotifier) recipients(event Event) []string {
+	if route := s.routes.Match(event.Record); route != nil {
+		if to, ok := s.Routes[route.Name]; ok {
+			return to
+		}
+	}
+	return s.To
+}
+
+// allow registers a message to the recipient unless it has reached MaxPerHour.
+func (s *SMSNotifier) allow(to string) bool {
+	if s.MaxPerHour <= 0 {
+		return true
+	}
+	smsSent.mu.Lock()
+	defer smsSent.mu.Unlock()
+
+	now := time.Now()
+	for recipient, sent := range smsSent.sent {
+		for len(sent) > 0 && now.Sub(sent[0]) >= time.Hour {
+			sent = sent[1:]
+		}
+		if len(sent) == 0 {
+			delete(smsSent.sent, recipient)
+		} else {
+			smsSent.sent[recipient] = sent
+		}
+	}
+	sent := smsSent.sent[to]
+	if len(sent) >= s.MaxPerHour {
+		return false
+	}
+	smsSent.sent[to] = append(sent, now)
+	return true
+}
+
+// Notify texts the event to the recipients of its route.
+func (s *SMSNotifier) Notify(ctx context.Context, event Event) error {
+	if !s.Events.accepts(event.Type) {
+		return nil
+	}
+
+	text, err := renderEvent(s.message, event)
+	if err != nil {
+		return err
+	}
+	message := truncate(strings.TrimSpace(text), maxSMSLength)
+
+	var errs []string
+	for _, to := range s.recipients(event) {
+		if !s.allow(to) {
+			sinkDropped.WithLabelValues("notify_sms").Inc()
+			errs = append(errs, fmt.Sprintf("%s: rate limit of %d per hour reached", to, s.MaxPerHour))
+			continue
+		}
+		err := s.send(ctx, to, message)
+		countPush("notify_sms", err)
+		if err != nil {
+			sinkDropped.WithLabelValues("notify_sms").Inc()
+			errs = append(errs, fmt.Sprintf("%s: %s", to, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error sending sms: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (s *SMSNotifier) send(ctx context.Context, to, message string) error {
+	var req *http.Request
+	var err error
+	if s.Provider == SMSProviderTwilio {
+		form := url.Values{"To": {to}, "From": {s.From}, "Body": {message}}
+		endpoint := "https://api.twilio.com/2010-04-01/Accounts/" + url.PathEscape(s.AccountSID) + "/Messages.json"
+		req, err = http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return fmt.Errorf("error creating request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(s.AccountSID, s.AuthToken)
+	} else {
+		body, err := json.Marshal(map[string]string{"to": to, "from": s.From, "message": message})
+		if err != nil {
+			return fmt.Errorf("error marshaling json: %w", err)
+		}
+		req, err = http.NewRequestWithContext(ctx, "POST", s.URL, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("error creating request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if s.Username != "" && s.Password != "" {
+			req.SetBasicAuth(s.Username, s.Password)
+		}
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+	return nil
+}
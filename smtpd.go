@@ -0,0 +1,312 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SMTP limits of the mail-to-fax gateway.
+const (
+	smtpTimeout       = 5 * time.Minute
+	smtpMaxRecipients = 20
+	smtpMaxErrors     = 10
+)
+
+// serveSMTP accepts mail for the mail_to_fax section of the config on lis.
+func serveSMTP(lis net.Listener) {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	log.Infof("Serving mail to fax on %s", lis.Addr())
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			log.Errorf("Error accepting SMTP connection: %s", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		go (&smtpSession{hostname: hostname}).serve(conn)
+	}
+}
+
+// smtpSession is an SMTP connection of the mail-to-fax gateway.
+type smtpSession struct {
+	hostname string
+	conn     net.Conn
+	text     *textproto.Conn
+	tls      bool
+	user     string // Logged in SMTP AUTH user
+
+	cfg   *MailToFax // Of the current transaction
+	from  string
+	rcpts []mailRecipient
+}
+
+func (s *smtpSession) serve(conn net.Conn) {
+	defer conn.Close()
+	s.setConn(conn)
+	logger := log.WithField("remote", conn.RemoteAddr().String())
+
+	cfg := relayer.Config().MailToFax
+	if cfg == nil {
+		s.reply(421, "4.3.0 Mail to fax is not configured")
+		return
+	}
+	s.reply(220, s.hostname+" ESMTP gofaxip-bridge")
+
+	errs := 0
+	for errs < smtpMaxErrors {
+		s.conn.SetDeadline(time.Now().Add(smtpTimeout))
+		line, err := s.text.ReadLine()
+		if err != nil {
+			if err != io.EOF {
+				logger.Debugf("SMTP connection closed: %s", err)
+			}
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		code, quit := s.command(strings.ToUpper(verb), strings.TrimSpace(arg), logger)
+		if quit {
+			return
+		}
+		if code >= 500 {
+			errs++
+		}
+	}
+	s.reply(421, "4.7.0 Too many errors")
+}
+
+func (s *smtpSession) setConn(conn net.Conn) {
+	s.conn = conn
+	s.text = textproto.NewConn(conn)
+}
+
+// reply writes a reply, whose lines are separated by newlines.
+func (s *smtpSession) reply(code int, msg string) int {
+	lines := strings.Split(msg, "\n")
+	for i, line := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		s.text.PrintfLine("%d%s%s", code, sep, line)
+	}
+	return code
+}
+
+func (s *smtpSession) reset() {
+	s.cfg, s.from, s.rcpts = nil, "", nil
+}
+
+// command handles a command and returns the reply code, and whether the
+// connection should be closed.
+func (s *smtpSession) command(verb, arg string, logger *log.Entry) (int, bool) {
+	cfg := relayer.Config().MailToFax
+	if cfg == nil {
+		s.reply(421, "4.3.0 Mail to fax is not configured")
+		return 421, true
+	}
+
+	switch verb {
+	case "HELO":
+		s.reset()
+		return s.reply(250, s.hostname), false
+	case "EHLO":
+		s.reset()
+		ext := []string{s.hostname, fmt.Sprintf("SIZE %d", maxSendSize), "8BITMIME", "PIPELINING", "ENHANCEDSTATUSCODES"}
+		if cfg.tls != nil && !s.tls {
+			ext = append(ext, "STARTTLS")
+		}
+		if s.canAuth(cfg) {
+			ext = append(ext, "AUTH PLAIN LOGIN")
+		}
+		return s.reply(250, strings.Join(ext, "\n")), false
+	case "STARTTLS":
+		if cfg.tls == nil || s.tls {
+			return s.reply(502, "5.5.1 STARTTLS not available"), false
+		}
+		s.reply(220, "2.0.0 Ready to start TLS")
+		conn := tls.Server(s.conn, cfg.tls)
+		if err := conn.Handshake(); err != nil {
+			logger.Warnf("SMTP TLS handshake failed: %s", err)
+			return 0, true
+		}
+		s.setConn(conn)
+		s.tls = true
+		s.user = ""
+		s.reset()
+		return 0, false
+	case "AUTH":
+		return s.auth(cfg, arg, logger), false
+	case "MAIL":
+		from, ok := smtpPath(arg, "FROM:")
+		if !ok {
+			return s.reply(501, "5.5.4 Syntax: MAIL FROM:<address>"), false
+		}
+		if len(cfg.Users) > 0 && s.user == "" {
+			return s.reply(530, "5.7.0 Authentication required"), false
+		}
+		s.reset()
+		s.cfg, s.from = cfg, from
+		return s.reply(250, "2.1.0 OK"), false
+	case "RCPT":
+		return s.rcpt(arg, logger), false
+	case "DATA":
+		return s.data(logger), false
+	case "RSET":
+		s.reset()
+		return s.reply(250, "2.0.0 OK"), false
+	case "NOOP":
+		return s.reply(250, "2.0.0 OK"), false
+	case "VRFY":
+		return s.reply(252, "2.5.0 Cannot verify"), false
+	case "QUIT":
+		s.reply(221, "2.0.0 Bye")
+		return 221, true
+	}
+	return s.reply(502, "5.5.2 Command not recognized"), false
+}
+
+// canAuth reports whether AUTH is offered, which requires TLS if the
+// gateway has a certificate.
+func (s *smtpSession) canAuth(cfg *MailToFax) bool {
+	return len(cfg.Users) > 0 && s.user == "" && (s.tls || cfg.tls == nil)
+}
+
+// auth handles AUTH PLAIN and AUTH LOGIN.
+func (s *smtpSession) auth(cfg *MailToFax, arg string, logger *log.Entry) int {
+	if !s.canAuth(cfg) {
+		return s.reply(503, "5.5.1 AUTH not available")
+	}
+	mechanism, initial, _ := strings.Cut(arg, " ")
+
+	var user, pass string
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		resp, ok := s.authResponse(initial, "")
+		if !ok {
+			return s.reply(501, "5.5.2 Invalid response")
+		}
+		// authzid NUL authcid NUL password
+		parts := strings.SplitN(resp, "\x00", 3)
+		if len(parts) != 3 {
+			return s.reply(501, "5.5.2 Invalid response")
+		}
+		user, pass = parts[1], parts[2]
+	case "LOGIN":
+		var ok bool
+		if user, ok = s.authResponse(initial, "Username:"); !ok {
+			return s.reply(501, "5.5.2 Invalid response")
+		}
+		if pass, ok = s.authResponse("", "Password:"); !ok {
+			return s.reply(501, "5.5.2 Invalid response")
+		}
+	default:
+		return s.reply(504, "5.5.4 Unrecognized authentication mechanism")
+	}
+
+	want, ok := cfg.Users[user]
+	if !ok || subtle.ConstantTimeCompare([]byte(pass), []byte(want)) != 1 {
+		logger.Warnf("SMTP authentication of %q failed", user)
+		return s.reply(535, "5.7.8 Authentication credentials invalid")
+	}
+	s.user = user
+	return s.reply(235, "2.7.0 Authentication successful")
+}
+
+// authResponse decodes the initial response of AUTH, or prompts for one.
+func (s *smtpSession) authResponse(initial, prompt string) (string, bool) {
+	if initial == "" {
+		s.reply(334, base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, err := s.text.ReadLine()
+		if err != nil || line == "*" {
+			return "", false
+		}
+		initial = line
+	}
+	if initial == "=" {
+		return "", true
+	}
+	decoded, err := base64.StdEncoding.DecodeString(initial)
+	return string(decoded), err == nil
+}
+
+func (s *smtpSession) rcpt(arg string, logger *log.Entry) int {
+	if s.cfg == nil {
+		return s.reply(503, "5.5.1 MAIL first")
+	}
+	to, ok := smtpPath(arg, "TO:")
+	if !ok {
+		return s.reply(501, "5.5.4 Syntax: RCPT TO:<address>")
+	}
+	if len(s.rcpts) >= smtpMaxRecipients {
+		return s.reply(452, "4.5.3 Too many recipients")
+	}
+	destnum, ok := s.cfg.recipient(to)
+	if !ok {
+		return s.reply(550, "5.1.1 Recipient must be <number>@"+s.cfg.Domains[0])
+	}
+	sender := s.cfg.sender(s.from, s.user, destnum)
+	if sender == nil {
+		logger.WithFields(log.Fields{"from": s.from, "user": s.user, "destnum": destnum}).Warn("Sender is not authorized to fax")
+		return s.reply(550, "5.7.1 Sender not authorized to fax "+destnum)
+	}
+	s.rcpts = append(s.rcpts, mailRecipient{destnum: destnum, sender: sender})
+	return s.reply(250, "2.1.5 OK")
+}
+
+func (s *smtpSession) data(logger *log.Entry) int {
+	if len(s.rcpts) == 0 {
+		return s.reply(503, "5.5.1 RCPT first")
+	}
+	s.reply(354, "End data with <CR><LF>.<CR><LF>")
+	r := s.text.DotReader()
+	msg, err := io.ReadAll(io.LimitReader(r, maxSendSize+1))
+	if err != nil {
+		return s.reply(451, "4.3.0 Error reading message")
+	}
+	defer s.reset()
+	if len(msg) > maxSendSize {
+		io.Copy(io.Discard, r)
+		return s.reply(552, "5.3.4 Message too big")
+	}
+
+	subs, err := s.cfg.submit(s.from, msg, s.rcpts)
+	if errors.Is(err, errNoAttachment) {
+		return s.reply(554, "5.6.0 "+err.Error())
+	} else if err != nil {
+		logger.WithField("from", s.from).Errorf("Error faxing mail: %s", err)
+		return s.reply(554, fmt.Sprintf("5.3.0 Submitted %d faxes, then: %s", len(subs), err))
+	}
+	ids := make([]string, len(subs))
+	for i, sub := range subs {
+		ids[i] = sub.ID
+	}
+	return s.reply(250, "2.0.0 Queued as "+strings.Join(ids, " "))
+}
+
+// smtpPath parses the address of MAIL FROM:<address> or RCPT TO:<address>,
+// ignoring parameters like SIZE=.
+func smtpPath(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(arg, "<") {
+		return "", false
+	}
+	addr, _, ok := strings.Cut(arg[1:], ">")
+	return addr, ok
+}
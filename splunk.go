@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	RegisterSink("splunk", newSplunkSink)
+}
+
+// SplunkSink sends records to a Splunk HTTP Event Collector in batches.
+type SplunkSink struct {
+	URL        string     `json:"url"` // e.g. https://splunk.example.com:8088
+	Token      string     `json:"token"`
+	Index      string     `json:"index,omitempty"`
+	Source     string     `json:"source,omitempty"`
+	Sourcetype string     `json:"sourcetype,omitempty"` // Default: xferfaxlog
+	Host       string     `json:"host,omitempty"`
+	TLS        TLSOptions `json:"tls"`
+	BatchOptions
+
+	client *http.Client
+	*recordBatcher
+}
+
+// splunkEvent is the HEC event envelope.
+type splunkEvent struct {
+	Time       float64  `json:"time"`
+	Host       string   `json:"host,omitempty"`
+	Source     string   `json:"source,omitempty"`
+	Sourcetype string   `json:"sourcetype,omitempty"`
+	Index      string   `json:"index,omitempty"`
+	Event      XFRecord `json:"event"`
+}
+
+func newSplunkSink(raw json.RawMessage, env SinkEnv) (Sink, error) {
+	s := &SplunkSink{Sourcetype: "xferfaxlog"}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	if s.URL == "" || s.Token == "" {
+		return nil, fmt.Errorf("url and token are required")
+	}
+	if !strings.Contains(s.URL, "/services/collector") {
+		s.URL = strings.TrimSuffix(s.URL, "/") + "/services/collector/event"
+	}
+
+	client, err := s.TLS.client()
+	if err != nil {
+		return nil, err
+	}
+	s.client = client
+
+	s.recordBatcher = startBatcher(env.Name, s.BatchOptions, s.send)
+	return s, nil
+}
+
+// send posts a batch of records to the collector.
+func (s *SplunkSink) send(ctx context.Context, records []XFRecord) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, r := range records {
+		event := splunkEvent{
+			Time:       float64(r.Ts.UnixNano()) / 1e9,
+			Host:       s.Host,
+			Source:     s.Source,
+			Sourcetype: s.Sourcetype,
+			Index:      s.Index,
+			Event:      r,
+		}
+		if err := enc.Encode(event); err != nil {
+			return fmt.Errorf("error marshaling json: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.URL, &body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Splunk "+s.Token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending events to Splunk: %w", err)
+	}
+	defer resp.Body.Close()
+	responseBody, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(responseBody))}
+	}
+	return nil
+}
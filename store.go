@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// storeSchema is the schema of the bridge's database.
+const storeSchema = `
+CREATE TABLE IF NOT EXISTS processed_lines (
+	hash         TEXT PRIMARY KEY,
+	line         TEXT NOT NULL,
+	processed_at TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS records (
+	commid    TEXT PRIMARY KEY,
+	ts        TIMESTAMP NOT NULL,
+	direction TEXT NOT NULL,
+	modem     TEXT NOT NULL,
+	jobid     TEXT NOT NULL,
+	jobtag    TEXT NOT NULL,
+	filename  TEXT NOT NULL,
+	sender    TEXT NOT NULL,
+	destnum   TEXT NOT NULL,
+	remote_id TEXT NOT NULL,
+	params    TEXT NOT NULL,
+	pages     INTEGER NOT NULL,
+	jobtime   TEXT NOT NULL,
+	conntime  TEXT NOT NULL,
+	reason    TEXT NOT NULL,
+	cidname   TEXT NOT NULL,
+	cidnum    TEXT NOT NULL,
+	owner     TEXT NOT NULL,
+	dcs       TEXT NOT NULL,
+	record    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS records_ts_idx ON records (ts);
+CREATE INDEX IF NOT EXISTS records_destnum_idx ON records (destnum);
+CREATE INDEX IF NOT EXISTS records_cidnum_idx ON records (cidnum);
+CREATE TABLE IF NOT EXISTS relay_attempts (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	commid    TEXT NOT NULL,
+	attempt   INTEGER NOT NULL,
+	time      TIMESTAMP NOT NULL,
+	success   INTEGER NOT NULL,
+	delivered TEXT NOT NULL,
+	error     TEXT NOT NULL,
+	output    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS relay_attempts_commid_idx ON relay_attempts (commid);
+CREATE TABLE IF NOT EXISTS events (
+	id     INTEGER PRIMARY KEY AUTOINCREMENT,
+	type   TEXT NOT NULL,
+	commid TEXT NOT NULL,
+	time   TIMESTAMP NOT NULL,
+	event  TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS events_commid_idx ON events (commid);
+CREATE INDEX IF NOT EXISTS events_time_idx ON events (time);
+`
+
+// Store is the bridge's SQLite database. It is the system of record for
+// processed xferfaxlog lines, the records parsed from them, relay attempts
+// and emitted events.
+type Store struct {
+	db *sql.DB
+}
+
+// OpenStore opens (and creates if needed) the database at path.
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_time_format=sqlite")
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	// SQLite allows a single writer; serializing in database/sql avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(storeSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating database schema: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Ping checks that the database is usable.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func lineHash(line string) string {
+	sum := sha256.Sum256([]byte(line))
+	return hex.EncodeToString(sum[:])
+}
+
+// Processed reports whether the xferfaxlog line has been processed.
+func (s *Store) Processed(line string) (bool, error) {
+	var one int
+	err := s.db.QueryRow("SELECT 1 FROM processed_lines WHERE hash = ?", lineHash(line)).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MarkProcessed stores the record parsed from line and marks the line processed.
+func (s *Store) MarkProcessed(line string, record XFRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT OR IGNORE INTO processed_lines (hash, line, processed_at) VALUES (?, ?, ?)",
+		lineHash(line), line, time.Now().UTC()); err != nil {
+		return fmt.Errorf("error storing processed line: %w", err)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(recordColumns)), ", ")
+	query := fmt.Sprintf("INSERT OR REPLACE INTO records (%s) VALUES (%s)", strings.Join(recordColumns, ", "), placeholders)
+	values := recordValues(record)
+	values[0] = recordKey(record)
+	values[1] = record.Ts.UTC()
+	if _, err := tx.Exec(query, values...); err != nil {
+		return fmt.Errorf("error storing record: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ImportProcessedLog imports a processed_faxes.log written by earlier
+// versions and renames it to <path>.imported.
+func (s *Store) ImportProcessedLog(path string) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n := 0
+	now := time.Now().UTC()
+	// Lines too long to be processed are not imported either
+	scanner := newLogScanner(f, maxLineSize, func([]byte) {})
+	for scanner.Scan() {
+		line := scanner.Text()
+		if _, err := tx.Exec("INSERT OR IGNORE INTO processed_lines (hash, line, processed_at) VALUES (?, ?, ?)",
+			lineHash(line), line, now); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(path, path+".imported")
+}
+
+// RecordAttempt stores the outcome of a relay attempt.
+func (s *Store) RecordAttempt(job *RelayJob, err error) error {
+	errText := ""
+	if err != nil {
+		errText = err.Error()
+	}
+	_, dbErr := s.db.Exec("INSERT INTO relay_attempts (commid, attempt, time, success, delivered, error, output) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		job.Entry.Commid, job.Attempts, time.Now().UTC(), err == nil, strings.Join(job.Delivered, ","), errText, job.LastOutput)
+	if dbErr != nil {
+		return fmt.Errorf("error storing relay attempt: %w", dbErr)
+	}
+	return nil
+}
+
+// RecordEvent stores an emitted event.
+func (s *Store) RecordEvent(event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec("INSERT INTO events (type, commid, time, event) VALUES (?, ?, ?, ?)",
+		event.Type, event.Commid, event.Time.UTC(), string(data)); err != nil {
+		return fmt.Errorf("error storing event: %w", err)
+	}
+	return nil
+}
+
+// PurgeResult counts the rows removed by Purge.
+type PurgeResult struct {
+	Records  int64
+	Attempts int64
+	Events   int64
+}
+
+// Purge removes the records, relay attempts and events older than cutoff.
+// Processed lines are kept, as they keep lines still in the xferfaxlog from
+// being relayed again.
+func (s *Store) Purge(ctx context.Context, cutoff time.Time) (PurgeResult, error) {
+	var res PurgeResult
+	cutoff = cutoff.UTC()
+	for _, q := range []struct {
+		query string
+		count *int64
+	}{
+		{"DELETE FROM records WHERE ts < ?", &res.Records},
+		{"DELETE FROM relay_attempts WHERE time < ?", &res.Attempts},
+		{"DELETE FROM events WHERE time < ?", &res.Events},
+	} {
+		result, err := s.db.ExecContext(ctx, q.query, cutoff)
+		if err != nil {
+			return res, fmt.Errorf("error purging database: %w", err)
+		}
+		*q.count, _ = result.RowsAffected()
+	}
+	return res, nil
+}
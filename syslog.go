@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterSink("syslog", newSyslogSink)
+}
+
+// syslogFacilities maps facility names to their RFC5424 codes.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Syslog severities used for records.
+const (
+	syslogWarning = 4
+	syslogInfo    = 6
+)
+
+// SyslogSink sends records as RFC5424 messages with the record fields as
+// structured data. TCP and TLS messages are framed by octet counting
+// (RFC6587, RFC5425).
+type SyslogSink struct {
+	Address  string     `json:"address"`            // host:port
+	Network  string     `json:"network,omitempty"`  // udp (default), tcp or tls
+	Facility string     `json:"facility,omitempty"` // Default: local0
+	AppName  string     `json:"app_name,omitempty"` // Default: gofaxip-bridge
+	SDID     string     `json:"sd_id,omitempty"`    // Structured data ID (default: xfrecord@32473)
+	TLS      TLSOptions `json:"tls"`
+
+	facility  int
+	hostname  string
+	tlsConfig *tls.Config
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogSink(raw json.RawMessage, env SinkEnv) (Sink, error) {
+	s := &SyslogSink{Network: "udp", Facility: "local0", AppName: "gofaxip-bridge", SDID: "xfrecord@32473"}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	if s.Address == "" {
+		return nil, fmt.Errorf("address is required")
+	}
+	switch s.Network {
+	case "udp", "tcp":
+	case "tls":
+		var err error
+		if s.tlsConfig, err = s.TLS.Config(); err != nil {
+			return nil, fmt.Errorf("invalid TLS settings: %w", err)
+		}
+		if s.tlsConfig == nil {
+			s.tlsConfig = defaultTLSConfig()
+		}
+	default:
+		return nil, fmt.Errorf("invalid network %q: must be udp, tcp or tls", s.Network)
+	}
+	facility, ok := syslogFacilities[s.Facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown facility %q", s.Facility)
+	}
+	s.facility = facility
+	if s.hostname, _ = os.Hostname(); s.hostname == "" {
+		s.hostname = "-"
+	}
+	return s, nil
+}
+
+// Push sends the record, reconnecting once if the connection was lost.
+func (s *SyslogSink) Push(ctx context.Context, record XFRecord) error {
+	msg := s.format(record)
+	if s.Network != "udp" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if s.conn, err = s.dial(ctx); err != nil {
+				return fmt.Errorf("error connecting to syslog server: %w", err)
+			}
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if _, err = s.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return fmt.Errorf("error sending syslog message: %w", err)
+}
+
+// Close closes the connection to the syslog server.
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *SyslogSink) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if s.Network == "tls" {
+		td := &tls.Dialer{NetDialer: dialer, Config: s.tlsConfig}
+		return td.DialContext(ctx, "tcp", s.Address)
+	}
+	return dialer.DialContext(ctx, s.Network, s.Address)
+}
+
+// format renders the record as an RFC5424 message.
+func (s *SyslogSink) format(r XFRecord) string {
+	severity := syslogInfo
+	if !reasonOK(r.Reason) {
+		severity = syslogWarning
+	}
+	ts := r.Ts
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	var sd strings.Builder
+	sd.WriteString("[" + s.SDID)
+	for _, p := range [][2]string{
+		{"direction", string(r.Direction)},
+		{"commid", r.Commid},
+		{"modem", r.Modem},
+		{"jobid", r.Jobid},
+		{"jobtag", r.Jobtag},
+		{"sender", r.Sender},
+		{"destnum", r.Destnum},
+		{"remoteid", r.RemoteID},
+		{"cidnum", r.Cidnum},
+		{"cidname", r.Cidname},
+		{"pages", strconv.FormatUint(uint64(r.Pages), 10)},
+		{"jobtime", r.Jobtime},
+		{"conntime", r.Conntime},
+		{"reason", r.Reason},
+	} {
+		if p[1] != "" {
+			sd.WriteString(" " + p[0] + `="` + sdEscape(p[1]) + `"`)
+		}
+	}
+	sd.WriteString("]")
+
+	msg := fmt.Sprintf("%s %s", r.Direction, r.Commid)
+	if r.Cidnum != "" {
+		msg += " from " + r.Cidnum
+	}
+	msg += fmt.Sprintf(" to %s, %d pages", r.Destnum, r.Pages)
+	if r.Reason != "" {
+		msg += ": " + r.Reason
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		s.facility*8+severity, ts.Format(time.RFC3339Nano), s.hostname, s.AppName, os.Getpid(),
+		msgID(r.Direction), sd.String(), msg)
+}
+
+func msgID(d XFDirection) string {
+	if d == "" {
+		return "-"
+	}
+	return string(d)
+}
+
+// sdEscape escapes a structured data parameter value.
+func sdEscape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(v)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// TeamsNotifier posts events as adaptive cards to Microsoft Teams channels.
+// Each event goes to every channel whose events and DIDs match it.
+type TeamsNotifier struct {
+	Channels []TeamsChannel `json:"channels"`
+	Message  string         `json:"message,omitempty"` // Go template over the event shown instead of the default card body
+
+	message *template.Template
+}
+
+// TeamsChannel is a Teams channel reached through an incoming webhook or
+// Workflows URL.
+type TeamsChannel struct {
+	Name       string      `json:"name,omitempty"`
+	WebhookURL string      `json:"webhook_url"`
+	Events     eventFilter `json:"events,omitempty"`
+	DIDs       []string    `json:"dids,omitempty"` // Destination numbers posted to the channel, all if empty
+}
+
+// compile checks that every channel has a webhook and parses the message
+// template.
+func (t *TeamsNotifier) compile() error {
+	if len(t.Channels) == 0 {
+		return fmt.Errorf("teams: no channels configured")
+	}
+	for i, c := range t.Channels {
+		if c.WebhookURL == "" {
+			return fmt.Errorf("teams: channel %d: webhook_url is required", i)
+		}
+	}
+	var err error
+	t.message, err = parseNotifyTemplate("teams message", t.Message)
+	return err
+}
+
+// wants reports whether the event is posted to the channel.
+func (c *TeamsChannel) wants(event Event) bool {
+	if !c.Events.accepts(event.Type) {
+		return false
+	}
+	if len(c.DIDs) == 0 {
+		return true
+	}
+	for _, did := range c.DIDs {
+		if did == event.Destnum {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify posts the event to all matching channels.
+func (t *TeamsNotifier) Notify(ctx context.Context, event Event) error {
+	var body []byte
+	var errs []string
+	for _, c := range t.Channels {
+		if !c.wants(event) {
+			continue
+		}
+		if body == nil {
+			msg, err := t.card(event)
+			if err != nil {
+				return err
+			}
+			if body, err = json.Marshal(msg); err != nil {
+				return fmt.Errorf("error marshaling json: %w", err)
+			}
+		}
+		err := c.post(ctx, body)
+		countPush("notify_teams", err)
+		if err != nil {
+			sinkDropped.WithLabelValues("notify_teams").Inc()
+			name := c.Name
+			if name == "" {
+				name = c.WebhookURL
+			}
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error posting to teams: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// card returns the message with the adaptive card of the event.
+func (t *TeamsNotifier) card(event Event) (map[string]any, error) {
+	var facts []any
+	for _, d := range eventDetails(event) {
+		facts = append(facts, map[string]string{"title": d[0], "value": d[1]})
+	}
+	color := "Default"
+	switch event.Type {
+	case EventRelayFailed, EventDeliveryFailed, EventQuarantined:
+		color = "Attention"
+	case EventDeliveryConfirmed:
+		color = "Good"
+	}
+	body := []any{
+		map[string]any{"type": "TextBlock", "text": eventSummary(event), "size": "Medium", "weight": "Bolder", "color": color, "wrap": true},
+		map[string]any{"type": "FactSet", "facts": facts},
+		map[string]any{"type": "TextBlock", "text": event.Time.Format("2006-01-02 15:04:05 MST"), "isSubtle": true, "size": "Small"},
+	}
+	if t.message != nil {
+		text, err := renderEvent(t.message, event)
+		if err != nil {
+			return nil, err
+		}
+		body = []any{map[string]any{"type": "TextBlock", "text": text, "wrap": true}}
+	}
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+	}
+	return map[string]any{
+		"type": "message",
+		"attachments": []any{
+			map[string]any{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	}, nil
+}
+
+func (c *TeamsChannel) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+	return nil
+}
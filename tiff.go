@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxTiffPages guards against IFD chains that loop back on themselves.
+const maxTiffPages = 10000
+
+// countTiffPages returns the number of pages (IFDs) in a TIFF file.
+func countTiffPages(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return walkTiff(f, nil)
+}
+
+// walkTiff calls fn with the entries of every IFD of a TIFF file and
+// returns the number of pages. fn may be nil.
+func walkTiff(f *os.File, fn func(order binary.ByteOrder, page int, entries []byte) error) (int, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return 0, fmt.Errorf("error reading TIFF header: %w", err)
+	}
+
+	var order binary.ByteOrder
+	switch string(header[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, fmt.Errorf("not a TIFF file")
+	}
+	if order.Uint16(header[2:4]) != 42 {
+		return 0, fmt.Errorf("not a TIFF file")
+	}
+
+	pages := 0
+	offset := int64(order.Uint32(header[4:8]))
+	seen := make(map[int64]bool)
+	buf := make([]byte, 4)
+	for offset != 0 {
+		if seen[offset] || pages >= maxTiffPages {
+			return 0, fmt.Errorf("invalid IFD chain")
+		}
+		seen[offset] = true
+
+		if _, err := f.ReadAt(buf[:2], offset); err != nil {
+			return 0, fmt.Errorf("error reading IFD %d: %w", pages, err)
+		}
+		entries := int64(order.Uint16(buf[:2]))
+		if fn != nil {
+			data := make([]byte, entries*12)
+			if _, err := f.ReadAt(data, offset+2); err != nil {
+				return 0, fmt.Errorf("error reading IFD %d: %w", pages, err)
+			}
+			if err := fn(order, pages, data); err != nil {
+				return 0, fmt.Errorf("IFD %d: %w", pages, err)
+			}
+		}
+		if _, err := f.ReadAt(buf, offset+2+entries*12); err != nil {
+			return 0, fmt.Errorf("error reading IFD %d: %w", pages, err)
+		}
+		pages++
+		offset = int64(order.Uint32(buf))
+	}
+
+	if pages == 0 {
+		return 0, fmt.Errorf("TIFF has no pages")
+	}
+	return pages, nil
+}
+
+// TIFF tags locating the image data of a page.
+const (
+	tiffStripOffsets    = 273
+	tiffStripByteCounts = 279
+	tiffTileOffsets     = 324
+	tiffTileByteCounts  = 325
+)
+
+// maxTiffStrips guards against absurd strip counts.
+const maxTiffStrips = 1 << 16
+
+// hashTiffImages returns the hex encoded SHA-256 of the image data of all
+// pages, leaving out tags like DateTime that differ between receptions of
+// the same fax.
+func hashTiffImages(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = walkTiff(f, func(order binary.ByteOrder, page int, entries []byte) error {
+		var offsets, counts []uint32
+		for i := 0; i+12 <= len(entries); i += 12 {
+			entry := entries[i : i+12]
+			var err error
+			switch order.Uint16(entry[0:2]) {
+			case tiffStripOffsets, tiffTileOffsets:
+				offsets, err = tiffValues(f, order, entry)
+			case tiffStripByteCounts, tiffTileByteCounts:
+				counts, err = tiffValues(f, order, entry)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if len(offsets) == 0 || len(offsets) != len(counts) {
+			return fmt.Errorf("invalid strips")
+		}
+		fmt.Fprintf(h, "page %d\n", page)
+		for i, offset := range offsets {
+			if _, err := io.Copy(h, io.NewSectionReader(f, int64(offset), int64(counts[i]))); err != nil {
+				return fmt.Errorf("error reading strip %d: %w", i, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// tiffValues returns the SHORT or LONG values of an IFD entry.
+func tiffValues(f *os.File, order binary.ByteOrder, entry []byte) ([]uint32, error) {
+	size := 0
+	switch order.Uint16(entry[2:4]) {
+	case 3:
+		size = 2
+	case 4:
+		size = 4
+	default:
+		return nil, fmt.Errorf("unexpected type of tag %d", order.Uint16(entry[0:2]))
+	}
+	count := int(order.Uint32(entry[4:8]))
+	if count > maxTiffStrips {
+		return nil, fmt.Errorf("too many strips")
+	}
+	data := entry[8:12]
+	if count*size > 4 {
+		data = make([]byte, count*size)
+		if _, err := f.ReadAt(data, int64(order.Uint32(entry[8:12]))); err != nil {
+			return nil, err
+		}
+	}
+	values := make([]uint32, count)
+	for i := range values {
+		if size == 2 {
+			values[i] = uint32(order.Uint16(data[i*2:]))
+		} else {
+			values[i] = order.Uint32(data[i*4:])
+		}
+	}
+	return values, nil
+}
+
+// validateTiff checks that the TIFF of a received fax exists, is readable and
+// holds as many pages as the xferfaxlog record says.
+func validateTiff(entry XFRecord, path string) error {
+	pages, err := countTiffPages(path)
+	if err != nil {
+		return err
+	}
+	if entry.Pages > 0 && pages != int(entry.Pages) {
+		return fmt.Errorf("TIFF has %d pages, record says %d", pages, entry.Pages)
+	}
+	return nil
+}
+
+// QuarantineMeta is written as a JSON sidecar next to each quarantined TIFF.
+type QuarantineMeta struct {
+	Record      XFRecord  `json:"record"`
+	Source      string    `json:"source"`
+	Reason      string    `json:"reason"`
+	Quarantined time.Time `json:"quarantined"`
+}
+
+// quarantineFax moves the TIFF of a fax that failed validation into dir.
+func quarantineFax(dir string, entry XFRecord, path, reason string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	dest := filepath.Join(dir, entry.Commid+"-"+filepath.Base(path))
+	if _, err := os.Stat(path); err == nil {
+		if err := moveFile(path, dest); err != nil {
+			return err
+		}
+	}
+
+	meta, err := json.MarshalIndent(QuarantineMeta{
+		Record:      entry,
+		Source:      path,
+		Reason:      reason,
+		Quarantined: time.Now(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(dest+".json", meta, 0644); err != nil {
+		return err
+	}
+
+	log.Infof("Quarantined %s to %s", path, dest)
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// TLSOptions configures TLS for outgoing connections.
+type TLSOptions struct {
+	CAFile             string `json:"ca_file,omitempty"`   // PEM bundle of CAs to trust instead of the system roots
+	CertFile           string `json:"cert_file,omitempty"` // PEM client certificate
+	KeyFile            string `json:"key_file,omitempty"`  // PEM key of the client certificate
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// enabled reports whether any options differ from the defaults.
+func (o TLSOptions) enabled() bool {
+	return o.CAFile != "" || o.CertFile != "" || o.KeyFile != "" || o.InsecureSkipVerify
+}
+
+// Config builds the tls.Config for the options, or nil if none are set.
+func (o TLSOptions) Config() (*tls.Config, error) {
+	if !o.enabled() {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, fmt.Errorf("client certificate and key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// client returns the shared HTTP client, or one of its own when options
+// are set. Its requests take up to the timeout of the shared client at the
+// time they are sent, as configs are compiled before httpTimeout is
+// applied.
+func (o TLSOptions) client() (*http.Client, error) {
+	tlsConfig, err := o.Config()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS settings: %w", err)
+	}
+	if tlsConfig == nil {
+		return httpClient, nil
+	}
+	client := newHTTPClient(0, tlsConfig)
+	client.Transport = sharedTimeout{client.Transport}
+	return client, nil
+}
+
+// defaultTLSConfig is used when TLS is requested without any options.
+func defaultTLSConfig() *tls.Config {
+	return &tls.Config{MinVersion: tls.VersionTLS12}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WatchFolder configures a drop directory whose files are faxed.
+type WatchFolder struct {
+	Dir        string   `json:"dir"`                   // Drop directory
+	SentDir    string   `json:"sent_dir,omitempty"`    // Where faxed files are moved (default: <dir>/sent)
+	FailedDir  string   `json:"failed_dir,omitempty"`  // Where failed files are moved (default: <dir>/failed)
+	Settle     Duration `json:"settle,omitempty"`      // How long a file must be unchanged before it is faxed (default: 5s)
+	CallerID   string   `json:"caller_id,omitempty"`   // Caller ID number of the faxes
+	CallerName string   `json:"caller_name,omitempty"` // Caller ID name of the faxes
+	Backend    string   `json:"backend,omitempty"`     // sendfax or hylafax (default: as the send API)
+	Route      string   `json:"route,omitempty"`       // Route whose modem, host and profile are used
+	Profile    string   `json:"profile,omitempty"`     // Sendfax profile, overriding the route's
+}
+
+// compile validates the watch folder and fills in defaults.
+func (w *WatchFolder) compile() error {
+	if w.Dir == "" {
+		return fmt.Errorf("watch_folder: dir is required")
+	}
+	if w.SentDir == "" {
+		w.SentDir = filepath.Join(w.Dir, "sent")
+	}
+	if w.FailedDir == "" {
+		w.FailedDir = filepath.Join(w.Dir, "failed")
+	}
+	if w.Settle.Duration == 0 {
+		w.Settle.Duration = 5 * time.Second
+	}
+	if w.Backend != "" && w.Backend != BackendSendfax && w.Backend != BackendHylaFAX {
+		return fmt.Errorf("watch_folder: backend must be sendfax or hylafax")
+	}
+	return nil
+}
+
+// watchFolderInterval is how often the watch folder is scanned. It is
+// polled rather than watched, as drop folders are often network shares
+// that do not deliver inotify events.
+const watchFolderInterval = 2 * time.Second
+
+// dropNumber matches the destination at the start of a file name, like
+// 15551234567_invoice.pdf or 15551234567.pdf.
+var dropNumber = regexp.MustCompile(`^(\+?\d+)(?:[_.]|$)`)
+
+// droppedFile is the state of a file seen in the watch folder.
+type droppedFile struct {
+	size    int64
+	modTime time.Time
+	since   time.Time // When it was last seen changing
+	done    bool      // Processed, but could not be moved away
+}
+
+// FolderWatcher faxes the files placed into the watch folder of the config.
+type FolderWatcher struct {
+	files map[string]droppedFile
+}
+
+// NewFolderWatcher creates a watcher of the config's watch folder.
+func NewFolderWatcher() *FolderWatcher {
+	return &FolderWatcher{files: make(map[string]droppedFile)}
+}
+
+// Start scans the watch folder until the bridge exits. A config without a
+// watch folder, as reloaded, is skipped.
+func (w *FolderWatcher) Start() {
+	go func() {
+		for {
+			if cfg := relayer.Config().WatchFolder; cfg != nil {
+				w.scan(cfg)
+			}
+			time.Sleep(watchFolderInterval)
+		}
+	}()
+}
+
+// scan faxes the files that have settled, in the folder and its
+// per-destination subfolders.
+func (w *FolderWatcher) scan(cfg *WatchFolder) {
+	seen := make(map[string]bool)
+	entries, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		log.Errorf("Error reading watch folder: %s", err)
+		return
+	}
+	for _, e := range entries {
+		path := filepath.Join(cfg.Dir, e.Name())
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if !e.IsDir() {
+			w.check(cfg, path, "", seen)
+			continue
+		}
+		if path == cfg.SentDir || path == cfg.FailedDir || !isDigits(e.Name()) {
+			continue
+		}
+		files, err := os.ReadDir(path)
+		if err != nil {
+			log.Errorf("Error reading watch folder: %s", err)
+			continue
+		}
+		for _, f := range files {
+			if !f.IsDir() && !strings.HasPrefix(f.Name(), ".") {
+				w.check(cfg, filepath.Join(path, f.Name()), e.Name(), seen)
+			}
+		}
+	}
+	for path := range w.files {
+		if !seen[path] {
+			delete(w.files, path)
+		}
+	}
+}
+
+// check faxes a file once it has not changed for the settle time.
+func (w *FolderWatcher) check(cfg *WatchFolder, path, destnum string, seen map[string]bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	seen[path] = true
+	now := time.Now()
+	prev, ok := w.files[path]
+	if !ok || prev.size != info.Size() || !prev.modTime.Equal(info.ModTime()) {
+		w.files[path] = droppedFile{size: info.Size(), modTime: info.ModTime(), since: now}
+		return
+	}
+	if prev.done || now.Sub(prev.since) < cfg.Settle.Duration {
+		return
+	}
+
+	if destnum == "" {
+		if m := dropNumber.FindStringSubmatch(filepath.Base(path)); m != nil {
+			destnum = m[1]
+		}
+	}
+	logger := log.WithFields(log.Fields{"file": path, "destnum": destnum})
+	dir, outcome := cfg.SentDir, any(nil)
+	sub, err := faxDroppedFile(cfg, path, destnum)
+	if err != nil {
+		logger.Errorf("Error faxing dropped file: %s", err)
+		dir, outcome = cfg.FailedDir, map[string]string{"destnum": destnum, "error": err.Error()}
+	} else {
+		logger.WithField("commid", sub.ID).Infof("Faxed dropped file as job %s", sub.Jobid)
+		outcome = sub
+	}
+	if err := moveDropped(path, dir, outcome); err != nil {
+		// Not faxed again unless it changes
+		logger.Errorf("Error moving dropped file to %s: %s", dir, err)
+		prev.done = true
+		w.files[path] = prev
+		return
+	}
+	delete(w.files, path)
+}
+
+func faxDroppedFile(cfg *WatchFolder, path, destnum string) (*Submission, error) {
+	if destnum == "" {
+		return nil, fmt.Errorf("no destination, expected a subfolder named by the number or a file name starting with it")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := saveDocument(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(doc)
+	return relayer.Send(context.Background(), SendRequest{
+		Destnum: destnum,
+		Cidnum:  cfg.CallerID,
+		Cidname: cfg.CallerName,
+		Backend: cfg.Backend,
+		Route:   cfg.Route,
+		Profile: cfg.Profile,
+	}, doc)
+}
+
+// moveDropped moves a processed file into dir, next to a JSON sidecar
+// with the outcome, adding a timestamp if the name is taken.
+func moveDropped(path, dir string, outcome any) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	dest := filepath.Join(dir, filepath.Base(path))
+	if _, err := os.Stat(dest); err == nil {
+		dest = filepath.Join(dir, time.Now().Format("20060102T150405.000")+"_"+filepath.Base(path))
+	}
+	if err := moveFile(path, dest); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(outcome, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(dest+".json", data, 0644); err != nil {
+		log.Errorf("Error writing %s.json: %s", dest, err)
+	}
+	return nil
+}
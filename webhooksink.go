@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+func init() {
+	RegisterSink("webhook", newWebhookSink)
+}
+
+// WebhookSink posts every record as JSON to an HTTP endpoint.
+type WebhookSink struct {
+	URL      string            `json:"url"`
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	TLS      TLSOptions        `json:"tls"` // Private CA and client certificate, e.g. for mutual TLS
+
+	client *http.Client
+}
+
+func newWebhookSink(raw json.RawMessage, env SinkEnv) (Sink, error) {
+	s := &WebhookSink{}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	if s.URL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	client, err := s.TLS.client()
+	if err != nil {
+		return nil, err
+	}
+	s.client = client
+	return s, nil
+}
+
+// Push posts the record to the webhook.
+func (s *WebhookSink) Push(ctx context.Context, record XFRecord) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling json: %w", err)
+	}
+	return s.post(ctx, body, "application/json")
+}
+
+// post sends body to the webhook.
+func (s *WebhookSink) post(ctx context.Context, body []byte, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	if s.Username != "" && s.Password != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}